@@ -0,0 +1,271 @@
+package improvmx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The default number of accounts queried concurrently by Accounts.
+const DefaultAccountConcurrency = 4
+
+// Returned by Accounts.Owner when no account owns the domain.
+var ErrDomainNotOwned = errors.New("domain is not owned by any account")
+
+// Holds a Session for each of several ImprovMX accounts, keyed by name, and
+// fans read operations out across all of them. It is safe for concurrent use.
+type Accounts struct {
+	// Maximum number of accounts queried at once. Defaults to
+	// DefaultAccountConcurrency when not positive.
+	Concurrency int
+
+	mutex    sync.RWMutex
+	sessions map[string]*Session
+}
+
+// A Domain, tagged with the name of the account owning it.
+type AccountDomain struct {
+	Account string
+	Domain
+}
+
+// An Alias, tagged with the account and domain it belongs to.
+type AccountAlias struct {
+	Account string
+	Domain  string
+	Alias
+}
+
+// A LogEntry, tagged with the account and domain it was read from.
+type AccountLogEntry struct {
+	Account string
+	Domain  string
+	LogEntry
+}
+
+// The failure of an operation against a single account.
+type AccountError struct {
+	Account string
+	Err     error
+}
+
+// Returns an empty set of accounts.
+func NewAccounts() *Accounts {
+	return &Accounts{sessions: make(map[string]*Session)}
+}
+
+// Returns a set of accounts holding a Session for every profile of the
+// configuration file at path. The given options are applied to every session
+// after those of its profile. Unlike NewFromConfig, IMPROVMX_PROFILE and
+// IMPROVMX_API_TOKEN are ignored, as they select a single account.
+func AccountsFromConfig(ctx context.Context, path string, options ...SessionOption) (*Accounts, error) {
+	config, error := LoadConfig(path)
+	if error != nil {
+		return nil, error
+	}
+	accounts := NewAccounts()
+	for _, name := range sortedKeys(config.Profiles) {
+		profile := config.Profiles[name]
+		token, error := profile.ResolveToken(ctx)
+		if error != nil {
+			return nil, fmt.Errorf("profile %q: %w", name, error)
+		}
+		session, error := New(token, append(profile.Options(), options...)...)
+		if error != nil {
+			return nil, fmt.Errorf("profile %q: %w", name, error)
+		}
+		accounts.sessions[name] = session
+	}
+	return accounts, nil
+}
+
+// Adds the session under the given name. An error is returned if the name is
+// already in use.
+func (accounts *Accounts) Add(name string, session *Session) error {
+	if session == nil {
+		return fmt.Errorf("Add was passed a nil session for account %q", name)
+	}
+	accounts.mutex.Lock()
+	defer accounts.mutex.Unlock()
+	if _, ok := accounts.sessions[name]; ok {
+		return fmt.Errorf("account %q already exists", name)
+	}
+	accounts.sessions[name] = session
+	return nil
+}
+
+// Removes the named account, if present.
+func (accounts *Accounts) Remove(name string) {
+	accounts.mutex.Lock()
+	defer accounts.mutex.Unlock()
+	delete(accounts.sessions, name)
+}
+
+// Returns the session of the named account.
+func (accounts *Accounts) Get(name string) (*Session, bool) {
+	accounts.mutex.RLock()
+	defer accounts.mutex.RUnlock()
+	session, ok := accounts.sessions[name]
+	return session, ok
+}
+
+// Returns the names of every account, sorted.
+func (accounts *Accounts) Names() []string {
+	accounts.mutex.RLock()
+	defer accounts.mutex.RUnlock()
+	return sortedKeys(accounts.sessions)
+}
+
+// Returns the domains of every account. Results are ordered by account name,
+// then as returned by the ImprovMX REST API.
+//
+// If some accounts fail, the domains of the remaining accounts are still
+// returned, alongside an error wrapping an *AccountError for each failure.
+func (accounts *Accounts) Domains(ctx context.Context, options ...*ListOption) ([]AccountDomain, error) {
+	return fanOut(ctx, accounts, func(ctx context.Context, name string, session *Session) ([]AccountDomain, error) {
+		domains, error := session.Domains.List(ctx, options...)
+		if error != nil {
+			return nil, error
+		}
+		results := make([]AccountDomain, len(domains))
+		for index, domain := range domains {
+			results[index] = AccountDomain{name, domain}
+		}
+		return results, nil
+	})
+}
+
+// Returns the aliases of every domain of every account. Results are ordered by
+// account name, then by domain as listed by the ImprovMX REST API. Errors are
+// reported as they are by Domains.
+func (accounts *Accounts) Aliases(ctx context.Context, options ...*ListOption) ([]AccountAlias, error) {
+	return fanOut(ctx, accounts, func(ctx context.Context, name string, session *Session) ([]AccountAlias, error) {
+		domains, error := session.Domains.List(ctx)
+		if error != nil {
+			return nil, error
+		}
+		var results []AccountAlias
+		for _, domain := range domains {
+			aliases, error := session.Aliases.List(ctx, domain.Name, options...)
+			if error != nil {
+				return results, fmt.Errorf("%s: %w", domain.Name, error)
+			}
+			for _, alias := range aliases {
+				results = append(results, AccountAlias{name, domain.Name, alias})
+			}
+		}
+		return results, nil
+	})
+}
+
+// Returns the logs of the given domains across every account, or of every
+// domain if none are given. Domain names are compared ignoring case, and
+// domains not owned by an account are skipped.
+// Errors are reported as they are by Domains.
+func (accounts *Accounts) Logs(ctx context.Context, domains ...string) ([]AccountLogEntry, error) {
+	return fanOut(ctx, accounts, func(ctx context.Context, name string, session *Session) ([]AccountLogEntry, error) {
+		owned, error := session.Domains.List(ctx)
+		if error != nil {
+			return nil, error
+		}
+		var results []AccountLogEntry
+		for _, domain := range owned {
+			wanted := func(given string) bool { return strings.EqualFold(given, domain.Name) }
+			if len(domains) != 0 && !slices.ContainsFunc(domains, wanted) {
+				continue
+			}
+			entries, error := session.Domains.Logs(ctx, domain.Name)
+			if error != nil {
+				return results, fmt.Errorf("%s: %w", domain.Name, error)
+			}
+			for _, entry := range entries {
+				results = append(results, AccountLogEntry{name, domain.Name, entry})
+			}
+		}
+		return results, nil
+	})
+}
+
+// Returns the name and session of the account owning the given domain. If no
+// account owns it, ErrDomainNotOwned is returned, joined with the failures of
+// any account that could not be queried.
+func (accounts *Accounts) Owner(ctx context.Context, domain string) (string, *Session, error) {
+	owners, error := fanOut(ctx, accounts, func(ctx context.Context, name string, session *Session) ([]string, error) {
+		if _, error := session.Domains.Read(ctx, domain); error != nil {
+			if isNotFound(error) {
+				return nil, nil
+			}
+			return nil, error
+		}
+		return []string{name}, nil
+	})
+	if len(owners) == 0 {
+		return "", nil, errors.Join(fmt.Errorf("%s: %w", domain, ErrDomainNotOwned), error)
+	}
+	session, _ := accounts.Get(owners[0])
+	return owners[0], session, nil
+}
+
+func (failure *AccountError) Error() string {
+	return fmt.Sprintf("account %q: %v", failure.Account, failure.Err)
+}
+
+func (failure *AccountError) Unwrap() error {
+	return failure.Err
+}
+
+// Calls fetch for every account, with at most Concurrency calls in flight, and
+// concatenates their results in account name order. Partial results of failed
+// accounts are kept.
+func fanOut[T any](ctx context.Context, accounts *Accounts, fetch func(context.Context, string, *Session) ([]T, error)) ([]T, error) {
+	names := accounts.Names()
+	concurrency := accounts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultAccountConcurrency
+	}
+	results := make([][]T, len(names))
+	failures := make([]error, len(names))
+	semaphore := make(chan struct{}, concurrency)
+	group := sync.WaitGroup{}
+	for index, name := range names {
+		session, ok := accounts.Get(name)
+		if !ok {
+			continue
+		}
+		group.Add(1)
+		go func(index int, name string, session *Session) {
+			defer group.Done()
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-ctx.Done():
+				failures[index] = &AccountError{name, ctx.Err()}
+				return
+			}
+			values, error := fetch(ctx, name, session)
+			results[index] = values
+			if error != nil {
+				failures[index] = &AccountError{name, error}
+			}
+		}(index, name, session)
+	}
+	group.Wait()
+	var merged []T
+	for _, values := range results {
+		merged = append(merged, values...)
+	}
+	return merged, errors.Join(failures...)
+}
+
+func sortedKeys[T any](values map[string]T) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,172 @@
+package improvmx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"occult.work/doze/test"
+)
+
+type AccountsTestSuite struct {
+	test.Suite
+	other    *httptest.Server
+	broken   *httptest.Server
+	accounts *Accounts
+}
+
+func (suite *AccountsTestSuite) SetupSuite() {
+	router := test.NewRouter().
+		Get(domainListPath, suite.FileResponseHandler("testdata/domain/list.json")).
+		Get(aliasListPath, suite.FileResponseHandler("testdata/alias/list.json")).
+		Get(domainLogsPath, suite.FileResponseHandler("testdata/domain/logs.json")).
+		Get(domainReadPath, func(writer http.ResponseWriter, request *http.Request) {
+			if request.URL.Path != "/domains/piedpiper.com/" {
+				writer.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(writer, `{ "error": "Domain not found", "code": 404, "success": false }`)
+				return
+			}
+			suite.FileResponseHandler("testdata/domain/read.json")(writer, request)
+		})
+	suite.Initialize(router)
+	suite.Data = &testData
+	suite.other = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		if request.URL.Path == "/domains/" {
+			fmt.Fprint(writer, `{ "domains": [{ "domain": "hooli.com", "active": true }], "total": 1, "limit": 50, "page": 1, "success": true }`)
+			return
+		}
+		if request.URL.Path == "/domains/hooli.com/aliases/" {
+			fmt.Fprint(writer, `{ "aliases": [{ "alias": "gavin", "forward": "gavin@example.com", "id": 1 }], "total": 1, "limit": 50, "page": 1, "success": true }`)
+			return
+		}
+		writer.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(writer, `{ "error": "Not found", "code": 404, "success": false }`)
+	}))
+	suite.broken = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(writer, `{ "error": "Internal error", "code": 500, "success": false }`)
+	}))
+}
+
+func (suite *AccountsTestSuite) TearDownSuite() {
+	suite.other.Close()
+	suite.broken.Close()
+}
+
+func (suite *AccountsTestSuite) SetupTest() {
+	suite.accounts = NewAccounts()
+	for name, url := range map[string]string{"piper": suite.Server.URL, "hooli": suite.other.URL} {
+		session, error := New("token", WithBaseURL(url))
+		suite.Require().NoError(error)
+		suite.Require().NoError(suite.accounts.Add(name, session))
+	}
+}
+
+func (suite *AccountsTestSuite) addBroken() {
+	session, error := New("token", WithBaseURL(suite.broken.URL))
+	suite.Require().NoError(error)
+	suite.Require().NoError(suite.accounts.Add("broken", session))
+}
+
+func TestAccounts(t *testing.T) {
+	test.Run(t, new(AccountsTestSuite))
+}
+
+func (suite *AccountsTestSuite) TestManage() {
+	suite.Equal([]string{"hooli", "piper"}, suite.accounts.Names())
+	session, ok := suite.accounts.Get("piper")
+	suite.True(ok)
+	suite.Error(suite.accounts.Add("piper", session))
+	suite.Error(suite.accounts.Add("nil", nil))
+	suite.accounts.Remove("piper")
+	_, ok = suite.accounts.Get("piper")
+	suite.False(ok)
+}
+
+func (suite *AccountsTestSuite) TestDomains() {
+	domains, error := suite.accounts.Domains(context.Background())
+	suite.Require().NoError(error)
+	suite.Require().Len(domains, 4)
+	suite.Equal("hooli", domains[0].Account)
+	suite.Equal("hooli.com", domains[0].Name)
+	suite.Equal("piper", domains[1].Account)
+	suite.Equal("google.com", domains[1].Name)
+}
+
+func (suite *AccountsTestSuite) TestPartialFailure() {
+	suite.addBroken()
+	suite.accounts.Concurrency = 1
+	domains, error := suite.accounts.Domains(context.Background())
+	suite.Len(domains, 4)
+	var failure *AccountError
+	suite.Require().True(errors.As(error, &failure))
+	suite.Equal("broken", failure.Account)
+	var apiError *Error
+	suite.True(errors.As(error, &apiError))
+	suite.Equal(http.StatusInternalServerError, apiError.Code)
+}
+
+func (suite *AccountsTestSuite) TestAliases() {
+	aliases, error := suite.accounts.Aliases(context.Background())
+	suite.Require().NoError(error)
+	suite.Equal(AccountAlias{"hooli", "hooli.com", Alias{Name: "gavin", Address: "gavin@example.com", ID: 1}}, aliases[0])
+	// Each piper domain pages through the alias list twice
+	suite.Len(aliases, 31)
+	suite.Equal("piper", aliases[1].Account)
+	suite.Equal("google.com", aliases[1].Domain)
+}
+
+func (suite *AccountsTestSuite) TestLogs() {
+	entries, error := suite.accounts.Logs(context.Background(), "piedpiper.com")
+	suite.Require().NoError(error)
+	suite.NotEmpty(entries)
+	for _, entry := range entries {
+		suite.Equal("piper", entry.Account)
+		suite.Equal("piedpiper.com", entry.Domain)
+	}
+	folded, error := suite.accounts.Logs(context.Background(), "PiedPiper.com")
+	suite.Require().NoError(error)
+	suite.Equal(entries, folded)
+	_, error = suite.accounts.Logs(context.Background(), "hooli.com")
+	suite.Error(error)
+}
+
+func (suite *AccountsTestSuite) TestOwner() {
+	name, session, error := suite.accounts.Owner(context.Background(), "piedpiper.com")
+	suite.Require().NoError(error)
+	suite.Equal("piper", name)
+	expected, _ := suite.accounts.Get("piper")
+	suite.Same(expected, session)
+
+	_, _, error = suite.accounts.Owner(context.Background(), "example.com")
+	suite.ErrorIs(error, ErrDomainNotOwned)
+
+	suite.addBroken()
+	_, _, error = suite.accounts.Owner(context.Background(), "example.com")
+	suite.ErrorIs(error, ErrDomainNotOwned)
+	var failure *AccountError
+	suite.True(errors.As(error, &failure))
+}
+
+func TestAccountsFromConfig(t *testing.T) {
+	clearEnvironment(t)
+	assert := assert.New(t)
+	accounts, error := AccountsFromConfig(context.Background(), writeConfig(t, `
+[profiles.work]
+token = "work"
+
+[profiles.home]
+token_command = ["echo", "home"]
+`))
+	assert.NoError(error)
+	assert.Equal([]string{"home", "work"}, accounts.Names())
+
+	_, error = AccountsFromConfig(context.Background(), writeConfig(t, "[profiles.empty]\n"))
+	assert.ErrorContains(error, `profile "empty"`)
+}
@@ -0,0 +1,331 @@
+// Package alert evaluates rules against ImprovMX log entries, and delivers
+// alerts through pluggable notifiers when a rule is triggered.
+//
+// Rules select entries with a search.Query, and trigger once more than
+// Threshold matching entries matched within Window. An entry is timed by
+// its latest event matching the rule, such as a bounce. For example, the
+// following rule triggers on more than five hard bounces for an alias within
+// ten minutes:
+//
+//	alert.Rule{
+//		Name:      "richard bounces",
+//		Query:     search.MustParse("event:hard-bounce recipient:richard@piedpiper.com"),
+//		Threshold: 5,
+//		Window:    10 * time.Minute,
+//	}
+//
+// A Threshold of zero triggers on any matching entry. Entries are only ever
+// counted once per rule, so the same logs may be observed repeatedly, as is
+// the case when polling the ImprovMX REST API.
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"occult.work/improvmx"
+	"occult.work/improvmx/export"
+	"occult.work/improvmx/search"
+)
+
+// The maximum number of records attached to an Alert.
+const maxSamples = 10
+
+// Describes when an alert is raised.
+type Rule struct {
+	Name string
+	// Selects the entries counted by the rule. A nil Query matches every
+	// entry.
+	Query *search.Query
+	// The rule triggers once more than Threshold entries match within Window.
+	Threshold int
+	// Defaults to ten minutes if zero.
+	Window time.Duration
+	// Minimum time between two alerts for the same rule and group. Defaults to
+	// Window if zero.
+	Cooldown time.Duration
+	// Counts entries separately for each distinct value of the given field,
+	// which is one of "domain", "recipient", "sender", or "forward". If empty,
+	// all matching entries are counted together.
+	GroupBy string
+}
+
+// Raised when a Rule is triggered.
+type Alert struct {
+	Rule  string    `json:"rule"`
+	Group string    `json:"group,omitempty"`
+	Count int       `json:"count"`
+	Since time.Time `json:"since"`
+	Time  time.Time `json:"time"`
+	// Up to ten of the most recent matching records
+	Records []export.Record `json:"records"`
+}
+
+// Delivers alerts. Notify may be called concurrently.
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// Evaluates rules against observed records, deduplicating entries and rate
+// limiting alerts, and passes alerts to every notifier.
+type Engine struct {
+	rules     []Rule
+	notifiers []Notifier
+	now       func() time.Time
+	mutex     sync.Mutex
+	states    []*ruleState
+}
+
+type ruleState struct {
+	seen   map[string]time.Time
+	groups map[string]*groupState
+}
+
+type groupState struct {
+	records   []timedRecord
+	lastAlert time.Time
+}
+
+type timedRecord struct {
+	created time.Time
+	record  export.Record
+}
+
+func (alert Alert) String() string {
+	if alert.Group != "" {
+		return fmt.Sprintf("%s [%s]: %d matching entries since %s", alert.Rule, alert.Group, alert.Count, alert.Since.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%s: %d matching entries since %s", alert.Rule, alert.Count, alert.Since.Format(time.RFC3339))
+}
+
+// Returns a new Engine. An error is returned if any rule is invalid.
+func NewEngine(rules []Rule, notifiers ...Notifier) (*Engine, error) {
+	engine := &Engine{notifiers: notifiers, now: time.Now}
+	for index, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", index+1)
+		}
+		if rule.Threshold < 0 {
+			return nil, fmt.Errorf("%s: threshold must not be negative: %d", rule.Name, rule.Threshold)
+		}
+		if rule.Window == 0 {
+			rule.Window = 10 * time.Minute
+		}
+		if rule.Cooldown == 0 {
+			rule.Cooldown = rule.Window
+		}
+		if _, ok := groupFields[rule.GroupBy]; !ok {
+			return nil, fmt.Errorf("%s: cannot group by %q", rule.Name, rule.GroupBy)
+		}
+		engine.rules = append(engine.rules, rule)
+		engine.states = append(engine.states, &ruleState{
+			seen:   make(map[string]time.Time),
+			groups: make(map[string]*groupState),
+		})
+	}
+	return engine, nil
+}
+
+// Evaluates every rule against the records, and notifies for each rule that
+// was triggered. Returns the alerts that were raised, and any errors returned
+// by the notifiers.
+func (engine *Engine) Observe(ctx context.Context, records ...export.Record) ([]Alert, error) {
+	alerts := engine.evaluate(records)
+	var errs []error
+	for _, alert := range alerts {
+		for _, notifier := range engine.notifiers {
+			if error := notifier.Notify(ctx, alert); error != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", alert.Rule, error))
+			}
+		}
+	}
+	return alerts, errors.Join(errs...)
+}
+
+// Retrieves the logs of the given domains every interval, and observes them
+// until ctx is done. Errors from retrieving logs or from notifiers are passed
+// to report, if it is not nil, and do not stop polling.
+func (engine *Engine) Poll(ctx context.Context, session *improvmx.Session, interval time.Duration, report func(error), domains ...string) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if error := engine.poll(ctx, session, domains); error != nil && report != nil {
+			report(error)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (engine *Engine) poll(ctx context.Context, session *improvmx.Session, domains []string) error {
+	if len(domains) == 0 {
+		list, error := session.Domains.List(ctx)
+		if error != nil {
+			return error
+		}
+		for _, domain := range list {
+			domains = append(domains, domain.Name)
+		}
+	}
+	var errs []error
+	for _, domain := range domains {
+		entries, error := session.Domains.Logs(ctx, domain)
+		if error != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", domain, error))
+			continue
+		}
+		if _, error := engine.Observe(ctx, export.Records(domain, entries...)...); error != nil {
+			errs = append(errs, error)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (engine *Engine) evaluate(records []export.Record) []Alert {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	now := engine.now()
+	var alerts []Alert
+	for index, rule := range engine.rules {
+		state := engine.states[index]
+		state.prune(now.Add(-rule.Window))
+		touched := make(map[string]struct{})
+		for _, record := range records {
+			key := entryKey(&record.Entry)
+			if _, ok := state.seen[key]; ok {
+				continue
+			}
+			if !rule.Query.MatchRecord(&record) {
+				continue
+			}
+			created, error := matchedAt(rule, &record)
+			if error != nil || created.Before(now.Add(-rule.Window)) {
+				continue
+			}
+			state.seen[key] = created
+			group := groupFields[rule.GroupBy](&record)
+			current, ok := state.groups[group]
+			if !ok {
+				current = &groupState{}
+				state.groups[group] = current
+			}
+			current.records = append(current.records, timedRecord{created, record})
+			touched[group] = struct{}{}
+		}
+		for _, group := range sortedKeys(touched) {
+			current := state.groups[group]
+			if len(current.records) <= rule.Threshold {
+				continue
+			}
+			if !current.lastAlert.IsZero() && now.Sub(current.lastAlert) < rule.Cooldown {
+				continue
+			}
+			current.lastAlert = now
+			alerts = append(alerts, current.alert(rule, group, now))
+		}
+	}
+	return alerts
+}
+
+func (group *groupState) alert(rule Rule, name string, now time.Time) Alert {
+	sort.SliceStable(group.records, func(i, j int) bool {
+		return group.records[i].created.Before(group.records[j].created)
+	})
+	alert := Alert{
+		Rule:  rule.Name,
+		Group: name,
+		Count: len(group.records),
+		Since: group.records[0].created,
+		Time:  now,
+	}
+	start := len(group.records) - maxSamples
+	if start < 0 {
+		start = 0
+	}
+	for _, record := range group.records[start:] {
+		alert.Records = append(alert.Records, record.record)
+	}
+	return alert
+}
+
+// Returns when the record matched the rule, which is the time of its latest
+// event matching the rule, or of its latest event if no single event does. A
+// message bouncing after retries thus matches when it bounced, rather than
+// when it was queued. Entries without events fall back to their creation time.
+func matchedAt(rule Rule, record *export.Record) (time.Time, error) {
+	var latest, matched time.Time
+	single := *record
+	for _, event := range record.Entry.Events {
+		created, error := event.Created()
+		if error != nil {
+			continue
+		}
+		if created.After(latest) {
+			latest = created
+		}
+		single.Entry.Events = []improvmx.LogEvent{event}
+		if created.After(matched) && rule.Query.MatchRecord(&single) {
+			matched = created
+		}
+	}
+	switch {
+	case !matched.IsZero():
+		return matched, nil
+	case !latest.IsZero():
+		return latest, nil
+	}
+	return record.Entry.Created()
+}
+
+// Forgets entries matched before cutoff.
+func (state *ruleState) prune(cutoff time.Time) {
+	for key, created := range state.seen {
+		if created.Before(cutoff) {
+			delete(state.seen, key)
+		}
+	}
+	for name, group := range state.groups {
+		kept := group.records[:0]
+		for _, record := range group.records {
+			if !record.created.Before(cutoff) {
+				kept = append(kept, record)
+			}
+		}
+		group.records = kept
+		if len(kept) == 0 && group.lastAlert.Before(cutoff) {
+			delete(state.groups, name)
+		}
+	}
+}
+
+var groupFields = map[string]func(*export.Record) string{
+	"":          func(*export.Record) string { return "" },
+	"domain":    func(record *export.Record) string { return strings.ToLower(record.Domain) },
+	"recipient": func(record *export.Record) string { return strings.ToLower(record.Entry.Recipient.Email) },
+	"sender":    func(record *export.Record) string { return strings.ToLower(record.Entry.Sender.Email) },
+	"forward":   func(record *export.Record) string { return strings.ToLower(record.Entry.Address.Email) },
+}
+
+func entryKey(entry *improvmx.LogEntry) string {
+	if entry.ID != "" {
+		return entry.ID
+	}
+	return fmt.Sprintf("%s@%s", entry.MessageID, entry.CreatedAt)
+}
+
+func sortedKeys(values map[string]struct{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,186 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"occult.work/improvmx"
+	"occult.work/improvmx/export"
+	"occult.work/improvmx/search"
+)
+
+var epoch = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func bounce(id, recipient string, at time.Time) export.Record {
+	return export.Record{Domain: "piedpiper.com", Entry: improvmx.LogEntry{
+		ID:        id,
+		CreatedAt: at.Format("2006-01-02 15:04:05-0700"),
+		Recipient: improvmx.Contact{Email: recipient},
+		Events: []improvmx.LogEvent{
+			{CreatedAt: at.Format("2006-01-02 15:04:05-0700"), Status: improvmx.HardBounce},
+		},
+	}}
+}
+
+func newEngine(t *testing.T, now *time.Time, rules ...Rule) (*Engine, *[]Alert) {
+	var received []Alert
+	engine, error := NewEngine(rules, NotifierFunc(func(ctx context.Context, alert Alert) error {
+		received = append(received, alert)
+		return nil
+	}))
+	assert.NoError(t, error)
+	engine.now = func() time.Time { return *now }
+	return engine, &received
+}
+
+func TestThresholdAndDeduplication(t *testing.T) {
+	assert := assert.New(t)
+	now := epoch
+	engine, received := newEngine(t, &now, Rule{
+		Name:      "bounces",
+		Query:     search.MustParse("event:hard-bounce recipient:richard@piedpiper.com"),
+		Threshold: 2,
+		Window:    10 * time.Minute,
+	})
+	records := []export.Record{
+		bounce("1", "richard@piedpiper.com", now.Add(-time.Minute)),
+		bounce("2", "richard@piedpiper.com", now.Add(-2*time.Minute)),
+		bounce("3", "monica@piedpiper.com", now.Add(-2*time.Minute)),
+	}
+	alerts, error := engine.Observe(context.Background(), records...)
+	assert.NoError(error)
+	assert.Empty(alerts)
+
+	alerts, error = engine.Observe(context.Background(), records...)
+	assert.NoError(error)
+	assert.Empty(alerts)
+
+	records = append(records, bounce("4", "richard@piedpiper.com", now))
+	alerts, error = engine.Observe(context.Background(), records...)
+	assert.NoError(error)
+	assert.Len(alerts, 1)
+	assert.Equal(3, alerts[0].Count)
+	assert.Equal("bounces", alerts[0].Rule)
+	assert.Len(*received, 1)
+	assert.Len(alerts[0].Records, 3)
+}
+
+func TestLateEvents(t *testing.T) {
+	assert := assert.New(t)
+	now := epoch
+	engine, _ := newEngine(t, &now, Rule{
+		Query:  search.MustParse("event:hard-bounce"),
+		Window: 10 * time.Minute,
+	})
+	// Queued outside of the window, but bounced within it after retries
+	record := bounce("1", "richard@piedpiper.com", now.Add(-2*time.Minute))
+	queued := now.Add(-time.Hour).Format("2006-01-02 15:04:05-0700")
+	record.Entry.CreatedAt = queued
+	record.Entry.Events = append([]improvmx.LogEvent{
+		{CreatedAt: queued, Status: improvmx.Queued},
+		{CreatedAt: now.Add(-30 * time.Minute).Format("2006-01-02 15:04:05-0700"), Status: improvmx.SoftBounce},
+	}, record.Entry.Events...)
+	alerts, error := engine.Observe(context.Background(), record)
+	assert.NoError(error)
+	if assert.Len(alerts, 1) {
+		assert.True(now.Add(-2 * time.Minute).Equal(alerts[0].Since))
+	}
+
+	// Forgotten once the bounce leaves the window
+	now = now.Add(7 * time.Minute)
+	engine.evaluate(nil)
+	assert.Len(engine.states[0].seen, 1)
+	now = now.Add(2 * time.Minute)
+	engine.evaluate(nil)
+	assert.Empty(engine.states[0].seen)
+}
+
+func TestCooldownAndWindow(t *testing.T) {
+	assert := assert.New(t)
+	now := epoch
+	engine, received := newEngine(t, &now, Rule{
+		Query:    search.MustParse("status:hard-bounce"),
+		Window:   10 * time.Minute,
+		Cooldown: 30 * time.Minute,
+	})
+	engine.Observe(context.Background(), bounce("1", "a@piedpiper.com", now))
+	assert.Len(*received, 1)
+	assert.Equal("rule 1", (*received)[0].Rule)
+
+	now = now.Add(5 * time.Minute)
+	engine.Observe(context.Background(), bounce("2", "a@piedpiper.com", now))
+	assert.Len(*received, 1)
+
+	now = now.Add(30 * time.Minute)
+	engine.Observe(context.Background(), bounce("old", "a@piedpiper.com", now.Add(-time.Hour)))
+	assert.Len(*received, 1)
+	engine.Observe(context.Background(), bounce("3", "a@piedpiper.com", now))
+	assert.Len(*received, 2)
+	assert.Equal(1, (*received)[1].Count)
+}
+
+func TestGroupBy(t *testing.T) {
+	assert := assert.New(t)
+	now := epoch
+	engine, _ := newEngine(t, &now, Rule{
+		Query:     search.MustParse("status:hard-bounce"),
+		Threshold: 1,
+		GroupBy:   "recipient",
+	})
+	alerts, _ := engine.Observe(context.Background(),
+		bounce("1", "a@piedpiper.com", now),
+		bounce("2", "b@piedpiper.com", now),
+		bounce("3", "b@piedpiper.com", now),
+	)
+	assert.Len(alerts, 1)
+	assert.Equal("b@piedpiper.com", alerts[0].Group)
+	assert.Contains(alerts[0].String(), "[b@piedpiper.com]")
+
+	_, error := NewEngine([]Rule{{GroupBy: "planet"}})
+	assert.Error(error)
+	_, error = NewEngine([]Rule{{Threshold: -1}})
+	assert.Error(error)
+}
+
+func TestNotifierErrors(t *testing.T) {
+	assert := assert.New(t)
+	failing := NotifierFunc(func(context.Context, Alert) error { return fmt.Errorf("unreachable") })
+	engine, error := NewEngine([]Rule{{Name: "any"}}, failing, failing)
+	assert.NoError(error)
+	engine.now = func() time.Time { return epoch }
+	alerts, error := engine.Observe(context.Background(), bounce("1", "a@piedpiper.com", epoch))
+	assert.Len(alerts, 1)
+	assert.EqualError(error, "any: unreachable\nany: unreachable")
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	assert := assert.New(t)
+	var received Alert
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		assert.Equal("Bearer token", request.Header.Get("Authorization"))
+		assert.NoError(json.NewDecoder(request.Body).Decode(&received))
+		if received.Rule == "fail" {
+			writer.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	notifier := &WebhookNotifier{URL: server.URL, Header: http.Header{"Authorization": {"Bearer token"}}}
+	assert.NoError(notifier.Notify(context.Background(), Alert{Rule: "bounces", Count: 3}))
+	assert.Equal("bounces", received.Rule)
+	assert.Error(notifier.Notify(context.Background(), Alert{Rule: "fail"}))
+}
+
+func TestWriterNotifier(t *testing.T) {
+	assert := assert.New(t)
+	buffer := &bytes.Buffer{}
+	notifier := &WriterNotifier{Writer: buffer}
+	assert.NoError(notifier.Notify(context.Background(), Alert{Rule: "bounces", Count: 3, Since: epoch, Time: epoch}))
+	assert.Equal("2024-01-01T12:00:00Z bounces: 3 matching entries since 2024-01-01T12:00:00Z\n", buffer.String())
+}
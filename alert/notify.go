@@ -0,0 +1,105 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Posts each alert as a JSON object to URL.
+type WebhookNotifier struct {
+	URL string
+	// Defaults to http.DefaultClient if nil
+	Client *http.Client
+	// Additional headers set on every request, such as Authorization
+	Header http.Header
+}
+
+// Sends each alert as a plain text email through an SMTP server.
+type SMTPNotifier struct {
+	// The host:port of the SMTP server
+	Address string
+	// May be nil if the server does not require authentication
+	Auth smtp.Auth
+	From string
+	To   []string
+}
+
+// Writes each alert as a single line of text to Writer, such as os.Stdout.
+type WriterNotifier struct {
+	Writer io.Writer
+	mutex  sync.Mutex
+}
+
+// Calls the function for each alert.
+type NotifierFunc func(ctx context.Context, alert Alert) error
+
+func (notifier *WebhookNotifier) Notify(ctx context.Context, alert Alert) error {
+	body, error := json.Marshal(alert)
+	if error != nil {
+		return error
+	}
+	request, error := http.NewRequestWithContext(ctx, http.MethodPost, notifier.URL, bytes.NewReader(body))
+	if error != nil {
+		return error
+	}
+	for key, values := range notifier.Header {
+		request.Header[key] = values
+	}
+	request.Header.Set("Content-Type", "application/json")
+	client := notifier.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, error := client.Do(request)
+	if error != nil {
+		return error
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", response.Status)
+	}
+	return nil
+}
+
+func (notifier *SMTPNotifier) Notify(ctx context.Context, alert Alert) error {
+	if error := ctx.Err(); error != nil {
+		return error
+	}
+	var message strings.Builder
+	fmt.Fprintf(&message, "From: %s\r\n", notifier.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(notifier.To, ", "))
+	fmt.Fprintf(&message, "Subject: [improvmx] %s\r\n", alert.Rule)
+	fmt.Fprintf(&message, "Date: %s\r\n", alert.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&message, "%s\r\n\r\n", alert)
+	for _, record := range alert.Records {
+		entry := record.Entry
+		fmt.Fprintf(&message, "%s %s %s -> %s: %s\r\n",
+			entry.CreatedAt,
+			entry.FinalStatus(),
+			entry.Sender.Email,
+			entry.Recipient.Email,
+			entry.Subject)
+	}
+	return smtp.SendMail(notifier.Address, notifier.Auth, notifier.From, notifier.To, []byte(message.String()))
+}
+
+func (notifier *WriterNotifier) Notify(ctx context.Context, alert Alert) error {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	_, error := fmt.Fprintf(notifier.Writer, "%s %s\n", alert.Time.Format(time.RFC3339), alert)
+	return error
+}
+
+func (function NotifierFunc) Notify(ctx context.Context, alert Alert) error {
+	return function(ctx, alert)
+}
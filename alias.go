@@ -2,7 +2,10 @@ package improvmx
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strconv"
+	"strings"
 
 	"occult.work/doze"
 )
@@ -18,6 +21,23 @@ type Alias struct {
 	ID      int64  `json:"id"`
 }
 
+// Returns the recipients of the alias. See SplitRecipients.
+func (alias Alias) Recipients() []string {
+	return SplitRecipients(alias.Address)
+}
+
+// Splits a forward address into its comma separated recipients, trimming
+// whitespace and dropping empty entries.
+func SplitRecipients(address string) []string {
+	var recipients []string
+	for _, recipient := range strings.Split(address, ",") {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			recipients = append(recipients, recipient)
+		}
+	}
+	return recipients
+}
+
 // Returns a slice of Alias for the given domain.
 //
 // If multiple *ListOption are passed, only the first one is used.
@@ -137,6 +157,60 @@ func (endpoint *AliasEndpoint) Delete(ctx context.Context, domain, alias string)
 	return nil
 }
 
+// Renames an alias of the given domain. As the ImprovMX REST API cannot rename
+// aliases, the new alias is created with the same address first, then read back
+// to verify it, and only then is the old alias deleted. If any step fails, the
+// new alias is deleted again so that the old alias remains the only one. Should
+// deleting the old alias fail, it is read again, and the new alias is kept if
+// the old one is gone regardless.
+func (endpoint *AliasEndpoint) Rename(ctx context.Context, domain, old, new string) (*Alias, error) {
+	return endpoint.relocate(ctx, domain, old, domain, new)
+}
+
+// Moves an alias between domains, keeping its name and address. See Rename for
+// how failures are rolled back.
+func (endpoint *AliasEndpoint) Move(ctx context.Context, fromDomain, toDomain, name string) (*Alias, error) {
+	return endpoint.relocate(ctx, fromDomain, name, toDomain, name)
+}
+
+func (endpoint *AliasEndpoint) relocate(ctx context.Context, fromDomain, fromName, toDomain, toName string) (*Alias, error) {
+	if fromDomain == toDomain && fromName == toName {
+		return endpoint.Read(ctx, fromDomain, fromName)
+	}
+	source, error := endpoint.Read(ctx, fromDomain, fromName)
+	if error != nil {
+		return nil, error
+	}
+	if _, error := endpoint.Create(ctx, toDomain, toName, source.Address); error != nil {
+		return nil, fmt.Errorf("failed to create %s@%s: %w", toName, toDomain, error)
+	}
+	created, error := endpoint.Read(ctx, toDomain, toName)
+	if error == nil && normalizeAddress(created.Address) != normalizeAddress(source.Address) {
+		error = fmt.Errorf("%s@%s forwards to %q instead of %q", toName, toDomain, created.Address, source.Address)
+	}
+	if error == nil {
+		if error = endpoint.Delete(ctx, fromDomain, fromName); error == nil {
+			return created, nil
+		}
+		error = fmt.Errorf("failed to delete %s@%s: %w", fromName, fromDomain, error)
+		// The delete may have been applied even though its response was lost,
+		// in which case rolling back would leave neither alias behind.
+		_, lookup := endpoint.Read(context.WithoutCancel(ctx), fromDomain, fromName)
+		if isNotFound(lookup) {
+			return created, nil
+		}
+		if lookup != nil {
+			return nil, errors.Join(error, fmt.Errorf("failed to read %s@%s: %w", fromName, fromDomain, lookup))
+		}
+	}
+	// Roll back even if the context was canceled midway, so the new alias is
+	// not left behind.
+	if rollback := endpoint.Delete(context.WithoutCancel(ctx), toDomain, toName); rollback != nil {
+		return nil, errors.Join(error, fmt.Errorf("failed to roll back %s@%s: %w", toName, toDomain, rollback))
+	}
+	return nil, error
+}
+
 func (endpoint *AliasEndpoint) inner() *doze.Client {
 	return (*doze.Client)(endpoint)
 }
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"occult.work/doze/test"
 )
 
@@ -153,3 +154,62 @@ func (suite *AliasErrorTestSuite) TestUpdate() {
 	suite.Require().Error(error)
 	suite.Require().Empty(alias)
 }
+
+func TestAliasRename(t *testing.T) {
+	assert := assert.New(t)
+	account, session := newFakeAccount(t)
+	account.addDomain("example.com", "richard=richard@example.com", "jared=jared@example.com")
+	ctx := context.Background()
+
+	alias, error := session.Aliases.Rename(ctx, "example.com", "richard", "ceo")
+	assert.NoError(error)
+	assert.Equal("ceo", alias.Name)
+	assert.Equal([]string{"ceo=richard@example.com", "jared=jared@example.com"}, account.aliases("example.com"))
+
+	_, error = session.Aliases.Rename(ctx, "example.com", "ceo", "jared")
+	assert.Error(error)
+	assert.Equal([]string{"ceo=richard@example.com", "jared=jared@example.com"}, account.aliases("example.com"))
+
+	account.fail(http.MethodDelete, "/domains/example.com/aliases/ceo/", http.StatusInternalServerError)
+	_, error = session.Domain("example.com").Aliases().Rename(ctx, "ceo", "richard")
+	assert.ErrorContains(error, "failed to delete ceo@example.com")
+	assert.Equal([]string{"ceo=richard@example.com", "jared=jared@example.com"}, account.aliases("example.com"))
+}
+
+func TestAliasMove(t *testing.T) {
+	assert := assert.New(t)
+	account, session := newFakeAccount(t)
+	account.addDomain("example.com", "richard=richard@example.com")
+	account.addDomain("piedpiper.com")
+	ctx := context.Background()
+
+	account.fail(http.MethodGet, "/domains/piedpiper.com/aliases/richard/", http.StatusInternalServerError)
+	account.fail(http.MethodDelete, "/domains/piedpiper.com/aliases/richard/", http.StatusInternalServerError)
+	_, error := session.Aliases.Move(ctx, "example.com", "piedpiper.com", "richard")
+	assert.ErrorContains(error, "failed to roll back richard@piedpiper.com")
+	assert.Equal([]string{"richard=richard@example.com"}, account.aliases("example.com"))
+	assert.Equal([]string{"richard=richard@example.com"}, account.aliases("piedpiper.com"))
+	assert.NoError(session.Aliases.Delete(ctx, "piedpiper.com", "richard"))
+
+	alias, error := session.Domain("example.com").Aliases().Move(ctx, "piedpiper.com", "richard")
+	assert.NoError(error)
+	assert.Equal("richard@example.com", alias.Address)
+	assert.Empty(account.aliases("example.com"))
+	assert.Equal([]string{"richard=richard@example.com"}, account.aliases("piedpiper.com"))
+
+	// The delete is applied, but its response is lost
+	account.lose(http.MethodDelete, "/domains/piedpiper.com/aliases/richard/", http.StatusBadGateway)
+	alias, error = session.Aliases.Move(ctx, "piedpiper.com", "example.com", "richard")
+	assert.NoError(error)
+	assert.Equal("richard@example.com", alias.Address)
+	assert.Equal([]string{"richard=richard@example.com"}, account.aliases("example.com"))
+	assert.Empty(account.aliases("piedpiper.com"))
+}
+
+func TestSplitRecipients(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{"richard@example.com", "jared@example.com"}, SplitRecipients(" richard@example.com,, jared@example.com "))
+	assert.Empty(SplitRecipients(" , "))
+	alias := Alias{Address: "monica@example.com"}
+	assert.Equal([]string{"monica@example.com"}, alias.Recipients())
+}
@@ -0,0 +1,221 @@
+// Package analytics aggregates ImprovMX mail logs into per domain, per alias,
+// and per sender statistics, and renders them as text, Markdown, or JSON.
+package analytics
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"occult.work/improvmx"
+)
+
+// Aggregates improvmx.LogEntry values into statistics. The zero value is not
+// usable, use NewAggregator instead.
+type Aggregator struct {
+	total   *bucket
+	domains map[string]*bucket
+	aliases map[string]*bucket
+	senders map[string]*bucket
+	seen    map[string]struct{}
+}
+
+// Statistics for a single domain, alias, or sender.
+type Summary struct {
+	Key         string                         `json:"key"`
+	Messages    int                            `json:"messages"`
+	Statuses    map[improvmx.MessageStatus]int `json:"statuses"`
+	Failures    int                            `json:"failures"`
+	FailureRate float64                        `json:"failure_rate"`
+	Latency     Latency                        `json:"latency"`
+}
+
+// Queue to delivery latency percentiles. Only delivered messages whose
+// Timeline could be computed are taken into account. Like any time.Duration,
+// latencies are encoded to JSON as integer nanoseconds.
+type Latency struct {
+	Samples int           `json:"samples"`
+	P50     time.Duration `json:"p50"`
+	P90     time.Duration `json:"p90"`
+	P99     time.Duration `json:"p99"`
+	Max     time.Duration `json:"max"`
+}
+
+// The result of an Aggregator. Domains, Aliases, and Senders are sorted by
+// descending message count.
+type Report struct {
+	Total   Summary   `json:"total"`
+	Domains []Summary `json:"domains"`
+	Aliases []Summary `json:"aliases"`
+	Senders []Summary `json:"senders"`
+}
+
+type bucket struct {
+	messages  int
+	failures  int
+	statuses  map[improvmx.MessageStatus]int
+	latencies []time.Duration
+}
+
+func NewAggregator() *Aggregator {
+	return &Aggregator{
+		total:   newBucket(),
+		domains: make(map[string]*bucket),
+		aliases: make(map[string]*bucket),
+		senders: make(map[string]*bucket),
+		seen:    make(map[string]struct{}),
+	}
+}
+
+// Retrieves the logs of the given domains and returns an Aggregator holding
+// them. If no domains are given, the logs of every domain in the account are
+// retrieved.
+func Collect(ctx context.Context, session *improvmx.Session, domains ...string) (*Aggregator, error) {
+	if len(domains) == 0 {
+		list, error := session.Domains.List(ctx)
+		if error != nil {
+			return nil, error
+		}
+		for _, domain := range list {
+			domains = append(domains, domain.Name)
+		}
+	}
+	aggregator := NewAggregator()
+	for _, domain := range domains {
+		entries, error := session.Domains.Logs(ctx, domain)
+		if error != nil {
+			return nil, error
+		}
+		aggregator.Add(domain, entries...)
+	}
+	return aggregator, nil
+}
+
+// Adds the entries to the aggregator under the given domain. If domain is
+// empty, it is derived from the recipient address of each entry. Entries
+// whose ID was already added are ignored.
+func (aggregator *Aggregator) Add(domain string, entries ...improvmx.LogEntry) {
+	for index := range entries {
+		entry := &entries[index]
+		if entry.ID != "" {
+			if _, ok := aggregator.seen[entry.ID]; ok {
+				continue
+			}
+			aggregator.seen[entry.ID] = struct{}{}
+		}
+		name := domain
+		if name == "" {
+			name = domainOf(entry.Recipient.Email)
+		}
+		aggregator.total.add(entry)
+		lookup(aggregator.domains, name).add(entry)
+		lookup(aggregator.aliases, strings.ToLower(entry.Recipient.Email)).add(entry)
+		lookup(aggregator.senders, strings.ToLower(entry.Sender.Email)).add(entry)
+	}
+}
+
+// Returns a Report of everything added so far. If top is greater than zero,
+// the Aliases and Senders of the report are truncated to that many entries.
+func (aggregator *Aggregator) Report(top int) *Report {
+	return &Report{
+		Total:   aggregator.total.summary("total"),
+		Domains: summarize(aggregator.domains, 0),
+		Aliases: summarize(aggregator.aliases, top),
+		Senders: summarize(aggregator.senders, top),
+	}
+}
+
+func newBucket() *bucket {
+	return &bucket{statuses: make(map[improvmx.MessageStatus]int)}
+}
+
+func lookup(buckets map[string]*bucket, key string) *bucket {
+	if value, ok := buckets[key]; ok {
+		return value
+	}
+	value := newBucket()
+	buckets[key] = value
+	return value
+}
+
+func (bucket *bucket) add(entry *improvmx.LogEntry) {
+	bucket.messages++
+	timeline, error := entry.Timeline()
+	status := entry.FinalStatus()
+	if error == nil {
+		status = timeline.Status
+	}
+	bucket.statuses[status]++
+	if status.IsFailure() {
+		bucket.failures++
+	}
+	if error == nil && status == improvmx.Delivered && timeline.Latency > 0 {
+		bucket.latencies = append(bucket.latencies, timeline.Latency)
+	}
+}
+
+func (bucket *bucket) summary(key string) Summary {
+	summary := Summary{
+		Key:      key,
+		Messages: bucket.messages,
+		Statuses: make(map[improvmx.MessageStatus]int, len(bucket.statuses)),
+		Failures: bucket.failures,
+		Latency:  percentiles(bucket.latencies),
+	}
+	for status, count := range bucket.statuses {
+		summary.Statuses[status] = count
+	}
+	if bucket.messages > 0 {
+		summary.FailureRate = float64(bucket.failures) / float64(bucket.messages)
+	}
+	return summary
+}
+
+func summarize(buckets map[string]*bucket, top int) []Summary {
+	summaries := make([]Summary, 0, len(buckets))
+	for key, bucket := range buckets {
+		summaries = append(summaries, bucket.summary(key))
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Messages != summaries[j].Messages {
+			return summaries[i].Messages > summaries[j].Messages
+		}
+		return summaries[i].Key < summaries[j].Key
+	})
+	if top > 0 && len(summaries) > top {
+		summaries = summaries[:top]
+	}
+	return summaries
+}
+
+// Nearest-rank percentiles of the given samples.
+func percentiles(samples []time.Duration) Latency {
+	if len(samples) == 0 {
+		return Latency{}
+	}
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := func(percentile int) time.Duration {
+		index := (percentile*len(sorted)+99)/100 - 1
+		if index < 0 {
+			index = 0
+		}
+		return sorted[index]
+	}
+	return Latency{
+		Samples: len(sorted),
+		P50:     rank(50),
+		P90:     rank(90),
+		P99:     rank(99),
+		Max:     sorted[len(sorted)-1],
+	}
+}
+
+func domainOf(address string) string {
+	if index := strings.LastIndex(address, "@"); index >= 0 {
+		return strings.ToLower(address[index+1:])
+	}
+	return ""
+}
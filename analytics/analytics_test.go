@@ -0,0 +1,109 @@
+package analytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"occult.work/improvmx"
+)
+
+func loadLogs(t *testing.T) []improvmx.LogEntry {
+	data, error := os.ReadFile("../testdata/alias/logs.json")
+	assert.NoError(t, error)
+	response := struct{ Logs []improvmx.LogEntry }{}
+	assert.NoError(t, json.Unmarshal(data, &response))
+	return response.Logs
+}
+
+func TestAggregator(t *testing.T) {
+	assert := assert.New(t)
+	aggregator := NewAggregator()
+	logs := loadLogs(t)
+	aggregator.Add("piedpiper.com", logs...)
+	aggregator.Add("piedpiper.com", logs...)
+	aggregator.Add("", improvmx.LogEntry{
+		ID:        "bounced",
+		Recipient: improvmx.Contact{Email: "Jared@Hooli.XYZ"},
+		Sender:    improvmx.Contact{Email: "gavin@hooli.com"},
+		Events: []improvmx.LogEvent{
+			{CreatedAt: "2020-01-25 12:00:00+0000", Status: improvmx.Queued},
+			{CreatedAt: "2020-01-25 12:00:05+0000", Status: improvmx.HardBounce},
+		},
+	})
+	report := aggregator.Report(1)
+	assert.Equal(3, report.Total.Messages)
+	assert.Equal(2, report.Total.Failures)
+	assert.InDelta(2.0/3.0, report.Total.FailureRate, 0.001)
+	assert.Equal(1, report.Total.Statuses[improvmx.Delivered])
+	assert.Equal(time.Second, report.Total.Latency.P50)
+	assert.Equal(1, report.Total.Latency.Samples)
+
+	assert.Len(report.Domains, 2)
+	assert.Equal("piedpiper.com", report.Domains[0].Key)
+	assert.Equal("hooli.xyz", report.Domains[1].Key)
+	assert.Len(report.Senders, 1)
+	assert.Equal("gavin@hooli.com", report.Senders[0].Key)
+	assert.Equal(2, report.Senders[0].Messages)
+	assert.Len(report.Aliases, 1)
+	assert.Equal("richard@piedpiper.com", report.Aliases[0].Key)
+}
+
+func TestAggregatorUnparsableEvents(t *testing.T) {
+	assert := assert.New(t)
+	aggregator := NewAggregator()
+	aggregator.Add("piedpiper.com", improvmx.LogEntry{
+		ID:        "unparsable",
+		Recipient: improvmx.Contact{Email: "richard@piedpiper.com"},
+		Events: []improvmx.LogEvent{
+			{CreatedAt: "yesterday", Status: improvmx.Queued},
+			{CreatedAt: "today", Status: improvmx.HardBounce},
+		},
+	})
+	report := aggregator.Report(0)
+	assert.Equal(1, report.Total.Statuses[improvmx.HardBounce])
+	assert.Equal(1, report.Total.Failures)
+	assert.Equal(1.0, report.Total.FailureRate)
+	assert.Zero(report.Total.Latency.Samples)
+}
+
+func TestPercentiles(t *testing.T) {
+	assert := assert.New(t)
+	samples := make([]time.Duration, 0, 100)
+	for index := 100; index > 0; index-- {
+		samples = append(samples, time.Duration(index)*time.Second)
+	}
+	latency := percentiles(samples)
+	assert.Equal(50*time.Second, latency.P50)
+	assert.Equal(90*time.Second, latency.P90)
+	assert.Equal(99*time.Second, latency.P99)
+	assert.Equal(100*time.Second, latency.Max)
+	assert.Equal(Latency{}, percentiles(nil))
+}
+
+func TestRender(t *testing.T) {
+	assert := assert.New(t)
+	aggregator := NewAggregator()
+	aggregator.Add("piedpiper.com", loadLogs(t)...)
+	report := aggregator.Report(0)
+
+	for _, format := range []Format{Text, Markdown, JSON} {
+		buffer := &bytes.Buffer{}
+		assert.NoError(report.Render(buffer, format))
+		assert.Contains(buffer.String(), "spam@hooli.com")
+	}
+	buffer := &bytes.Buffer{}
+	assert.NoError(report.Render(buffer, Markdown))
+	assert.Contains(buffer.String(), "## Senders")
+	assert.Contains(buffer.String(), "DELIVERED=1 REFUSED=1")
+	assert.Error(report.Render(buffer, Format("yaml")))
+
+	format, error := ParseFormat("md")
+	assert.NoError(error)
+	assert.Equal(Markdown, format)
+	_, error = ParseFormat("yaml")
+	assert.Error(error)
+}
@@ -0,0 +1,148 @@
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"occult.work/improvmx"
+)
+
+const (
+	// Renders the report as aligned, plain text tables.
+	Text Format = "text"
+
+	// Renders the report as GitHub flavored Markdown tables.
+	Markdown Format = "markdown"
+
+	// Renders the report as indented JSON.
+	JSON Format = "json"
+)
+
+// The output format used by Report.Render
+type Format string
+
+// Parses the given string into a Format.
+func ParseFormat(value string) (Format, error) {
+	switch format := Format(strings.ToLower(value)); format {
+	case Text, Markdown, JSON:
+		return format, nil
+	case "md":
+		return Markdown, nil
+	case "txt":
+		return Text, nil
+	}
+	return "", fmt.Errorf("unknown report format: %q", value)
+}
+
+// Writes the report to writer in the given format.
+func (report *Report) Render(writer io.Writer, format Format) error {
+	switch format {
+	case Text:
+		return report.renderText(writer)
+	case Markdown:
+		return report.renderMarkdown(writer)
+	case JSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return fmt.Errorf("unknown report format: %q", format)
+}
+
+func (report *Report) sections() []struct {
+	title     string
+	summaries []Summary
+} {
+	return []struct {
+		title     string
+		summaries []Summary
+	}{
+		{"Total", []Summary{report.Total}},
+		{"Domains", report.Domains},
+		{"Aliases", report.Aliases},
+		{"Senders", report.Senders},
+	}
+}
+
+func (report *Report) renderText(writer io.Writer) error {
+	for index, section := range report.sections() {
+		if index > 0 {
+			fmt.Fprintln(writer)
+		}
+		fmt.Fprintf(writer, "%s\n", section.title)
+		table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, strings.Join(columns, "\t"))
+		for _, summary := range section.summaries {
+			fmt.Fprintln(table, strings.Join(row(summary), "\t"))
+		}
+		if error := table.Flush(); error != nil {
+			return error
+		}
+	}
+	return nil
+}
+
+func (report *Report) renderMarkdown(writer io.Writer) error {
+	for index, section := range report.sections() {
+		if index > 0 {
+			fmt.Fprintln(writer)
+		}
+		fmt.Fprintf(writer, "## %s\n\n", section.title)
+		fmt.Fprintf(writer, "| %s |\n", strings.Join(columns, " | "))
+		fmt.Fprintf(writer, "|%s\n", strings.Repeat(" --- |", len(columns)))
+		for _, summary := range section.summaries {
+			cells := row(summary)
+			for cell := range cells {
+				cells[cell] = strings.ReplaceAll(cells[cell], "|", `\|`)
+			}
+			if _, error := fmt.Fprintf(writer, "| %s |\n", strings.Join(cells, " | ")); error != nil {
+				return error
+			}
+		}
+	}
+	return nil
+}
+
+var columns = []string{"Key", "Messages", "Failures", "Failure Rate", "Statuses", "P50", "P90", "P99"}
+
+func row(summary Summary) []string {
+	return []string{
+		summary.Key,
+		fmt.Sprint(summary.Messages),
+		fmt.Sprint(summary.Failures),
+		fmt.Sprintf("%.1f%%", summary.FailureRate*100),
+		formatStatuses(summary.Statuses),
+		formatDuration(summary.Latency.P50),
+		formatDuration(summary.Latency.P90),
+		formatDuration(summary.Latency.P99),
+	}
+}
+
+func formatStatuses(statuses map[improvmx.MessageStatus]int) string {
+	keys := make([]string, 0, len(statuses))
+	for status := range statuses {
+		keys = append(keys, string(status))
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		name := key
+		if name == "" {
+			name = "NONE"
+		}
+		parts = append(parts, fmt.Sprintf("%s=%d", name, statuses[improvmx.MessageStatus(key)]))
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatDuration(duration time.Duration) string {
+	if duration == 0 {
+		return "-"
+	}
+	return duration.String()
+}
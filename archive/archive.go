@@ -0,0 +1,335 @@
+// Package archive stores ImprovMX log entries in an append-only local
+// directory, so that they outlive the retention period of the ImprovMX REST
+// API and can be queried offline.
+//
+// Entries are stored as JSON Lines, one file per day (e.g., 2020-01-25.jsonl)
+// based on the creation time of each entry. Entries whose creation time
+// cannot be parsed are stored in undated.jsonl. An entry whose status or
+// events changed since it was stored is appended again, and supersedes the
+// earlier version.
+package archive
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"occult.work/improvmx"
+	"occult.work/improvmx/export"
+)
+
+const (
+	dayLayout   = "2006-01-02"
+	extension   = ".jsonl"
+	undatedName = "undated"
+)
+
+// A directory of dated JSON Lines files. Entries are only ever appended, and
+// an entry is only written again if its status or events changed.
+type Archive struct {
+	path  string
+	mutex sync.Mutex
+	// The state of the latest stored version of each entry, by key
+	seen map[string]string
+}
+
+// Restricts the records returned by Archive.Query. A zero From or To leaves
+// that side of the range unbounded.
+type Query struct {
+	From   time.Time
+	To     time.Time
+	Domain string
+	Filter func(*export.Record) bool
+}
+
+// Opens the archive at path, creating the directory if it does not exist.
+func Open(path string) (*Archive, error) {
+	if error := os.MkdirAll(path, 0o755); error != nil {
+		return nil, error
+	}
+	archive := &Archive{path: path, seen: make(map[string]string)}
+	if error := archive.load(); error != nil {
+		return nil, error
+	}
+	return archive, nil
+}
+
+// Returns the directory the archive is stored in.
+func (archive *Archive) Path() string {
+	return archive.path
+}
+
+// Returns the number of distinct entries stored in the archive.
+func (archive *Archive) Len() int {
+	archive.mutex.Lock()
+	defer archive.mutex.Unlock()
+	return len(archive.seen)
+}
+
+// Returns true if the given entry is stored in the archive.
+func (archive *Archive) Contains(entry *improvmx.LogEntry) bool {
+	archive.mutex.Lock()
+	defer archive.mutex.Unlock()
+	_, ok := archive.seen[entryKey(entry)]
+	return ok
+}
+
+// Appends every record whose entry is not yet stored, or whose status or
+// events changed since it was stored, and returns the number of records
+// written. Entries are identified by their ID, or by their message ID and
+// creation time if the ImprovMX REST API did not provide an ID.
+func (archive *Archive) Append(records ...export.Record) (int, error) {
+	archive.mutex.Lock()
+	defer archive.mutex.Unlock()
+	groups := make(map[string][]export.Record)
+	pending := make(map[string]string)
+	for _, record := range records {
+		key, state := entryKey(&record.Entry), entryState(&record.Entry)
+		previous, ok := pending[key]
+		if !ok {
+			previous, ok = archive.seen[key]
+		}
+		if ok && previous == state {
+			continue
+		}
+		pending[key] = state
+		name := fileName(&record.Entry)
+		groups[name] = append(groups[name], record)
+	}
+	written := 0
+	for name, group := range groups {
+		if error := archive.appendFile(name, group); error != nil {
+			return written, error
+		}
+		for index := range group {
+			key := entryKey(&group[index].Entry)
+			archive.seen[key] = pending[key]
+		}
+		written += len(group)
+	}
+	return written, nil
+}
+
+// Retrieves the logs of the given domains and appends any new entries. If no
+// domains are given, the logs of every domain in the account are retrieved.
+// Returns the number of entries added.
+func (archive *Archive) Sync(ctx context.Context, session *improvmx.Session, domains ...string) (int, error) {
+	if len(domains) == 0 {
+		list, error := session.Domains.List(ctx)
+		if error != nil {
+			return 0, error
+		}
+		for _, domain := range list {
+			domains = append(domains, domain.Name)
+		}
+	}
+	total := 0
+	for _, domain := range domains {
+		entries, error := session.Domains.Logs(ctx, domain)
+		if error != nil {
+			return total, error
+		}
+		added, error := archive.Append(export.Records(domain, entries...)...)
+		total += added
+		if error != nil {
+			return total, error
+		}
+	}
+	return total, nil
+}
+
+// Returns the latest version of every stored record matching query, ordered
+// by file and then by the order in which they were first appended.
+func (archive *Archive) Query(query Query) ([]export.Record, error) {
+	var records []export.Record
+	error := archive.Each(query, func(record *export.Record) error {
+		records = append(records, *record)
+		return nil
+	})
+	return records, error
+}
+
+// Calls function for the latest version of every stored record matching
+// query. Iteration stops at the first error returned by function.
+func (archive *Archive) Each(query Query, function func(*export.Record) error) error {
+	visit := func(record *export.Record) error {
+		if !query.matches(record) {
+			return nil
+		}
+		return function(record)
+	}
+	archive.mutex.Lock()
+	files, error := archive.files()
+	archive.mutex.Unlock()
+	if error != nil {
+		return error
+	}
+	for _, file := range files {
+		if !query.includesFile(file) {
+			continue
+		}
+		if error := readLatest(file, visit); error != nil {
+			return error
+		}
+	}
+	return nil
+}
+
+// Populates the set of known entry IDs from the files on disk.
+func (archive *Archive) load() error {
+	remember := func(record *export.Record) error {
+		archive.seen[entryKey(&record.Entry)] = entryState(&record.Entry)
+		return nil
+	}
+	files, error := archive.files()
+	if error != nil {
+		return error
+	}
+	for _, file := range files {
+		if error := readFile(file, remember); error != nil {
+			return error
+		}
+	}
+	return nil
+}
+
+func (archive *Archive) appendFile(name string, records []export.Record) error {
+	path := filepath.Join(archive.path, name+extension)
+	file, error := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if error != nil {
+		return error
+	}
+	writer := bufio.NewWriter(file)
+	if error := export.WriteAll(export.NewJSONLinesWriter(writer), records...); error != nil {
+		file.Close()
+		return error
+	}
+	if error := writer.Flush(); error != nil {
+		file.Close()
+		return error
+	}
+	return file.Close()
+}
+
+func (archive *Archive) files() ([]string, error) {
+	matches, error := filepath.Glob(filepath.Join(archive.path, "*"+extension))
+	if error != nil {
+		return nil, error
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func (query Query) includesFile(path string) bool {
+	name := strings.TrimSuffix(filepath.Base(path), extension)
+	day, error := time.Parse(dayLayout, name)
+	if error != nil {
+		return query.From.IsZero() && query.To.IsZero()
+	}
+	if !query.From.IsZero() && day.Add(24*time.Hour).Before(query.From) {
+		return false
+	}
+	if !query.To.IsZero() && day.After(query.To) {
+		return false
+	}
+	return true
+}
+
+func (query Query) matches(record *export.Record) bool {
+	if query.Domain != "" && !strings.EqualFold(query.Domain, record.Domain) {
+		return false
+	}
+	if !query.From.IsZero() || !query.To.IsZero() {
+		created, error := record.Entry.Created()
+		if error != nil {
+			return false
+		}
+		if !query.From.IsZero() && created.Before(query.From) {
+			return false
+		}
+		if !query.To.IsZero() && created.After(query.To) {
+			return false
+		}
+	}
+	return query.Filter == nil || query.Filter(record)
+}
+
+func entryKey(entry *improvmx.LogEntry) string {
+	if entry.ID != "" {
+		return entry.ID
+	}
+	return fmt.Sprintf("%s@%s", entry.MessageID, entry.CreatedAt)
+}
+
+// Returns what identifies a version of the entry, which changes when
+// ImprovMX records a new delivery attempt.
+func entryState(entry *improvmx.LogEntry) string {
+	return fmt.Sprintf("%s/%d", entry.FinalStatus(), len(entry.Events))
+}
+
+func fileName(entry *improvmx.LogEntry) string {
+	created, error := entry.Created()
+	if error != nil {
+		return undatedName
+	}
+	return created.UTC().Format(dayLayout)
+}
+
+func readFile(path string, function func(*export.Record) error) error {
+	file, error := os.Open(path)
+	if error != nil {
+		return error
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		record := &export.Record{}
+		if error := json.Unmarshal(scanner.Bytes(), record); error != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, error)
+		}
+		if error := function(record); error != nil {
+			return error
+		}
+	}
+	return scanner.Err()
+}
+
+// Calls function for the last record of each entry in the file, in the order
+// in which the entries were first appended. As every version of an entry is
+// stored in the same file, the last record is its latest version.
+func readLatest(path string, function func(*export.Record) error) error {
+	var records []export.Record
+	positions := make(map[string]int)
+	error := readFile(path, func(record *export.Record) error {
+		key := entryKey(&record.Entry)
+		if position, ok := positions[key]; ok {
+			records[position] = *record
+			return nil
+		}
+		positions[key] = len(records)
+		records = append(records, *record)
+		return nil
+	})
+	if error != nil {
+		return error
+	}
+	for index := range records {
+		if error := function(&records[index]); error != nil {
+			return error
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package archive
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"occult.work/improvmx"
+	"occult.work/improvmx/export"
+)
+
+func newServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		data, error := os.ReadFile("../testdata/domain/logs.json")
+		assert.NoError(t, error)
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write(data)
+	}))
+}
+
+func TestArchiveSync(t *testing.T) {
+	assert := assert.New(t)
+	server := newServer(t)
+	defer server.Close()
+	session, error := improvmx.New("token", improvmx.WithBaseURL(server.URL))
+	assert.NoError(error)
+
+	path := t.TempDir()
+	archive, error := Open(path)
+	assert.NoError(error)
+	added, error := archive.Sync(context.Background(), session, "piedpiper.com")
+	assert.NoError(error)
+	assert.Greater(added, 0)
+	assert.Equal(added, archive.Len())
+
+	added, error = archive.Sync(context.Background(), session, "piedpiper.com")
+	assert.NoError(error)
+	assert.Zero(added)
+
+	reopened, error := Open(path)
+	assert.NoError(error)
+	assert.Equal(archive.Len(), reopened.Len())
+
+	records, error := reopened.Query(Query{Domain: "piedpiper.com"})
+	assert.NoError(error)
+	assert.Len(records, archive.Len())
+	for _, record := range records {
+		assert.True(reopened.Contains(&record.Entry))
+	}
+}
+
+func TestArchiveQuery(t *testing.T) {
+	assert := assert.New(t)
+	archive, error := Open(t.TempDir())
+	assert.NoError(error)
+	added, error := archive.Append(
+		export.Record{Domain: "a.com", Entry: improvmx.LogEntry{ID: "1", CreatedAt: "2020-01-25 12:00:00+0000"}},
+		export.Record{Domain: "a.com", Entry: improvmx.LogEntry{ID: "2", CreatedAt: "2020-01-26 12:00:00+0000"}},
+		export.Record{Domain: "b.com", Entry: improvmx.LogEntry{ID: "3", CreatedAt: "2020-01-27 12:00:00+0000"}},
+		export.Record{Domain: "b.com", Entry: improvmx.LogEntry{ID: "4", CreatedAt: "whenever"}},
+		export.Record{Domain: "b.com", Entry: improvmx.LogEntry{ID: "1", CreatedAt: "2020-01-25 12:00:00+0000"}},
+	)
+	assert.NoError(error)
+	assert.Equal(4, added)
+	assert.FileExists(filepath.Join(archive.Path(), "2020-01-25.jsonl"))
+	assert.FileExists(filepath.Join(archive.Path(), "undated.jsonl"))
+
+	from := time.Date(2020, 1, 26, 0, 0, 0, 0, time.UTC)
+	records, error := archive.Query(Query{From: from})
+	assert.NoError(error)
+	assert.Len(records, 2)
+
+	records, error = archive.Query(Query{To: from})
+	assert.NoError(error)
+	assert.Len(records, 1)
+	assert.Equal("1", records[0].Entry.ID)
+
+	records, error = archive.Query(Query{Filter: func(record *export.Record) bool {
+		return record.Domain == "b.com"
+	}})
+	assert.NoError(error)
+	assert.Len(records, 2)
+}
+
+func TestArchiveAppendChanged(t *testing.T) {
+	assert := assert.New(t)
+	path := t.TempDir()
+	archive, error := Open(path)
+	assert.NoError(error)
+	entry := improvmx.LogEntry{ID: "1", CreatedAt: "2020-01-25 12:00:00+0000", Events: []improvmx.LogEvent{
+		{Status: improvmx.Queued, CreatedAt: "2020-01-25 12:00:00+0000"},
+	}}
+	added, error := archive.Append(export.Records("a.com", entry)...)
+	assert.NoError(error)
+	assert.Equal(1, added)
+
+	entry.Events = append(entry.Events, improvmx.LogEvent{Status: improvmx.Delivered, CreatedAt: "2020-01-25 12:00:05+0000"})
+	added, error = archive.Append(export.Records("a.com", entry, entry)...)
+	assert.NoError(error)
+	assert.Equal(1, added)
+	assert.Equal(1, archive.Len())
+
+	reopened, error := Open(path)
+	assert.NoError(error)
+	added, error = reopened.Append(export.Records("a.com", entry)...)
+	assert.NoError(error)
+	assert.Zero(added)
+	records, error := reopened.Query(Query{})
+	assert.NoError(error)
+	if assert.Len(records, 1) {
+		assert.Equal(improvmx.Delivered, records[0].Entry.FinalStatus())
+	}
+}
@@ -0,0 +1,182 @@
+package improvmx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Returned without sending the request when calling an endpoint the plan of
+// the account does not include, such as CredentialEndpoint.
+var ErrPremiumRequired = errors.New("premium account required")
+
+// How long Session.Capabilities caches the capabilities of the account.
+const CapabilitiesTTL = time.Hour
+
+// What the plan of the account allows, as returned by Session.Capabilities.
+type Capabilities struct {
+	Premium bool
+	// The name of the plan, empty if the account has none
+	Plan string
+	// Whether SMTP credentials may be managed
+	Credentials bool
+	Limits      Limits
+}
+
+// The limits of the plan of the account. Zero means the plan does not cap the
+// resource.
+type Limits struct {
+	Aliases      int
+	DailyQuota   int
+	Domains      int
+	RateLimit    int
+	Redirections int
+	Subdomains   int
+}
+
+// The endpoint methods requiring a premium account.
+var premiumEndpoints = map[string]bool{
+	"Credentials.List":   true,
+	"Credentials.Create": true,
+	"Credentials.Update": true,
+	"Credentials.Delete": true,
+}
+
+// Caches the capabilities of the account for a Session.
+type capabilityCache struct {
+	mutex        sync.Mutex
+	capabilities *Capabilities
+	expires      time.Time
+	// The read in progress, shared by concurrent callers
+	pending *capabilityRead
+}
+
+// A read of the account, whose result is available once done is closed.
+type capabilityRead struct {
+	done         chan struct{}
+	capabilities *Capabilities
+	error        error
+}
+
+// Returns the capabilities of the account. They are read from the account on
+// first use, and cached for CapabilitiesTTL.
+func (session *Session) Capabilities(ctx context.Context) (*Capabilities, error) {
+	return session.capabilities.get(ctx, func() (*Account, error) { return session.Account.Read(ctx) })
+}
+
+// Returns a copy of the cached capabilities, reading the account with read if
+// they are missing or expired. The account is read without holding the lock,
+// and concurrent callers wait for the same read, or until ctx is done. Failures
+// are not cached.
+func (cache *capabilityCache) get(ctx context.Context, read func() (*Account, error)) (*Capabilities, error) {
+	cache.mutex.Lock()
+	if cache.capabilities != nil && time.Now().Before(cache.expires) {
+		capabilities := *cache.capabilities
+		cache.mutex.Unlock()
+		return &capabilities, nil
+	}
+	pending := cache.pending
+	if pending == nil {
+		pending = &capabilityRead{done: make(chan struct{})}
+		cache.pending = pending
+		cache.mutex.Unlock()
+		cache.read(pending, read)
+	} else {
+		cache.mutex.Unlock()
+		select {
+		case <-pending.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if pending.error != nil {
+		return nil, pending.error
+	}
+	capabilities := *pending.capabilities
+	return &capabilities, nil
+}
+
+// Reads the account, and publishes the result to the callers waiting for it.
+func (cache *capabilityCache) read(pending *capabilityRead, read func() (*Account, error)) {
+	account, error := read()
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if error == nil {
+		cache.capabilities, cache.expires = newCapabilities(account), time.Now().Add(CapabilitiesTTL)
+	}
+	pending.capabilities, pending.error = cache.capabilities, error
+	cache.pending = nil
+	close(pending.done)
+}
+
+func newCapabilities(account *Account) *Capabilities {
+	capabilities := &Capabilities{
+		Premium:     account.Premium,
+		Credentials: account.Premium,
+		Limits: Limits{
+			Aliases:      account.Limits.Aliases,
+			DailyQuota:   account.Limits.DailyQuota,
+			Domains:      account.Limits.Domains,
+			RateLimit:    account.Limits.RateLimit,
+			Redirections: account.Limits.Redirections,
+			Subdomains:   account.Limits.Subdomains,
+		},
+	}
+	if account.Plan != nil {
+		capabilities.Plan = account.Plan.Name
+	}
+	return capabilities
+}
+
+// Refuses requests to premium endpoints with ErrPremiumRequired if the account
+// is not premium. The account is read through the inner transport, so that
+// hooks and loggers only observe the requests made by the caller. If it cannot
+// be read, the request is sent, and left to the ImprovMX REST API to refuse.
+type capabilityTransport struct {
+	session *Session
+	next    http.RoundTripper
+}
+
+func (transport *capabilityTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	operation, _, _ := transport.session.operation(request)
+	if !premiumEndpoints[operation.endpoint] {
+		return transport.next.RoundTrip(request)
+	}
+	read := func() (*Account, error) { return transport.readAccount(request) }
+	capabilities, error := transport.session.capabilities.get(request.Context(), read)
+	if error == nil && !capabilities.Premium {
+		return nil, ErrPremiumRequired
+	}
+	return transport.next.RoundTrip(request)
+}
+
+// Reads the account with the credentials and context of the given request.
+func (transport *capabilityTransport) readAccount(original *http.Request) (*Account, error) {
+	location, error := url.Parse(transport.session.client.HostURL + accountReadPath)
+	if error != nil {
+		return nil, error
+	}
+	request := original.Clone(original.Context())
+	request.Method = http.MethodGet
+	request.URL, request.Host = location, location.Host
+	request.Body, request.GetBody, request.ContentLength = nil, nil, 0
+	request.Header.Del("Content-Type")
+	response, error := transport.next.RoundTrip(request)
+	if error != nil {
+		return nil, error
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to read account: %s", response.Status)
+	}
+	decoded := &accountResponse{}
+	if error := json.NewDecoder(response.Body).Decode(decoded); error != nil {
+		return nil, error
+	}
+	return &decoded.Account, nil
+}
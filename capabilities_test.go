@@ -0,0 +1,125 @@
+package improvmx
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"occult.work/doze/test"
+)
+
+type CapabilitiesTestSuite struct {
+	test.Suite
+	session *Session
+	reads   atomic.Int32
+	// Closed to let reads of the account respond, if not nil
+	release chan struct{}
+}
+
+type CapabilitiesFreeTestSuite (CapabilitiesTestSuite)
+
+func (suite *CapabilitiesTestSuite) SetupSuite() {
+	read := suite.FileResponseHandler("testdata/account/read.json")
+	router := test.NewRouter().
+		Get(accountReadPath, func(writer http.ResponseWriter, request *http.Request) {
+			suite.reads.Add(1)
+			if suite.release != nil {
+				<-suite.release
+			}
+			read(writer, request)
+		})
+	suite.Initialize(router)
+	suite.Data = &testData
+}
+
+func (suite *CapabilitiesTestSuite) SetupTest() {
+	suite.reads.Store(0)
+	suite.release = nil
+	suite.session, _ = New("capabilities-test-suite", WithBaseURL(suite.Server.URL))
+}
+
+func (suite *CapabilitiesFreeTestSuite) SetupSuite() {
+	read := suite.FileResponseHandler("testdata/account/free.json")
+	router := test.NewRouter().
+		Get(accountReadPath, func(writer http.ResponseWriter, request *http.Request) {
+			suite.reads.Add(1)
+			read(writer, request)
+		}).
+		Get(credentialsListPath, func(writer http.ResponseWriter, request *http.Request) {
+			suite.Fail("credentials were requested", request.URL.Path)
+		}).
+		Post(credentialsCreatePath, func(writer http.ResponseWriter, request *http.Request) {
+			suite.Fail("credentials were requested", request.URL.Path)
+		}).
+		Delete(credentialsDeletePath, func(writer http.ResponseWriter, request *http.Request) {
+			suite.Fail("credentials were requested", request.URL.Path)
+		}).
+		Get(aliasListPath, suite.FileResponseHandler("testdata/alias/list.json"))
+	suite.Initialize(router)
+	suite.Data = &testData
+	suite.session, _ = New("capabilities-free-test-suite", WithBaseURL(suite.Server.URL))
+}
+
+func TestCapabilities(t *testing.T) {
+	test.Run(t, new(CapabilitiesTestSuite))
+	test.Run(t, new(CapabilitiesFreeTestSuite))
+}
+
+func (suite *CapabilitiesTestSuite) TestCapabilities() {
+	capabilities, error := suite.session.Capabilities(context.Background())
+	suite.Require().NoError(error)
+	suite.True(capabilities.Premium)
+	suite.True(capabilities.Credentials)
+	suite.Equal("enterprise249", capabilities.Plan)
+	suite.Equal(Limits{10000, 100000, 10000, 10, 50, 2}, capabilities.Limits)
+
+	capabilities.Premium = false
+	capabilities, error = suite.session.Capabilities(context.Background())
+	suite.Require().NoError(error)
+	suite.True(capabilities.Premium)
+	suite.Equal(int32(1), suite.reads.Load())
+}
+
+func (suite *CapabilitiesTestSuite) TestConcurrentReads() {
+	suite.release = make(chan struct{})
+	var group sync.WaitGroup
+	for index := 0; index < 8; index++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			capabilities, error := suite.session.Capabilities(context.Background())
+			suite.NoError(error)
+			suite.NotNil(capabilities)
+		}()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	suite.Eventually(func() bool { return suite.reads.Load() == 1 }, time.Second, time.Millisecond)
+	_, error := suite.session.Capabilities(ctx)
+	suite.ErrorIs(error, context.Canceled)
+
+	close(suite.release)
+	group.Wait()
+	suite.Equal(int32(1), suite.reads.Load())
+}
+
+func (suite *CapabilitiesFreeTestSuite) TestPremiumRequired() {
+	ctx := context.Background()
+	_, error := suite.session.Credentials.List(ctx, "example.com")
+	suite.ErrorIs(error, ErrPremiumRequired)
+	_, error = suite.session.Credentials.Create(ctx, "example.com", User{"richard", "hunter2"})
+	suite.ErrorIs(error, ErrPremiumRequired)
+	suite.ErrorIs(suite.session.Domain("example.com").Credentials().Delete(ctx, "richard"), ErrPremiumRequired)
+	suite.Equal(int32(1), suite.reads.Load())
+
+	_, error = suite.session.Aliases.List(ctx, "example.com")
+	suite.NoError(error)
+
+	capabilities, error := suite.session.Capabilities(ctx)
+	suite.Require().NoError(error)
+	suite.Equal(Capabilities{Plan: "free", Limits: Limits{25, 500, 1, 2, 0, 0}}, *capabilities)
+}
@@ -0,0 +1,107 @@
+package improvmx
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// The name of the catch-all alias, which receives mail sent to any address of
+// the domain without an alias of its own.
+const CatchAllName = "*"
+
+// How the aliases of a domain relate to its catch-all alias.
+type CatchAllReport struct {
+	Domain string
+	// The catch-all alias, or nil if the domain has none
+	CatchAll *Alias
+	// Aliases forwarding to the same recipients as the catch-all. Deleting
+	// them would not change where their mail is delivered.
+	Redundant []Alias
+	// Aliases forwarding elsewhere, shadowing the catch-all for their name.
+	// Deleting them would send their mail to the catch-all instead.
+	Shadowed []Alias
+}
+
+// Returns true if the alias is the catch-all alias.
+func (alias Alias) IsCatchAll() bool {
+	return alias.Name == CatchAllName
+}
+
+// Returns the catch-all alias of the given domain, or nil if it has none.
+func (endpoint *AliasEndpoint) CatchAll(ctx context.Context, domain string) (*Alias, error) {
+	alias, error := endpoint.Read(ctx, domain, CatchAllName)
+	if isNotFound(error) {
+		return nil, nil
+	}
+	return alias, error
+}
+
+// Forwards every address of the domain without an alias of its own to the
+// given address, creating or updating the catch-all alias as needed.
+func (endpoint *AliasEndpoint) SetCatchAll(ctx context.Context, domain, address string) (*Alias, error) {
+	current, error := endpoint.CatchAll(ctx, domain)
+	if error != nil {
+		return nil, error
+	}
+	if current == nil {
+		return endpoint.Create(ctx, domain, CatchAllName, address)
+	}
+	if normalizeAddress(current.Address) == normalizeAddress(address) {
+		return current, nil
+	}
+	return endpoint.Update(ctx, domain, CatchAllName, address)
+}
+
+// Deletes the catch-all alias of the domain. No error is returned if the
+// domain has none.
+func (endpoint *AliasEndpoint) RemoveCatchAll(ctx context.Context, domain string) error {
+	if error := endpoint.Delete(ctx, domain, CatchAllName); error != nil && !isNotFound(error) {
+		return error
+	}
+	return nil
+}
+
+// Lists the aliases of the domain, and reports how they relate to its
+// catch-all alias. See AnalyzeCatchAll.
+func (endpoint *AliasEndpoint) AnalyzeCatchAll(ctx context.Context, domain string) (*CatchAllReport, error) {
+	aliases, error := endpoint.List(ctx, domain)
+	if error != nil {
+		return nil, error
+	}
+	report := AnalyzeCatchAll(aliases)
+	report.Domain = domain
+	return report, nil
+}
+
+// Reports how the given aliases of a single domain relate to its catch-all
+// alias. Recipients are compared ignoring case, whitespace and order. If there
+// is no catch-all alias, the report is empty.
+func AnalyzeCatchAll(aliases []Alias) *CatchAllReport {
+	report := &CatchAllReport{}
+	for index := range aliases {
+		if aliases[index].IsCatchAll() {
+			catchAll := aliases[index]
+			report.CatchAll = &catchAll
+		}
+	}
+	if report.CatchAll == nil {
+		return report
+	}
+	target := normalizeAddress(report.CatchAll.Address)
+	for _, alias := range aliases {
+		switch {
+		case alias.IsCatchAll():
+		case normalizeAddress(alias.Address) == target:
+			report.Redundant = append(report.Redundant, alias)
+		default:
+			report.Shadowed = append(report.Shadowed, alias)
+		}
+	}
+	byName := func(aliases []Alias) func(int, int) bool {
+		return func(i, j int) bool { return strings.ToLower(aliases[i].Name) < strings.ToLower(aliases[j].Name) }
+	}
+	sort.Slice(report.Redundant, byName(report.Redundant))
+	sort.Slice(report.Shadowed, byName(report.Shadowed))
+	return report
+}
@@ -0,0 +1,132 @@
+package improvmx
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"occult.work/doze/test"
+)
+
+// Keeps the catch-all alias of piedpiper.com, so that it can be set and
+// removed repeatedly.
+type CatchAllTestSuite struct {
+	test.Suite
+	session *Session
+	// The address of the catch-all alias, empty if there is none
+	catchAll string
+	// Fails reading the catch-all alias if set
+	broken bool
+	// Every request that modified the catch-all alias, as "METHOD path"
+	writes []string
+}
+
+func (suite *CatchAllTestSuite) SetupSuite() {
+	notFound := func(writer http.ResponseWriter) {
+		writer.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(writer, `{ "error": "Alias not found", "code": 404, "success": false }`)
+	}
+	writeCatchAll := func(writer http.ResponseWriter) {
+		suite.Render(writer, "testdata/alias/create.json.tmpl", Alias{suite.catchAll, CatchAllName, 1})
+	}
+	router := test.NewRouter().
+		Get(aliasListPath, suite.FileResponseHandler("testdata/alias/catchall.json")).
+		Get(aliasReadPath, func(writer http.ResponseWriter, request *http.Request) {
+			switch {
+			case suite.broken:
+				writer.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(writer, `{ "error": "Internal server error", "code": 500, "success": false }`)
+			case suite.catchAll == "":
+				notFound(writer)
+			default:
+				writeCatchAll(writer)
+			}
+		}).
+		Post(aliasCreatePath, func(writer http.ResponseWriter, request *http.Request) {
+			suite.writes = append(suite.writes, request.Method+" "+request.URL.Path)
+			suite.catchAll = suite.Parameters(request)["forward"]
+			writeCatchAll(writer)
+		}).
+		Put(aliasUpdatePath, func(writer http.ResponseWriter, request *http.Request) {
+			suite.writes = append(suite.writes, request.Method+" "+request.URL.Path)
+			suite.catchAll = suite.Parameters(request)["forward"]
+			writeCatchAll(writer)
+		}).
+		Delete(aliasDeletePath, func(writer http.ResponseWriter, request *http.Request) {
+			suite.writes = append(suite.writes, request.Method+" "+request.URL.Path)
+			if suite.catchAll == "" {
+				notFound(writer)
+				return
+			}
+			suite.catchAll = ""
+			fmt.Fprint(writer, `{ "success": true }`)
+		})
+	suite.Initialize(router)
+	suite.Data = &testData
+	suite.session, _ = New("catch-all-test-suite", WithBaseURL(suite.Server.URL))
+}
+
+func (suite *CatchAllTestSuite) SetupTest() {
+	suite.catchAll = ""
+	suite.broken = false
+	suite.writes = nil
+}
+
+func TestCatchAll(t *testing.T) {
+	test.Run(t, new(CatchAllTestSuite))
+}
+
+func (suite *CatchAllTestSuite) TestCatchAll() {
+	ctx := context.Background()
+	alias, error := suite.session.Aliases.CatchAll(ctx, "piedpiper.com")
+	suite.NoError(error)
+	suite.Nil(alias)
+	suite.NoError(suite.session.Aliases.RemoveCatchAll(ctx, "piedpiper.com"))
+
+	alias, error = suite.session.Aliases.SetCatchAll(ctx, "piedpiper.com", "inbox@example.com")
+	suite.Require().NoError(error)
+	suite.True(alias.IsCatchAll())
+	_, error = suite.session.Domain("piedpiper.com").Aliases().SetCatchAll(ctx, "Inbox@example.com ")
+	suite.NoError(error)
+	_, error = suite.session.Aliases.SetCatchAll(ctx, "piedpiper.com", "ops@example.com")
+	suite.NoError(error)
+	suite.Equal("ops@example.com", suite.catchAll)
+	suite.Equal([]string{
+		"DELETE /domains/piedpiper.com/aliases/*/",
+		"POST /domains/piedpiper.com/aliases/",
+		"PUT /domains/piedpiper.com/aliases/*/",
+	}, suite.writes)
+
+	alias, error = suite.session.Domain("piedpiper.com").Aliases().CatchAll(ctx)
+	suite.NoError(error)
+	suite.Equal("ops@example.com", alias.Address)
+	suite.NoError(suite.session.Domain("piedpiper.com").Aliases().RemoveCatchAll(ctx))
+	suite.Empty(suite.catchAll)
+
+	suite.broken = true
+	_, error = suite.session.Aliases.CatchAll(ctx, "piedpiper.com")
+	suite.Error(error)
+}
+
+func (suite *CatchAllTestSuite) TestAnalyzeCatchAll() {
+	report, error := suite.session.Domain("piedpiper.com").Aliases().AnalyzeCatchAll(context.Background())
+	suite.Require().NoError(error)
+	suite.Equal("piedpiper.com", report.Domain)
+	suite.Equal(CatchAllName, report.CatchAll.Name)
+	suite.Equal([]string{"jared", "team"}, aliasNames(report.Redundant))
+	suite.Equal([]string{"richard"}, aliasNames(report.Shadowed))
+
+	report = AnalyzeCatchAll([]Alias{{Name: "richard", Address: "richard@example.com"}})
+	suite.Nil(report.CatchAll)
+	suite.Empty(report.Redundant)
+	suite.Empty(report.Shadowed)
+}
+
+func aliasNames(aliases []Alias) []string {
+	var names []string
+	for _, alias := range aliases {
+		names = append(names, alias.Name)
+	}
+	return names
+}
@@ -0,0 +1,83 @@
+// Command improvmx-exporter periodically collects the state of an ImprovMX
+// account, and exposes it as Prometheus metrics.
+//
+// The session is configured from the profile selected by -profile or
+// IMPROVMX_PROFILE within the configuration file (see improvmx.NewFromConfig),
+// or from the IMPROVMX_API_TOKEN environment variable.
+//
+// Usage:
+//
+//	improvmx-exporter [-config path] [-profile name] [-listen :9720] [-interval 5m] [-records] [-credentials] [-logs] [-domain name]...
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"occult.work/improvmx"
+	"occult.work/improvmx/exporter"
+)
+
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+func main() {
+	var options exporter.Options
+	listen := flag.String("listen", ":9720", "address to serve metrics on")
+	path := flag.String("path", "/metrics", "path to serve metrics on")
+	config := flag.String("config", "", "configuration file (defaults to IMPROVMX_CONFIG or the user configuration directory)")
+	profile := flag.String("profile", "", "configuration profile (defaults to IMPROVMX_PROFILE or the configured default)")
+	interval := flag.Duration("interval", 5*time.Minute, "time between collections")
+	flag.BoolVar(&options.Records, "records", false, "collect DNS record verification results")
+	flag.BoolVar(&options.Credentials, "credentials", false, "collect SMTP credential usage")
+	flag.BoolVar(&options.Logs, "logs", false, "count log entries by status")
+	flag.DurationVar(&options.LogLookback, "log-lookback", exporter.DefaultLogLookback, "how long log entries are remembered, to count each once")
+	flag.Var((*stringList)(&options.Domains), "domain", "domain to collect (repeatable, defaults to every domain)")
+	flag.Parse()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	options.Requests = exporter.NewRequestMetrics()
+	session, error := improvmx.NewFromConfig(ctx, *config, *profile,
+		improvmx.WithUserAgent("improvmx-exporter"),
+		improvmx.WithReadOnly(),
+		improvmx.WithHooks(improvmx.MetricsHooks(options.Requests)))
+	if error != nil {
+		log.Fatal(error)
+	}
+
+	collector := exporter.NewCollector(session, options)
+	go collector.Run(ctx, *interval, report)
+
+	mux := http.NewServeMux()
+	mux.Handle(*path, collector)
+	server := &http.Server{Addr: *listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+	log.Printf("serving metrics on %s%s", *listen, *path)
+	if error := server.ListenAndServe(); !errors.Is(error, http.ErrServerClosed) {
+		log.Fatal(error)
+	}
+}
+
+func report(error error) {
+	log.Printf("collection failed: %v", error)
+}
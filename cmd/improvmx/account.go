@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"occult.work/improvmx"
+)
+
+func accountUsage(ctx context.Context, arguments []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("account usage", flag.ContinueOnError)
+	if error := flags.Parse(arguments); error != nil {
+		return error
+	}
+	session, error := newSession(ctx)
+	if error != nil {
+		return error
+	}
+	usage, error := session.Usage(ctx)
+	if error != nil {
+		return error
+	}
+	return writeUsage(stdout, usage)
+}
+
+func writeUsage(stdout io.Writer, usage *improvmx.Usage) error {
+	if usage.Plan != nil {
+		fmt.Fprintf(stdout, "plan: %s\n", usage.Plan.Name)
+	}
+	writer := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "RESOURCE\tUSED\tLIMIT\tREMAINING")
+	row := func(name string, quota improvmx.Quota) {
+		if quota.Unlimited() {
+			fmt.Fprintf(writer, "%s\t%d\tunlimited\t-\n", name, quota.Used)
+			return
+		}
+		fmt.Fprintf(writer, "%s\t%d\t%d\t%d\n", name, quota.Used, quota.Limit, quota.Remaining())
+	}
+	row("domains", usage.Domains)
+	row("subdomains", usage.Subdomains)
+	for _, domain := range names(usage.Aliases) {
+		row("aliases of "+domain, usage.Aliases[domain])
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"occult.work/improvmx"
+)
+
+func TestWriteUsage(t *testing.T) {
+	assert := assert.New(t)
+	output := &bytes.Buffer{}
+	assert.NoError(writeUsage(output, &improvmx.Usage{
+		Plan:    &improvmx.AccountPlan{Name: "Premium"},
+		Domains: improvmx.Quota{Used: 2, Limit: 10},
+		Aliases: map[string]improvmx.Quota{"piedpiper.com": {Used: 3}},
+	}))
+	assert.Equal("plan: Premium\n"+
+		"RESOURCE                  USED  LIMIT      REMAINING\n"+
+		"domains                   2     10         8\n"+
+		"subdomains                0     unlimited  -\n"+
+		"aliases of piedpiper.com  3     unlimited  -\n", output.String())
+}
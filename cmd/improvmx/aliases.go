@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"occult.work/improvmx"
+	"occult.work/improvmx/forwarding"
+)
+
+func aliasesForwarders(ctx context.Context, arguments []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("aliases forwarders", flag.ContinueOnError)
+	var domains stringList
+	flags.Var(&domains, "domain", "domain to search (repeatable, defaults to every domain)")
+	if error := flags.Parse(arguments); error != nil {
+		return error
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("aliases forwarders requires an address")
+	}
+	session, error := newSession(ctx)
+	if error != nil {
+		return error
+	}
+	index, error := buildIndex(ctx, session, domains)
+	if error != nil {
+		return error
+	}
+	writer := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "ALIAS\tACTIVE\tFORWARD")
+	for _, entry := range index.ForwardersOf(flags.Arg(0)) {
+		fmt.Fprintf(writer, "%s@%s\t%t\t%s\n", entry.Alias.Name, entry.Domain, entry.Active, entry.Alias.Address)
+	}
+	return writer.Flush()
+}
+
+func aliasesReplace(ctx context.Context, arguments []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("aliases replace", flag.ContinueOnError)
+	var domains stringList
+	flags.Var(&domains, "domain", "domain to modify (repeatable, defaults to every domain)")
+	replacement := flags.String("with", "", "address replacing the removed one (defaults to removing it)")
+	apply := flags.Bool("apply", false, "apply the changes instead of only reporting them")
+	if error := flags.Parse(arguments); error != nil {
+		return error
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("aliases replace requires an address")
+	}
+	session, error := newSession(ctx)
+	if error != nil {
+		return error
+	}
+	index, error := buildIndex(ctx, session, domains)
+	if error != nil {
+		return error
+	}
+	plan := index.Replace(flags.Arg(0), *replacement)
+	if !*apply {
+		_, error := plan.WriteTo(stdout)
+		return error
+	}
+	applied, error := plan.Apply(ctx, session)
+	applied.WriteTo(stdout)
+	return error
+}
+
+func buildIndex(ctx context.Context, session *improvmx.Session, domains []string) (*forwarding.Index, error) {
+	return forwarding.Build(ctx, session, domains...)
+}
+
+func aliasesAnalyze(ctx context.Context, arguments []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("aliases analyze", flag.ContinueOnError)
+	var domains stringList
+	flags.Var(&domains, "domain", "domain to analyze (repeatable, defaults to every domain)")
+	hops := flags.Int("max-hops", forwarding.DefaultMaxHops, "report forwarding chains longer than this many hops")
+	if error := flags.Parse(arguments); error != nil {
+		return error
+	}
+	session, error := newSession(ctx)
+	if error != nil {
+		return error
+	}
+	index, error := buildIndex(ctx, session, domains)
+	if error != nil {
+		return error
+	}
+	report := forwarding.Analyze(index, *hops)
+	for _, cycle := range report.Cycles {
+		fmt.Fprintf(stdout, "cycle: %s\n", strings.Join(cycle, ", "))
+	}
+	for _, chain := range report.Chains {
+		fmt.Fprintf(stdout, "chain: %s\n", strings.Join(chain.Path, " -> "))
+	}
+	for _, inactive := range report.Inactive {
+		fmt.Fprintf(stdout, "inactive: %s forwards %s to %s on an inactive domain\n", inactive.Source, inactive.Recipient, inactive.Target)
+	}
+	if len(report.Cycles)+len(report.Chains)+len(report.Inactive) == 0 {
+		fmt.Fprintln(stdout, "no issues found")
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"occult.work/improvmx/migrate"
+)
+
+func domainsMigrate(ctx context.Context, arguments []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("domains migrate", flag.ContinueOnError)
+	state := flags.String("state", "", "state file used to resume an interrupted migration (defaults to <source>-<target>.json)")
+	credentials := flags.Bool("credentials", false, "copy SMTP credentials (premium accounts only)")
+	prompt := flags.Bool("prompt", false, "read the password of each copied credential from stdin instead of generating it")
+	remove := flags.Bool("delete", false, "delete the source domain once the target domain is verified")
+	force := flags.Bool("allow-conflicts", false, "delete the source domain even if some of its aliases conflict with the target domain")
+	interval := flags.Duration("interval", migrate.DefaultVerifyInterval, "time between checks of the target domain's DNS records")
+	timeout := flags.Duration("timeout", time.Hour, "how long to wait for the target domain to be verified")
+	if error := flags.Parse(arguments); error != nil {
+		return error
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("domains migrate requires a source and target domain")
+	}
+	source, target := flags.Arg(0), flags.Arg(1)
+	if *state == "" {
+		*state = fmt.Sprintf("%s-%s.json", source, target)
+	}
+	session, error := newSession(ctx)
+	if error != nil {
+		return error
+	}
+	options := migrate.Options{
+		StateFile:      *state,
+		Credentials:    *credentials,
+		VerifyInterval: *interval,
+		VerifyTimeout:  *timeout,
+		DeleteSource:   *remove,
+		AllowConflicts: *force,
+		Progress: func(step migrate.Step, message string) {
+			fmt.Fprintf(stdout, "%s: %s\n", step, message)
+		},
+	}
+	if *prompt {
+		options.Password = promptPassword(bufio.NewReader(os.Stdin), stdout)
+	}
+	migration, error := migrate.New(session, source, target, options)
+	if error != nil {
+		return error
+	}
+	result, error := migration.Run(ctx)
+	if result != nil && !*prompt {
+		for _, username := range names(result.Passwords) {
+			fmt.Fprintf(stdout, "password for %s@%s: %s\n", username, target, result.Passwords[username])
+		}
+	}
+	if error != nil {
+		return fmt.Errorf("%w (run again to resume from %s)", error, *state)
+	}
+	return nil
+}
+
+// Returns a migrate.PasswordFunc reading one password per line.
+func promptPassword(reader *bufio.Reader, writer io.Writer) migrate.PasswordFunc {
+	return func(ctx context.Context, username string) (string, error) {
+		fmt.Fprintf(writer, "password for %s: ", username)
+		line, error := reader.ReadString('\n')
+		password := strings.TrimRight(line, "\r\n")
+		if password == "" {
+			if error == nil {
+				error = fmt.Errorf("empty password")
+			}
+			return "", error
+		}
+		return password, nil
+	}
+}
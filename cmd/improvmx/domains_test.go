@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPromptPassword(t *testing.T) {
+	assert := assert.New(t)
+	output := &bytes.Buffer{}
+	password := promptPassword(bufio.NewReader(strings.NewReader("hunter2\r\n\n")), output)
+	value, error := password(context.Background(), "richard")
+	assert.NoError(error)
+	assert.Equal("hunter2", value)
+	assert.Equal("password for richard: ", output.String())
+	_, error = password(context.Background(), "monica")
+	assert.Error(error)
+	_, error = password(context.Background(), "jared")
+	assert.Error(error)
+}
+
+func TestDomainsMigrateArguments(t *testing.T) {
+	assert := assert.New(t)
+	error := run(context.Background(), []string{"domains", "migrate", "piedpiper.com"}, &bytes.Buffer{})
+	assert.ErrorContains(error, "requires a source and target domain")
+}
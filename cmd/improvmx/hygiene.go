@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"occult.work/improvmx"
+	"occult.work/improvmx/archive"
+	"occult.work/improvmx/hygiene"
+)
+
+func hygieneReport(ctx context.Context, arguments []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("hygiene report", flag.ContinueOnError)
+	build := hygieneFlags(flags)
+	if error := flags.Parse(arguments); error != nil {
+		return error
+	}
+	_, report, error := build(ctx)
+	if error != nil {
+		return error
+	}
+	_, error = report.WriteTo(stdout)
+	return error
+}
+
+func hygienePrune(ctx context.Context, arguments []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("hygiene prune", flag.ContinueOnError)
+	build := hygieneFlags(flags)
+	policy := hygiene.Policy{}
+	flags.BoolVar(&policy.Aliases, "aliases", false, "delete unused aliases")
+	flags.BoolVar(&policy.Credentials, "prune-credentials", false, "delete unused or stale SMTP credentials")
+	flags.BoolVar(&policy.Domains, "domains", false, "delete inactive domains, with all of their aliases and credentials")
+	flags.BoolVar(&policy.PartialLogs, "partial-logs", false, "delete aliases even if the logs do not cover the whole window")
+	yes := flags.Bool("yes", false, "delete without asking for confirmation")
+	if error := flags.Parse(arguments); error != nil {
+		return error
+	}
+	if !policy.Aliases && !policy.Credentials && !policy.Domains {
+		return fmt.Errorf("hygiene prune requires at least one of -aliases, -prune-credentials or -domains")
+	}
+	session, report, error := build(ctx)
+	if error != nil {
+		return error
+	}
+	if !*yes {
+		policy.Confirm = confirmFinding(bufio.NewReader(os.Stdin), stdout)
+	}
+	pruned, error := report.Prune(ctx, session, policy)
+	for _, finding := range pruned {
+		fmt.Fprintf(stdout, "deleted %s\n", finding)
+	}
+	return error
+}
+
+// Registers the flags shared by the hygiene subcommands, and returns a
+// function building the report they select.
+func hygieneFlags(flags *flag.FlagSet) func(context.Context) (*improvmx.Session, *hygiene.Report, error) {
+	options := hygiene.Options{}
+	var domains stringList
+	flags.Var(&domains, "domain", "domain to report on (repeatable, defaults to every domain)")
+	flags.DurationVar(&options.Window, "window", hygiene.DefaultWindow, "report aliases without mail in this window")
+	flags.BoolVar(&options.Credentials, "credentials", false, "report SMTP credentials (premium accounts only)")
+	flags.DurationVar(&options.CredentialMaxAge, "max-age", 0, "report SMTP credentials created longer ago than this")
+	path := flags.String("archive", "", "read logs from the local archive at this path instead of the live logs")
+	return func(ctx context.Context) (*improvmx.Session, *hygiene.Report, error) {
+		session, error := newSession(ctx)
+		if error != nil {
+			return nil, nil, error
+		}
+		if *path != "" {
+			store, error := archive.Open(*path)
+			if error != nil {
+				return nil, nil, error
+			}
+			options.Logs = hygiene.ArchiveLogs(store)
+		}
+		options.Domains = domains
+		options.Now = time.Now()
+		report, error := hygiene.Build(ctx, session, options)
+		return session, report, error
+	}
+}
+
+// Returns a confirmation function reading one answer per line.
+func confirmFinding(reader *bufio.Reader, writer io.Writer) func(hygiene.Finding) (bool, error) {
+	return func(finding hygiene.Finding) (bool, error) {
+		fmt.Fprintf(writer, "delete %s (%s)? [y/N] ", finding, finding.Reason)
+		line, error := reader.ReadString('\n')
+		answer := strings.ToLower(strings.TrimSpace(line))
+		if answer == "" && error != nil {
+			return false, error
+		}
+		return answer == "y" || answer == "yes", nil
+	}
+}
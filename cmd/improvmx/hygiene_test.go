@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"occult.work/improvmx/hygiene"
+)
+
+func TestConfirmFinding(t *testing.T) {
+	assert := assert.New(t)
+	output := &bytes.Buffer{}
+	confirm := confirmFinding(bufio.NewReader(strings.NewReader("y\n\nYes")), output)
+	finding := hygiene.Finding{Kind: hygiene.KindAlias, Domain: "piedpiper.com", Name: "jared", Reason: "no mail"}
+	for _, expected := range []bool{true, false, true} {
+		confirmed, error := confirm(finding)
+		assert.NoError(error)
+		assert.Equal(expected, confirmed)
+	}
+	_, error := confirm(finding)
+	assert.ErrorIs(error, io.EOF)
+	assert.Contains(output.String(), "delete alias jared@piedpiper.com (no mail)? [y/N] ")
+}
+
+func TestHygienePruneArguments(t *testing.T) {
+	error := run(context.Background(), []string{"hygiene", "prune"}, &bytes.Buffer{})
+	assert.ErrorContains(t, error, "requires at least one of")
+}
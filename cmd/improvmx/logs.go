@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"occult.work/improvmx/archive"
+	"occult.work/improvmx/export"
+	"occult.work/improvmx/redact"
+	"occult.work/improvmx/search"
+)
+
+func logsSearch(ctx context.Context, arguments []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("logs search", flag.ContinueOnError)
+	var domains stringList
+	flags.Var(&domains, "domain", "domain to search (repeatable, defaults to every domain)")
+	path := flags.String("archive", "", "search the local archive at this path instead of the live logs")
+	format := flags.String("format", "table", "output format: table, csv, events-csv, or jsonl")
+	policy := flags.String("redact", "", "redaction policy applied to the output (e.g., mask or pseudonymous)")
+	if error := flags.Parse(arguments); error != nil {
+		return error
+	}
+	redactor, error := newRedactor(*policy)
+	if error != nil {
+		return error
+	}
+	query, error := search.Parse(strings.Join(flags.Args(), " "))
+	if error != nil {
+		return error
+	}
+	records, error := loadRecords(ctx, *path, domains)
+	if error != nil {
+		return error
+	}
+	var matches []export.Record
+	for index := range records {
+		if !query.MatchRecord(&records[index]) {
+			continue
+		}
+		if redactor != nil {
+			records[index] = redactor.Record(records[index])
+		}
+		matches = append(matches, records[index])
+	}
+	return writeRecords(stdout, *format, matches)
+}
+
+// Returns every record of the given domains, either from the archive at path
+// or from the ImprovMX REST API if path is empty.
+func loadRecords(ctx context.Context, path string, domains []string) ([]export.Record, error) {
+	if path != "" {
+		store, error := archive.Open(path)
+		if error != nil {
+			return nil, error
+		}
+		return store.Query(archive.Query{Filter: inDomains(domains)})
+	}
+	session, error := newSession(ctx)
+	if error != nil {
+		return nil, error
+	}
+	if len(domains) == 0 {
+		list, error := session.Domains.List(ctx)
+		if error != nil {
+			return nil, error
+		}
+		for _, domain := range list {
+			domains = append(domains, domain.Name)
+		}
+	}
+	var records []export.Record
+	for _, domain := range domains {
+		entries, error := session.Domains.Logs(ctx, domain)
+		if error != nil {
+			return nil, error
+		}
+		records = append(records, export.Records(domain, entries...)...)
+	}
+	return records, nil
+}
+
+// Returns a Redactor for the given policy, or nil if policy is empty. Hashed
+// fields are keyed with the IMPROVMX_REDACT_KEY environment variable.
+func newRedactor(policy string) (*redact.Redactor, error) {
+	if policy == "" {
+		return nil, nil
+	}
+	parsed, error := redact.ParsePolicy(policy, []byte(os.Getenv("IMPROVMX_REDACT_KEY")))
+	if error != nil {
+		return nil, error
+	}
+	return redact.New(parsed)
+}
+
+func inDomains(domains []string) func(*export.Record) bool {
+	return func(record *export.Record) bool {
+		if len(domains) == 0 {
+			return true
+		}
+		for _, domain := range domains {
+			if strings.EqualFold(domain, record.Domain) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func writeRecords(stdout io.Writer, format string, records []export.Record) error {
+	if format != "table" {
+		writer, error := export.NewWriter(format, stdout)
+		if error != nil {
+			return error
+		}
+		return export.WriteAll(writer, records...)
+	}
+	table := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "CREATED\tDOMAIN\tSTATUS\tSENDER\tRECIPIENT\tSUBJECT")
+	for _, record := range records {
+		entry := record.Entry
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.CreatedAt,
+			record.Domain,
+			entry.FinalStatus(),
+			entry.Sender.Email,
+			entry.Recipient.Email,
+			entry.Subject)
+	}
+	return table.Flush()
+}
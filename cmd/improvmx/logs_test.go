@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"occult.work/improvmx"
+	"occult.work/improvmx/archive"
+	"occult.work/improvmx/export"
+)
+
+func setupArchive(t *testing.T) string {
+	data, error := os.ReadFile("../../testdata/domain/logs.json")
+	assert.NoError(t, error)
+	response := struct{ Logs []improvmx.LogEntry }{}
+	assert.NoError(t, json.Unmarshal(data, &response))
+	path := t.TempDir()
+	store, error := archive.Open(path)
+	assert.NoError(t, error)
+	_, error = store.Append(export.Records("piedpiper.com", response.Logs...)...)
+	assert.NoError(t, error)
+	return path
+}
+
+func TestLogsSearchArchive(t *testing.T) {
+	assert := assert.New(t)
+	path := setupArchive(t)
+	output := &bytes.Buffer{}
+	error := run(context.Background(), []string{"logs", "search", "-archive", path, "status:refused"}, output)
+	assert.NoError(error)
+	assert.Contains(output.String(), "spam@hooli.com")
+	assert.NotContains(output.String(), "russ@threecommas.com")
+
+	output.Reset()
+	error = run(context.Background(), []string{"logs", "search", "-archive", path, "-domain", "hooli.com"}, output)
+	assert.NoError(error)
+	assert.NotContains(output.String(), "piedpiper.com")
+}
+
+func TestLogsSearchRedacted(t *testing.T) {
+	assert := assert.New(t)
+	path := setupArchive(t)
+	output := &bytes.Buffer{}
+	error := run(context.Background(), []string{"logs", "search", "-archive", path, "-redact", "mask", "sender:spam@hooli.com"}, output)
+	assert.NoError(error)
+	assert.Contains(output.String(), "s***@hooli.com")
+	assert.NotContains(output.String(), "spam@hooli.com")
+
+	error = run(context.Background(), []string{"logs", "search", "-archive", path, "-redact", "pseudonymous"}, output)
+	assert.Error(error)
+}
+
+func TestRunErrors(t *testing.T) {
+	assert := assert.New(t)
+	output := &bytes.Buffer{}
+	assert.NoError(run(context.Background(), nil, output))
+	assert.Contains(output.String(), "logs search")
+	assert.Error(run(context.Background(), []string{"planets"}, output))
+	assert.Error(run(context.Background(), []string{"logs"}, output))
+	assert.Error(run(context.Background(), []string{"logs", "bake"}, output))
+	assert.Error(run(context.Background(), []string{"logs", "search", "-archive", t.TempDir(), "planet:mars"}, output))
+}
@@ -0,0 +1,142 @@
+// Command improvmx is a command line interface to the ImprovMX REST API.
+//
+// Sessions are configured from the profile selected by IMPROVMX_PROFILE within
+// the configuration file (see improvmx.NewFromConfig), or from the
+// IMPROVMX_API_TOKEN environment variable. The key used to pseudonymize
+// redacted output is read from IMPROVMX_REDACT_KEY.
+//
+// Usage:
+//
+//	improvmx <command> <subcommand> [flags] [arguments]
+//
+// Run improvmx help to list the available commands.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"occult.work/improvmx"
+)
+
+// A group of subcommands, such as "logs"
+type command struct {
+	summary     string
+	subcommands map[string]subcommand
+}
+
+type subcommand struct {
+	summary string
+	run     func(ctx context.Context, arguments []string, stdout io.Writer) error
+}
+
+var commands = map[string]command{
+	"account": {
+		summary: "inspect the account",
+		subcommands: map[string]subcommand{
+			"usage": {"compare current counts against the limits of the plan", accountUsage},
+		},
+	},
+	"aliases": {
+		summary: "find and rewrite aliases",
+		subcommands: map[string]subcommand{
+			"analyze":    {"report forwarding cycles, long chains and inactive targets", aliasesAnalyze},
+			"forwarders": {"list the aliases forwarding to an address", aliasesForwarders},
+			"replace":    {"remove or replace an address in every alias (dry run unless -apply)", aliasesReplace},
+		},
+	},
+	"domains": {
+		summary: "manage domains",
+		subcommands: map[string]subcommand{
+			"migrate": {"move a domain's aliases and credentials to a new domain", domainsMigrate},
+		},
+	},
+	"hygiene": {
+		summary: "find and prune unused aliases, credentials and domains",
+		subcommands: map[string]subcommand{
+			"prune":  {"delete the findings of the report, after confirmation unless -yes", hygienePrune},
+			"report": {"report unused aliases and credentials, and inactive domains", hygieneReport},
+		},
+	},
+	"logs": {
+		summary: "search and export mail logs",
+		subcommands: map[string]subcommand{
+			"search": {"search live or archived logs with a query", logsSearch},
+		},
+	},
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	if error := run(ctx, os.Args[1:], os.Stdout); error != nil {
+		if error != flag.ErrHelp {
+			fmt.Fprintf(os.Stderr, "improvmx: %v\n", error)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, arguments []string, stdout io.Writer) error {
+	if len(arguments) == 0 || arguments[0] == "help" || arguments[0] == "-h" || arguments[0] == "--help" {
+		usage(stdout)
+		return nil
+	}
+	group, ok := commands[arguments[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q", arguments[0])
+	}
+	if len(arguments) < 2 {
+		return fmt.Errorf("%s requires a subcommand: %s", arguments[0], strings.Join(names(group.subcommands), ", "))
+	}
+	action, ok := group.subcommands[arguments[1]]
+	if !ok {
+		return fmt.Errorf("unknown subcommand %q for %s", arguments[1], arguments[0])
+	}
+	return action.run(ctx, arguments[2:], stdout)
+}
+
+func usage(writer io.Writer) {
+	fmt.Fprintln(writer, "usage: improvmx <command> <subcommand> [flags] [arguments]")
+	fmt.Fprintln(writer)
+	for _, name := range names(commands) {
+		group := commands[name]
+		fmt.Fprintf(writer, "%s: %s\n", name, group.summary)
+		for _, subname := range names(group.subcommands) {
+			fmt.Fprintf(writer, "  %s %-12s %s\n", name, subname, group.subcommands[subname].summary)
+		}
+	}
+}
+
+// Returns a new Session for the configured profile. See improvmx.NewFromConfig.
+func newSession(ctx context.Context) (*improvmx.Session, error) {
+	return improvmx.NewFromConfig(ctx, "", "")
+}
+
+// Returns the keys of the map, sorted.
+func names[T any](values map[string]T) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// A flag.Value collecting every occurrence of a repeated flag.
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
@@ -1,7 +1,10 @@
 package improvmx
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 
 	"occult.work/doze"
 )
@@ -11,17 +14,21 @@ const (
 	Queued MessageStatus = "QUEUED"
 
 	// The email was refused at the SMTP connection.
-	Refused = "REFUSED"
+	Refused MessageStatus = "REFUSED"
 
 	// The email was successfully delivered to the end destination.
-	Delievered = "DELIVERED"
+	Delivered MessageStatus = "DELIVERED"
 
 	// The end destination refused the email temporarily. ImprovMX will try again
 	// multiple times with increased delay between.
-	SoftBounce = "SOFT-BOUNCE"
+	SoftBounce MessageStatus = "SOFT-BOUNCE"
 
 	// The end destination couldn't accept the email definitively.
-	HardBounce = "HARD-BOUNCE"
+	HardBounce MessageStatus = "HARD-BOUNCE"
+
+	// Deprecated: Use Delivered instead. This is kept for backwards
+	// compatibility only.
+	Delievered = Delivered
 )
 
 const (
@@ -53,6 +60,10 @@ const (
 )
 
 type Time = doze.Time
+
+// The state of a message as reported by a LogEvent. Values not covered by the
+// constants above may still be returned by the ImprovMX REST API, and are
+// preserved as-is. See ParseMessageStatus.
 type MessageStatus string
 
 type Contact struct {
@@ -118,6 +129,11 @@ type domainsResponse struct {
 	Page    int
 }
 
+type domainCreateRequest struct {
+	Domain string `json:"domain"`
+	DomainOption
+}
+
 type domainResponse struct {
 	Domain  Domain
 	Success bool
@@ -135,6 +151,11 @@ type aliasResponse struct {
 	Success bool
 }
 
+type domainCheckResponse struct {
+	Records DomainCheck
+	Success bool
+}
+
 type deleteResponse struct {
 	Success bool
 }
@@ -233,3 +254,20 @@ func getListOption(options ...*ListOption) *ListOption {
 func (e *Error) Error() string {
 	return fmt.Sprintf("%d: %s", e.Code, e.Message)
 }
+
+// Returns true if the error is an *Error reporting that the requested resource
+// does not exist.
+func isNotFound(error error) bool {
+	var failure *Error
+	return errors.As(error, &failure) && failure.Code == http.StatusNotFound
+}
+
+// Returns true if the error is an *Error reporting that the resource being
+// created already exists, as happens when racing another creator.
+func isAlreadyExists(error error) bool {
+	var failure *Error
+	if !errors.As(error, &failure) {
+		return false
+	}
+	return failure.Code == http.StatusConflict || strings.Contains(strings.ToLower(failure.Message), "already")
+}
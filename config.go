@@ -0,0 +1,267 @@
+package improvmx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// The name of the profile used when neither the caller, IMPROVMX_PROFILE nor
+// the configuration file selects one.
+const DefaultProfile = "default"
+
+// A configuration file holding named profiles, typically found at
+// DefaultConfigPath. For example:
+//
+//	default = "work"
+//
+//	[profiles.work]
+//	token_command = ["pass", "show", "improvmx/work"]
+//	user_agent = "acme-mail-tools"
+//	retries = 3
+//	retry_wait = "1s"
+//	rate_limit = 2
+//	preflight = true
+//
+//	[profiles.personal]
+//	token_env = "IMPROVMX_PERSONAL_TOKEN"
+type Config struct {
+	// The profile used when none is given.
+	Default  string             `toml:"default"`
+	Profiles map[string]Profile `toml:"profiles"`
+}
+
+// The settings of a single ImprovMX account. Exactly one token source must be
+// set, unless the token is provided through IMPROVMX_API_TOKEN.
+type Profile struct {
+	// The API token itself
+	Token string `toml:"token"`
+	// The environment variable holding the API token
+	TokenEnv string `toml:"token_env"`
+	// The file holding the API token. A leading ~ is expanded to the home
+	// directory, and surrounding whitespace is trimmed.
+	TokenFile string `toml:"token_file"`
+	// The command, and its arguments, printing the API token on stdout
+	TokenCommand []string `toml:"token_command"`
+
+	BaseURL   string `toml:"base_url"`
+	UserAgent string `toml:"user_agent"`
+
+	// See WithRetries
+	Retries      int           `toml:"retries"`
+	RetryWait    time.Duration `toml:"retry_wait"`
+	RetryMaxWait time.Duration `toml:"retry_max_wait"`
+
+	// See WithRateLimit. Zero disables rate limiting.
+	RateLimit float64 `toml:"rate_limit"`
+	Burst     int     `toml:"burst"`
+
+	// See WithPreflight
+	Preflight bool `toml:"preflight"`
+}
+
+// Returns the default location of the configuration file, which is
+// improvmx/config.toml within os.UserConfigDir.
+func DefaultConfigPath() (string, error) {
+	directory, error := os.UserConfigDir()
+	if error != nil {
+		return "", error
+	}
+	return filepath.Join(directory, "improvmx", "config.toml"), nil
+}
+
+// Reads the configuration file at the given path.
+func LoadConfig(path string) (*Config, error) {
+	config := &Config{}
+	metadata, error := toml.DecodeFile(expandHome(path), config)
+	if error != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", path, error)
+	}
+	if undecoded := metadata.Undecoded(); len(undecoded) != 0 {
+		return nil, fmt.Errorf("failed to load %s: unknown key %q", path, undecoded[0].String())
+	}
+	return config, nil
+}
+
+// Returns the named profile, with any IMPROVMX_* environment overrides
+// applied. If name is empty, IMPROVMX_PROFILE is used, then Config.Default,
+// then DefaultProfile. A missing profile is only an error if it was
+// explicitly selected and IMPROVMX_API_TOKEN is unset.
+//
+// The following environment variables override the profile:
+//
+//	IMPROVMX_API_TOKEN   the API token, replacing every token source
+//	IMPROVMX_BASE_URL    Profile.BaseURL
+//	IMPROVMX_USER_AGENT  Profile.UserAgent
+//	IMPROVMX_RETRIES     Profile.Retries
+//	IMPROVMX_RATE_LIMIT  Profile.RateLimit
+func (config *Config) Profile(name string) (*Profile, error) {
+	explicit := true
+	if name == "" {
+		name = os.Getenv("IMPROVMX_PROFILE")
+	}
+	if name == "" {
+		name = config.Default
+	}
+	if name == "" {
+		name, explicit = DefaultProfile, false
+	}
+	profile, ok := config.Profiles[name]
+	if !ok && explicit && os.Getenv("IMPROVMX_API_TOKEN") == "" {
+		return nil, fmt.Errorf("profile %q not found", name)
+	}
+	if error := profile.applyEnvironment(); error != nil {
+		return nil, error
+	}
+	return &profile, nil
+}
+
+// Returns the API token from the configured token source.
+func (profile *Profile) ResolveToken(ctx context.Context) (string, error) {
+	sources := 0
+	for _, set := range []bool{profile.Token != "", profile.TokenEnv != "", profile.TokenFile != "", len(profile.TokenCommand) != 0} {
+		if set {
+			sources++
+		}
+	}
+	switch {
+	case sources == 0:
+		return "", fmt.Errorf("no API token configured")
+	case sources > 1:
+		return "", fmt.Errorf("only one of token, token_env, token_file or token_command may be set")
+	case profile.Token != "":
+		return profile.Token, nil
+	case profile.TokenEnv != "":
+		token := os.Getenv(profile.TokenEnv)
+		if token == "" {
+			return "", fmt.Errorf("%s is not set", profile.TokenEnv)
+		}
+		return token, nil
+	case profile.TokenFile != "":
+		data, error := os.ReadFile(expandHome(profile.TokenFile))
+		if error != nil {
+			return "", error
+		}
+		return nonEmptyToken(string(data), profile.TokenFile)
+	}
+	command := exec.CommandContext(ctx, profile.TokenCommand[0], profile.TokenCommand[1:]...)
+	stderr := &bytes.Buffer{}
+	command.Stderr = stderr
+	output, error := command.Output()
+	if error != nil {
+		return "", fmt.Errorf("token command %q failed: %w: %s", profile.TokenCommand[0], error, strings.TrimSpace(stderr.String()))
+	}
+	return nonEmptyToken(string(output), profile.TokenCommand[0])
+}
+
+// Returns the session options configured by the profile.
+func (profile *Profile) Options() []SessionOption {
+	var options []SessionOption
+	if profile.BaseURL != "" {
+		options = append(options, WithBaseURL(profile.BaseURL))
+	}
+	if profile.UserAgent != "" {
+		options = append(options, WithUserAgent(profile.UserAgent))
+	}
+	if profile.Retries != 0 {
+		options = append(options, WithRetries(profile.Retries, profile.RetryWait, profile.RetryMaxWait))
+	}
+	if profile.RateLimit != 0 {
+		options = append(options, WithRateLimit(profile.RateLimit, profile.Burst))
+	}
+	if profile.Preflight {
+		options = append(options, WithPreflight())
+	}
+	return options
+}
+
+// Returns a Session for the named profile of the configuration file at path.
+// If path is empty, IMPROVMX_CONFIG is used, then DefaultConfigPath, in which
+// case a missing file is not an error and the session is configured from the
+// environment alone. See Config.Profile for how the profile is selected.
+// The given options are applied after those of the profile.
+func NewFromConfig(ctx context.Context, path, name string, options ...SessionOption) (*Session, error) {
+	optional := false
+	if path == "" {
+		path = os.Getenv("IMPROVMX_CONFIG")
+	}
+	if path == "" {
+		var error error
+		if path, error = DefaultConfigPath(); error != nil {
+			return nil, error
+		}
+		optional = true
+	}
+	config, error := LoadConfig(path)
+	if errors.Is(error, fs.ErrNotExist) && optional {
+		config, error = &Config{}, nil
+	}
+	if error != nil {
+		return nil, error
+	}
+	profile, error := config.Profile(name)
+	if error != nil {
+		return nil, error
+	}
+	token, error := profile.ResolveToken(ctx)
+	if error != nil {
+		return nil, fmt.Errorf("failed to resolve API token: %w", error)
+	}
+	return New(token, append(profile.Options(), options...)...)
+}
+
+func (profile *Profile) applyEnvironment() error {
+	if token := os.Getenv("IMPROVMX_API_TOKEN"); token != "" {
+		// Replaces the token source of the profile, keeping everything else
+		profile.Token, profile.TokenEnv, profile.TokenFile, profile.TokenCommand = token, "", "", nil
+	}
+	if url := os.Getenv("IMPROVMX_BASE_URL"); url != "" {
+		profile.BaseURL = url
+	}
+	if agent := os.Getenv("IMPROVMX_USER_AGENT"); agent != "" {
+		profile.UserAgent = agent
+	}
+	if value := os.Getenv("IMPROVMX_RETRIES"); value != "" {
+		retries, error := strconv.Atoi(value)
+		if error != nil {
+			return fmt.Errorf("invalid IMPROVMX_RETRIES: %w", error)
+		}
+		profile.Retries = retries
+	}
+	if value := os.Getenv("IMPROVMX_RATE_LIMIT"); value != "" {
+		rate, error := strconv.ParseFloat(value, 64)
+		if error != nil {
+			return fmt.Errorf("invalid IMPROVMX_RATE_LIMIT: %w", error)
+		}
+		profile.RateLimit = rate
+	}
+	return nil
+}
+
+func nonEmptyToken(value, source string) (string, error) {
+	if token := strings.TrimSpace(value); token != "" {
+		return token, nil
+	}
+	return "", fmt.Errorf("%s returned an empty token", source)
+}
+
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, error := os.UserHomeDir()
+	if error != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
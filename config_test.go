@@ -0,0 +1,186 @@
+package improvmx
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+default = "work"
+
+[profiles.work]
+token = "work-token"
+base_url = "https://example.com/v3/"
+user_agent = "acme"
+retries = 3
+retry_wait = "1s"
+rate_limit = 2.5
+burst = 4
+preflight = true
+
+[profiles.env]
+token_env = "TEST_IMPROVMX_TOKEN"
+
+[profiles.file]
+token_file = "token.txt"
+
+[profiles.command]
+token_command = ["echo", " command-token "]
+
+[profiles.ambiguous]
+token = "a"
+token_env = "B"
+`
+
+func writeConfig(t *testing.T, content string) string {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "config.toml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func clearEnvironment(t *testing.T) {
+	for _, name := range []string{"IMPROVMX_CONFIG", "IMPROVMX_PROFILE", "IMPROVMX_API_TOKEN", "IMPROVMX_BASE_URL", "IMPROVMX_USER_AGENT", "IMPROVMX_RETRIES", "IMPROVMX_RATE_LIMIT"} {
+		t.Setenv(name, "")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	clearEnvironment(t)
+	assert := assert.New(t)
+	config, error := LoadConfig(writeConfig(t, testConfig))
+	require.NoError(t, error)
+	assert.Equal("work", config.Default)
+	assert.Len(config.Profiles, 5)
+
+	profile, error := config.Profile("")
+	require.NoError(t, error)
+	assert.Equal(Profile{
+		Token:     "work-token",
+		BaseURL:   "https://example.com/v3/",
+		UserAgent: "acme",
+		Retries:   3,
+		RetryWait: time.Second,
+		RateLimit: 2.5,
+		Burst:     4,
+		Preflight: true,
+	}, *profile)
+	assert.Len(profile.Options(), 5)
+
+	_, error = config.Profile("missing")
+	assert.Error(error)
+
+	_, error = LoadConfig(writeConfig(t, "[profiles.work]\ntokn = \"typo\"\n"))
+	assert.ErrorContains(error, "profiles.work.tokn")
+}
+
+func TestProfileEnvironment(t *testing.T) {
+	clearEnvironment(t)
+	assert := assert.New(t)
+	config, error := LoadConfig(writeConfig(t, testConfig))
+	require.NoError(t, error)
+
+	t.Setenv("IMPROVMX_PROFILE", "command")
+	t.Setenv("IMPROVMX_BASE_URL", "http://localhost/")
+	t.Setenv("IMPROVMX_RETRIES", "5")
+	profile, error := config.Profile("")
+	require.NoError(t, error)
+	assert.Equal([]string{"echo", " command-token "}, profile.TokenCommand)
+	assert.Equal("http://localhost/", profile.BaseURL)
+	assert.Equal(5, profile.Retries)
+
+	t.Setenv("IMPROVMX_API_TOKEN", "override")
+	profile, error = config.Profile("command")
+	require.NoError(t, error)
+	assert.Equal("override", profile.Token)
+	assert.Empty(profile.TokenCommand)
+	profile, error = config.Profile("work")
+	require.NoError(t, error)
+	assert.Equal("override", profile.Token)
+	assert.Equal("acme", profile.UserAgent)
+	assert.Equal(4, profile.Burst)
+	assert.True(profile.Preflight)
+	_, error = config.Profile("missing")
+	assert.NoError(error)
+
+	t.Setenv("IMPROVMX_RATE_LIMIT", "fast")
+	_, error = config.Profile("")
+	assert.Error(error)
+}
+
+func TestResolveToken(t *testing.T) {
+	clearEnvironment(t)
+	assert := assert.New(t)
+	path := writeConfig(t, testConfig)
+	config, error := LoadConfig(path)
+	require.NoError(t, error)
+	resolve := func(name string) (string, string) {
+		profile := config.Profiles[name]
+		token, error := profile.ResolveToken(context.Background())
+		if error != nil {
+			return "", error.Error()
+		}
+		return token, ""
+	}
+
+	token, failure := resolve("work")
+	assert.Empty(failure)
+	assert.Equal("work-token", token)
+
+	_, failure = resolve("env")
+	assert.Equal("TEST_IMPROVMX_TOKEN is not set", failure)
+	t.Setenv("TEST_IMPROVMX_TOKEN", "env-token")
+	token, failure = resolve("env")
+	assert.Empty(failure)
+	assert.Equal("env-token", token)
+
+	tokenPath := filepath.Join(filepath.Dir(path), "token.txt")
+	require.NoError(t, os.WriteFile(tokenPath, []byte("file-token\n"), 0o600))
+	config.Profiles["file"] = Profile{TokenFile: tokenPath}
+	token, failure = resolve("file")
+	assert.Empty(failure)
+	assert.Equal("file-token", token)
+
+	token, failure = resolve("command")
+	assert.Empty(failure)
+	assert.Equal("command-token", token)
+
+	_, failure = resolve("ambiguous")
+	assert.Contains(failure, "only one of")
+	_, failure = resolve("missing")
+	assert.Equal("no API token configured", failure)
+}
+
+func TestNewFromConfig(t *testing.T) {
+	clearEnvironment(t)
+	assert := assert.New(t)
+	path := writeConfig(t, testConfig)
+	session, error := NewFromConfig(context.Background(), path, "work")
+	require.NoError(t, error)
+	assert.Equal("https://example.com/v3", session.client.HostURL)
+
+	t.Setenv("IMPROVMX_CONFIG", path)
+	session, error = NewFromConfig(context.Background(), "", "", WithBaseURL("http://localhost/"))
+	require.NoError(t, error)
+	assert.Equal("http://localhost", session.client.HostURL)
+
+	t.Setenv("IMPROVMX_CONFIG", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	_, error = NewFromConfig(context.Background(), "", "")
+	assert.Error(error)
+	t.Setenv("IMPROVMX_API_TOKEN", "token")
+	session, error = NewFromConfig(context.Background(), "", "")
+	require.NoError(t, error)
+	assert.Equal(strings.TrimSuffix(BaseURLv3, "/"), session.client.HostURL)
+
+	_, error = NewFromConfig(context.Background(), filepath.Join(t.TempDir(), "missing.toml"), "")
+	assert.Error(error)
+}
@@ -2,7 +2,11 @@ package improvmx
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"strconv"
+	"strings"
 
 	"occult.work/doze"
 )
@@ -20,15 +24,75 @@ type Domain struct {
 	Aliases           []Alias `json:"aliases"`
 }
 
+// The result of checking a single DNS record of a domain.
 type DomainRecord struct {
+	Expected RecordValues `json:"expected"`
+	Valid    bool         `json:"valid"`
+	Values   RecordValues `json:"values"`
 }
 
+// The DNS records of a domain as checked by the ImprovMX REST API.
+type DomainCheck struct {
+	Provider string       `json:"provider"`
+	Advanced bool         `json:"advanced"`
+	DKIM1    DomainRecord `json:"dkim1"`
+	DKIM2    DomainRecord `json:"dkim2"`
+	DMARC    DomainRecord `json:"dmarc"`
+	MX       DomainRecord `json:"mx"`
+	SPF      DomainRecord `json:"spf"`
+	Error    string       `json:"error"`
+	Valid    bool         `json:"valid"`
+}
+
+// The values of a DomainRecord. The ImprovMX REST API returns either a single
+// string, a list of strings, or null, all of which are unmarshaled into a
+// slice.
+type RecordValues []string
+
 // Used for creating or updating a domain entry.
 type DomainOption struct {
 	Email string `json:"notification_email,omitempty"`
 	Label string `json:"whitelabel,omitempty"`
 }
 
+// Controls how DomainEndpoint.Clone copies aliases.
+type CloneOption struct {
+	// Returns the name of the target alias for each source alias. Returning an
+	// empty string skips the alias. By default, names are kept as-is.
+	Rename func(alias string) string
+	// Returns the forward address of the target alias for each recipient of a
+	// source alias. Returning an empty string drops the recipient. By default,
+	// addresses are kept as-is.
+	Rewrite func(address string) string
+	// Updates target aliases that forward elsewhere, instead of reporting them
+	// as conflicts.
+	Overwrite bool
+}
+
+// The outcome of DomainEndpoint.Clone.
+type CloneResult struct {
+	// Whether the target domain had to be created
+	DomainCreated bool
+	// Target aliases that were created
+	Created []Alias
+	// Target aliases that were overwritten. See CloneOption.Overwrite
+	Updated []Alias
+	// Target aliases that already forwarded to the wanted address
+	Unchanged []Alias
+	// Names of source aliases skipped by CloneOption.Rename, or left without
+	// recipients by CloneOption.Rewrite
+	Skipped []string
+	// Target aliases that already existed and forward elsewhere
+	Conflicts []CloneConflict
+}
+
+// A target alias that already exists and forwards to a different address.
+type CloneConflict struct {
+	Alias    string
+	Existing string
+	Wanted   string
+}
+
 // Returns a slice of domain information for the session.
 //
 // If multiple *ListOption are passed, only the first one is used.
@@ -101,8 +165,7 @@ func (endpoint *DomainEndpoint) Logs(ctx context.Context, domain string) ([]LogE
 // See the API reference for more information: https://improvmx.com/api/#domains-add
 func (endpoint *DomainEndpoint) Create(ctx context.Context, domain string, options ...DomainOption) (*Domain, error) {
 	request := endpoint.inner().Request(ctx, &domainResponse{}).
-		SetPathParameter("domain", domain).
-		SetBody(getDomainOption(options...))
+		SetBody(domainCreateRequest{domain, getDomainOption(options...)})
 	if response, error := request.Post(domainCreatePath); error != nil {
 		return nil, error
 	} else {
@@ -147,21 +210,168 @@ func (endpoint *DomainEndpoint) Delete(ctx context.Context, domain string) error
 	return error
 }
 
+// Checks the DNS records of the given domain, and returns the expected and
+// current values of each.
+//
+// See the API reference for more information: https://improvmx.com/api/#domain-check
+func (endpoint *DomainEndpoint) Check(ctx context.Context, domain string) (*DomainCheck, error) {
+	request := endpoint.inner().Request(ctx, &domainCheckResponse{}).
+		SetPathParameter("domain", domain)
+	if response, error := request.Get(domainVerifyPath); error != nil {
+		return nil, error
+	} else {
+		return &(response.(*domainCheckResponse)).Records, nil
+	}
+}
+
 // Check if the MX entries are valid for a given domain. No error is returned
 // if the entries are valid.
 //
-// NOTE: This currently only returns an error if the domain information is not
-// valid, however this is because we are swallowing the actual JSON output
-// returned by the ImprovMX REST API. At some point in the future, Verify will
-// be a wrapper around another function that returns the actual deserialized
-// data.
+// NOTE: This currently only returns an error if the domain information could
+// not be retrieved. Use Check to inspect the validity of each record.
 func (endpoint *DomainEndpoint) Verify(ctx context.Context, domain string) error {
-	request := endpoint.inner().Request(ctx, make(map[string]interface{})).
-		SetPathParameter("domain", domain)
-	_, error := request.Get(domainVerifyPath)
+	_, error := endpoint.Check(ctx, domain)
 	return error
 }
 
+// Returns each record of the check, keyed by its name as used by the ImprovMX
+// REST API (e.g., "mx" or "dkim1").
+func (check *DomainCheck) Records() map[string]DomainRecord {
+	return map[string]DomainRecord{
+		"dkim1": check.DKIM1,
+		"dkim2": check.DKIM2,
+		"dmarc": check.DMARC,
+		"mx":    check.MX,
+		"spf":   check.SPF,
+	}
+}
+
+func (values *RecordValues) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if error := json.Unmarshal(data, &value); error != nil {
+		return error
+	}
+	switch value := value.(type) {
+	case nil:
+		*values = nil
+	case string:
+		*values = RecordValues{value}
+	case []interface{}:
+		result := make(RecordValues, 0, len(value))
+		for _, item := range value {
+			text, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("unexpected record value: %v", item)
+			}
+			result = append(result, text)
+		}
+		*values = result
+	default:
+		return fmt.Errorf("unexpected record values: %s", string(data))
+	}
+	return nil
+}
+
+// Copies every alias of the source domain to the target domain. If the target
+// domain does not exist, it is created with the notification email and
+// whitelabel of the source domain. If more than one CloneOption is passed to
+// the function, it will be ignored.
+//
+// Copying continues when a single alias fails, in which case the result is
+// still returned alongside an error for every failed alias.
+func (endpoint *DomainEndpoint) Clone(ctx context.Context, source, target string, options ...CloneOption) (*CloneResult, error) {
+	var failures []error
+	option := CloneOption{}
+	if len(options) != 0 {
+		option = options[0]
+	}
+	aliases := (*AliasEndpoint)(endpoint)
+	origin, error := endpoint.Read(ctx, source)
+	if error != nil {
+		return nil, error
+	}
+	result := &CloneResult{}
+	if _, error := endpoint.Read(ctx, target); isNotFound(error) {
+		if _, error := endpoint.Create(ctx, target, DomainOption{origin.NotificationEmail, origin.Whitelabel}); error != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", target, error)
+		}
+		result.DomainCreated = true
+	} else if error != nil {
+		return nil, error
+	}
+	sources, error := aliases.List(ctx, source)
+	if error != nil {
+		return nil, error
+	}
+	// ImprovMX creates a default alias along with the domain, so the aliases
+	// of the target are listed even if it was just created. A dry run does not
+	// create it, in which case it has none.
+	existing := make(map[string]Alias)
+	current, error := aliases.List(ctx, target)
+	if error != nil && !(result.DomainCreated && isNotFound(error)) {
+		return nil, error
+	}
+	for _, alias := range current {
+		existing[alias.Name] = alias
+	}
+	creates := 0
+	for _, alias := range sources {
+		if name, address := option.apply(alias); name != "" && address != "" {
+			if _, ok := existing[name]; !ok {
+				creates++
+			}
+		}
+	}
+	ctx = withPlan(ctx, Need{Aliases: map[string]int{target: creates}})
+	for _, alias := range sources {
+		name, address := option.apply(alias)
+		if name == "" || address == "" {
+			result.Skipped = append(result.Skipped, alias.Name)
+			continue
+		}
+		current, ok := existing[name]
+		switch {
+		case !ok:
+			created, error := aliases.Create(ctx, target, name, address)
+			if error != nil {
+				failures = append(failures, fmt.Errorf("failed to create %s@%s: %w", name, target, error))
+				continue
+			}
+			result.Created = append(result.Created, *created)
+		case normalizeAddress(current.Address) == normalizeAddress(address):
+			result.Unchanged = append(result.Unchanged, current)
+		case option.Overwrite:
+			updated, error := aliases.Update(ctx, target, name, address)
+			if error != nil {
+				failures = append(failures, fmt.Errorf("failed to update %s@%s: %w", name, target, error))
+				continue
+			}
+			result.Updated = append(result.Updated, *updated)
+		default:
+			result.Conflicts = append(result.Conflicts, CloneConflict{name, current.Address, address})
+		}
+	}
+	return result, errors.Join(failures...)
+}
+
+// Returns the target name and address of the given source alias.
+func (option CloneOption) apply(alias Alias) (string, string) {
+	name := alias.Name
+	if option.Rename != nil {
+		name = option.Rename(name)
+	}
+	if option.Rewrite == nil {
+		return name, alias.Address
+	}
+	var recipients []string
+	for _, recipient := range strings.Split(alias.Address, ",") {
+		if rewritten := option.Rewrite(strings.TrimSpace(recipient)); rewritten != "" {
+			recipients = append(recipients, rewritten)
+		}
+	}
+	return name, strings.Join(recipients, ",")
+}
+
 // getDomainOption returns either a default DomainOption *or* the first
 // parameter passed in the variadic arguments.
 func getDomainOption(options ...DomainOption) DomainOption {
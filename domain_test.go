@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -28,6 +29,7 @@ func (suite *DomainTestSuite) SetupSuite() {
 		Get(domainReadPath, suite.FileResponseHandler("testdata/domain/read.json")).
 		Post(domainCreatePath, func(writer http.ResponseWriter, request *http.Request) {
 			suite.Require().Equal(request.URL.Path, "/domains/")
+			suite.Require().Equal("example.com", suite.Parameters(request)["domain"])
 			domain := Domain{
 				Active: true, Name: "example.com"}
 			data, error := json.Marshal(domain)
@@ -165,6 +167,18 @@ func (suite *DomainTestSuite) TestVerify() {
 	suite.Require().NoError(error)
 }
 
+func (suite *DomainTestSuite) TestCheck() {
+	check, error := suite.session.Domains.Check(context.Background(), "piedpiper.com")
+	suite.Require().NoError(error)
+	suite.False(check.Valid)
+	suite.Equal("cloudflare", check.Provider)
+	suite.True(check.MX.Valid)
+	suite.Equal(RecordValues{"mx1.improvmx.com", "mx2.improvmx.com"}, check.MX.Expected)
+	suite.Equal(RecordValues{"v=spf1 include:example.com ~all"}, check.SPF.Values)
+	suite.Empty(check.DMARC.Values)
+	suite.Len(check.Records(), 5)
+}
+
 func (suite *DomainErrorTestSuite) TestLogs() {
 	logs, error := suite.session.Domains.Logs(context.Background(), "example.com")
 	suite.Require().Error(error)
@@ -194,3 +208,66 @@ func (suite *DomainErrorTestSuite) TestUpdate() {
 	suite.Require().Error(error)
 	suite.Require().Nil(domain)
 }
+
+func TestDomainClone(t *testing.T) {
+	assert := assert.New(t)
+	account, session := newFakeAccount(t)
+	main := account.addDomain("piedpiper.com",
+		"richard=richard@piedpiper.com",
+		"jared=jared@piedpiper.com, donald@example.com",
+		"*=inbox@piedpiper.com")
+	main.option = DomainOption{"admin@piedpiper.com", "piedpiper"}
+	ctx := context.Background()
+
+	result, error := session.Domains.Clone(ctx, "piedpiper.com", "piperchat.com", CloneOption{
+		Rewrite: func(address string) string {
+			return strings.Replace(address, "@piedpiper.com", "@piperchat.com", 1)
+		},
+	})
+	assert.NoError(error)
+	assert.True(result.DomainCreated)
+	assert.Len(result.Created, 2)
+	assert.Equal([]CloneConflict{{"*", "admin@piedpiper.com", "inbox@piperchat.com"}}, result.Conflicts)
+	assert.Equal([]string{
+		"*=admin@piedpiper.com",
+		"jared=jared@piperchat.com,donald@example.com",
+		"richard=richard@piperchat.com",
+	}, account.aliases("piperchat.com"))
+	domain, error := session.Domains.Read(ctx, "piperchat.com")
+	assert.NoError(error)
+	assert.Equal("admin@piedpiper.com", domain.NotificationEmail)
+	assert.Equal("piedpiper", domain.Whitelabel)
+
+	account.addDomain("hooli.com", "richard=gavin@hooli.com", "jared=jared@piedpiper.com,donald@example.com")
+	result, error = session.Domain("piedpiper.com").Clone(ctx, "hooli.com", CloneOption{
+		Rename: func(alias string) string {
+			if alias == "*" {
+				return ""
+			}
+			return alias
+		},
+	})
+	assert.NoError(error)
+	assert.False(result.DomainCreated)
+	assert.Empty(result.Created)
+	assert.Equal([]string{"*"}, result.Skipped)
+	assert.Len(result.Unchanged, 1)
+	assert.Equal([]CloneConflict{{"richard", "gavin@hooli.com", "richard@piedpiper.com"}}, result.Conflicts)
+
+	account.fail(http.MethodPut, "/domains/hooli.com/aliases/richard/", http.StatusInternalServerError)
+	result, error = session.Domains.Clone(ctx, "piedpiper.com", "hooli.com", CloneOption{Overwrite: true})
+	assert.ErrorContains(error, "failed to update richard@hooli.com")
+	assert.Len(result.Created, 1)
+	result, error = session.Domains.Clone(ctx, "piedpiper.com", "hooli.com", CloneOption{Overwrite: true})
+	assert.NoError(error)
+	assert.Len(result.Updated, 1)
+	assert.Len(result.Unchanged, 2)
+	assert.Equal([]string{
+		"*=inbox@piedpiper.com",
+		"jared=jared@piedpiper.com,donald@example.com",
+		"richard=richard@piedpiper.com",
+	}, account.aliases("hooli.com"))
+
+	_, error = session.Domains.Clone(ctx, "example.com", "hooli.com")
+	assert.Error(error)
+}
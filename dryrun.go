@@ -0,0 +1,224 @@
+package improvmx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A request that a dry-run Session intercepted instead of sending. See
+// WithDryRun.
+type Mutation struct {
+	// The endpoint method that sent the request (e.g., "Aliases.Create"), or
+	// empty if the request does not correspond to a known endpoint.
+	Endpoint string
+	Method   string
+	// The path of the request, relative to the base URL of the session
+	Path string
+	// The JSON body of the request with passwords redacted, or empty if it had
+	// none
+	Body string
+}
+
+// Intercepts every request with a method other than GET, HEAD or OPTIONS,
+// records it as a Mutation, and answers it with a synthetic response, such as
+// the Alias that would have been created, so that callers keep running. Other
+// requests are sent as usual.
+//
+// Aliases and domains created, updated or deleted during the dry run are
+// reflected when read individually (e.g., by AliasEndpoint.Read), but not by
+// List. Everything below a deleted domain, such as its aliases, is reported as
+// not found. Call Session.Mutations to retrieve what would have been changed.
+// Hooks are told which requests are not sent by RequestInfo.DryRun.
+func WithDryRun() SessionOption {
+	return func(session *Session) error {
+		session.dryRun = &dryRun{resources: make(map[string][]byte)}
+		return nil
+	}
+}
+
+// Returns true if the session was created with WithDryRun.
+func (session *Session) DryRun() bool {
+	return session.dryRun != nil
+}
+
+// Returns the mutations intercepted so far by a dry-run session, in the order
+// they were made. Returns nil if the session is not a dry run.
+func (session *Session) Mutations() []Mutation {
+	if session.dryRun == nil {
+		return nil
+	}
+	session.dryRun.mutex.Lock()
+	defer session.dryRun.mutex.Unlock()
+	return append([]Mutation(nil), session.dryRun.mutations...)
+}
+
+// Returns the mutation as "METHOD path", followed by its body if any.
+func (mutation Mutation) String() string {
+	if mutation.Body == "" {
+		return mutation.Method + " " + mutation.Path
+	}
+	return mutation.Method + " " + mutation.Path + " " + mutation.Body
+}
+
+// The state of a dry run, shared by the transports of a session.
+type dryRun struct {
+	mutex     sync.Mutex
+	mutations []Mutation
+	// Maps the path of each resource modified during the dry run to its
+	// synthetic response, or to nil if it was deleted.
+	resources map[string][]byte
+}
+
+type dryRunTransport struct {
+	session *Session
+	state   *dryRun
+	next    http.RoundTripper
+}
+
+func (transport *dryRunTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	path := transport.session.relativePath(request)
+	if request.Method == http.MethodGet {
+		if body, ok := transport.state.resource(path); ok && body == nil {
+			return syntheticResponse(request, http.StatusNotFound, []byte(`{ "error": "Not found", "code": 404, "success": false }`)), nil
+		} else if ok {
+			return syntheticResponse(request, http.StatusOK, body), nil
+		}
+	}
+	if !mutates(request.Method) {
+		return transport.next.RoundTrip(request)
+	}
+	body := requestBody(request)
+	if request.Body != nil {
+		request.Body.Close()
+	}
+	operation, parameters, _ := findOperation(request.Method, path)
+	mutation := Mutation{operation.endpoint, request.Method, path, ""}
+	if len(body) != 0 {
+		mutation.Body = redactBody(body)
+	}
+	decoded := map[string]string{}
+	json.Unmarshal(body, &decoded)
+	resource, response := synthesize(operation.endpoint, path, parameters, decoded)
+	data, error := json.Marshal(response)
+	if error != nil {
+		return nil, error
+	}
+	transport.state.record(mutation, resource, data, strings.HasSuffix(operation.endpoint, ".Delete"))
+	return syntheticResponse(request, http.StatusOK, data), nil
+}
+
+// Returns true if a request with the given method and path is answered by the
+// dry run, rather than sent.
+func (state *dryRun) answers(method, path string) bool {
+	if mutates(method) || method != http.MethodGet {
+		return mutates(method)
+	}
+	_, ok := state.resource(path)
+	return ok
+}
+
+// Returns the synthetic response of the resource at path, if it was modified
+// during the dry run. The response is nil if the resource, or the resource it
+// belongs to, was deleted.
+func (state *dryRun) resource(path string) ([]byte, bool) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	if body, ok := state.resources[path]; ok {
+		return body, ok
+	}
+	for resource, body := range state.resources {
+		if body == nil && strings.HasPrefix(path, resource) {
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+func (state *dryRun) record(mutation Mutation, resource string, response []byte, deleted bool) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.mutations = append(state.mutations, mutation)
+	switch {
+	case resource == "":
+	case deleted:
+		for path := range state.resources {
+			if strings.HasPrefix(path, resource) {
+				delete(state.resources, path)
+			}
+		}
+		state.resources[resource] = nil
+	default:
+		state.resources[resource] = response
+	}
+}
+
+// Returns the response the ImprovMX REST API would plausibly send for the
+// mutation, and the path of the resource it modifies, if it can be read
+// individually.
+func synthesize(endpoint, path string, parameters, body map[string]string) (string, map[string]any) {
+	created := time.Now().UnixMilli()
+	switch endpoint {
+	case "Aliases.Create":
+		alias := map[string]any{"alias": body["alias"], "forward": body["forward"], "id": 0}
+		resource := fmt.Sprintf("/domains/%s/aliases/%s/", parameters["domain"], body["alias"])
+		return resource, map[string]any{"alias": alias, "success": true}
+	case "Aliases.Update":
+		alias := map[string]any{"alias": parameters["alias"], "forward": body["forward"], "id": 0}
+		return path, map[string]any{"alias": alias, "success": true}
+	case "Domains.Create":
+		domain := syntheticDomain(body["domain"], body, created)
+		return fmt.Sprintf("/domains/%s/", body["domain"]), map[string]any{"domain": domain, "success": true}
+	case "Domains.Update":
+		return path, map[string]any{"domain": syntheticDomain(parameters["domain"], body, created), "success": true}
+	case "Credentials.Create":
+		credential := map[string]any{"username": body["username"], "usage": 0, "created": created}
+		return "", map[string]any{"credential": credential, "success": true}
+	case "Credentials.Update":
+		credential := map[string]any{"username": parameters["username"], "usage": 0, "created": created}
+		return "", map[string]any{"credential": credential, "success": true}
+	case "Aliases.Delete", "Domains.Delete":
+		return path, map[string]any{"success": true}
+	}
+	return "", map[string]any{"success": true}
+}
+
+// Returns true if requests with the method modify the account.
+func mutates(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+func syntheticDomain(name string, body map[string]string, added int64) map[string]any {
+	return map[string]any{
+		"active":             false,
+		"domain":             name,
+		"display":            name,
+		"notification_email": body["notification_email"],
+		"white_label":        body["whitelabel"],
+		"added":              added,
+		"aliases":            []Alias{},
+	}
+}
+
+func syntheticResponse(request *http.Request, status int, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}
+}
@@ -0,0 +1,137 @@
+package improvmx
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"occult.work/doze/test"
+)
+
+type DryRunTestSuite struct {
+	test.Suite
+	mutex   sync.Mutex
+	infos   []RequestInfo
+	session *Session
+}
+
+func (suite *DryRunTestSuite) SetupSuite() {
+	sent := func(writer http.ResponseWriter, request *http.Request) {
+		suite.Fail("request was sent", "%s %s", request.Method, request.URL.Path)
+	}
+	router := test.NewRouter().
+		Get(accountReadPath, suite.FileResponseHandler("testdata/account/read.json")).
+		Get(domainReadPath, suite.FileResponseHandler("testdata/domain/read.json")).
+		Get(aliasListPath, suite.FileResponseHandler("testdata/alias/list.json")).
+		Get(aliasReadPath, suite.FileResponseHandler("testdata/alias/read.json")).
+		Post(domainCreatePath, sent).
+		Delete(domainDeletePath, sent).
+		Post(aliasCreatePath, sent).
+		Put(aliasUpdatePath, sent).
+		Delete(aliasDeletePath, sent).
+		Post(credentialsCreatePath, sent)
+	suite.Initialize(router)
+	suite.Data = &testData
+}
+
+func (suite *DryRunTestSuite) SetupTest() {
+	suite.infos = nil
+	suite.session, _ = New("dry-run-test-suite", WithBaseURL(suite.Server.URL), WithDryRun(), WithHooks(Hooks{
+		After: func(ctx context.Context, info *RequestInfo) {
+			suite.mutex.Lock()
+			defer suite.mutex.Unlock()
+			suite.infos = append(suite.infos, *info)
+		},
+	}))
+}
+
+func TestDryRun(t *testing.T) {
+	test.Run(t, new(DryRunTestSuite))
+}
+
+func (suite *DryRunTestSuite) TestMutations() {
+	ctx := context.Background()
+	suite.True(suite.session.DryRun())
+
+	alias, error := suite.session.Aliases.Create(ctx, "example.com", "jared", "jared@example.com")
+	suite.Require().NoError(error)
+	suite.Equal(Alias{Address: "jared@example.com", Name: "jared"}, *alias)
+	alias, error = suite.session.Aliases.Read(ctx, "example.com", "jared")
+	suite.Require().NoError(error)
+	suite.Equal("jared@example.com", alias.Address)
+
+	renamed, error := suite.session.Aliases.Rename(ctx, "example.com", "richard", "ceo")
+	suite.Require().NoError(error)
+	suite.Equal("richard.hendricks@example.com", renamed.Address)
+	_, error = suite.session.Aliases.Read(ctx, "example.com", "richard")
+	suite.True(isNotFound(error))
+
+	domain, error := suite.session.Domains.Create(ctx, "piperchat.com", DomainOption{Email: "admin@piperchat.com"})
+	suite.Require().NoError(error)
+	suite.Equal("piperchat.com", domain.Name)
+	suite.Equal("admin@piperchat.com", domain.NotificationEmail)
+	credential, error := suite.session.Credentials.Create(ctx, "example.com", User{"monica", "hunter2"})
+	suite.Require().NoError(error)
+	suite.Equal("monica", credential.Username)
+
+	_, error = (*resty.Client)(suite.session.client).R().SetContext(ctx).Patch("/domains/example.com/")
+	suite.NoError(error)
+
+	suite.Equal([]Mutation{
+		{"Aliases.Create", "POST", "/domains/example.com/aliases/", `{"alias":"jared","forward":"jared@example.com"}`},
+		{"Aliases.Create", "POST", "/domains/example.com/aliases/", `{"alias":"ceo","forward":"richard.hendricks@example.com"}`},
+		{"Aliases.Delete", "DELETE", "/domains/example.com/aliases/richard/", ""},
+		{"Domains.Create", "POST", "/domains/", `{"domain":"piperchat.com","notification_email":"admin@piperchat.com"}`},
+		{"Credentials.Create", "POST", "/domains/example.com/credentials/", `{"password":"[REDACTED]","username":"monica"}`},
+		{"", "PATCH", "/domains/example.com/", ""},
+	}, suite.session.Mutations())
+	suite.Equal("DELETE /domains/example.com/aliases/richard/", suite.session.Mutations()[2].String())
+
+	session, error := New("token", WithBaseURL(suite.Server.URL))
+	suite.Require().NoError(error)
+	suite.False(session.DryRun())
+	suite.Nil(session.Mutations())
+}
+
+func (suite *DryRunTestSuite) TestDeleteDomain() {
+	ctx := context.Background()
+	_, error := suite.session.Aliases.Create(ctx, "example.com", "jared", "jared@example.com")
+	suite.Require().NoError(error)
+	suite.Require().NoError(suite.session.Domains.Delete(ctx, "example.com"))
+
+	_, error = suite.session.Domains.Read(ctx, "example.com")
+	suite.True(isNotFound(error))
+	_, error = suite.session.Aliases.Read(ctx, "example.com", "jared")
+	suite.True(isNotFound(error))
+	_, error = suite.session.Aliases.Read(ctx, "example.com", "richard")
+	suite.True(isNotFound(error))
+	_, error = suite.session.Aliases.List(ctx, "example.com")
+	suite.True(isNotFound(error))
+
+	alias, error := suite.session.Aliases.Read(ctx, "example.org", "richard")
+	suite.Require().NoError(error)
+	suite.Equal("richard", alias.Name)
+}
+
+func (suite *DryRunTestSuite) TestHooks() {
+	ctx := context.Background()
+	metrics := &recordingMetrics{make(map[string]int), make(map[string]int)}
+	session, error := New("token", WithBaseURL(suite.Server.URL), WithDryRun(), WithHooks(MetricsHooks(metrics)))
+	suite.Require().NoError(error)
+	for _, session := range []*Session{suite.session, session} {
+		_, error = session.Aliases.Read(ctx, "example.com", "richard")
+		suite.Require().NoError(error)
+		suite.Require().NoError(session.Aliases.Delete(ctx, "example.com", "richard"))
+		_, error = session.Aliases.Read(ctx, "example.com", "richard")
+		suite.True(isNotFound(error))
+	}
+
+	dryRuns := make([]bool, len(suite.infos))
+	for index, info := range suite.infos {
+		dryRuns[index] = info.DryRun
+	}
+	suite.Equal([]bool{false, true, true}, dryRuns)
+	suite.Equal(map[string]int{"Aliases.Read GET 200 false": 1}, metrics.requests)
+}
@@ -0,0 +1,129 @@
+package improvmx
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Makes sure the domain exists with the given options, creating or updating it
+// only when needed. Only the non-empty fields of the DomainOption are compared
+// against the current state. Returns the domain, and whether a change was made.
+//
+// If another creator adds the domain concurrently, the resulting "already
+// exists" error is treated as success, and the domain is updated if needed.
+func (session *Session) EnsureDomain(ctx context.Context, name string, options ...DomainOption) (*Domain, bool, error) {
+	option := getDomainOption(options...)
+	domain, error := session.Domains.Read(ctx, name)
+	if isNotFound(error) {
+		domain, error = session.Domains.Create(ctx, name, option)
+		if error == nil {
+			return domain, true, nil
+		}
+		if !isAlreadyExists(error) {
+			return nil, false, error
+		}
+		domain, error = session.Domains.Read(ctx, name)
+	}
+	if error != nil {
+		return nil, false, error
+	}
+	if domainMatches(domain, option) {
+		return domain, false, nil
+	}
+	domain, error = session.Domains.Update(ctx, name, option)
+	if error != nil {
+		return nil, false, error
+	}
+	return domain, true, nil
+}
+
+// Makes sure the alias of the given domain exists and forwards to address,
+// creating or updating it only when needed. Addresses are compared ignoring
+// case, whitespace and the order of comma separated recipients. Returns the
+// alias, and whether a change was made.
+//
+// If another creator adds the alias concurrently, the resulting "already
+// exists" error is treated as success, and the alias is updated if needed.
+func (session *Session) EnsureAlias(ctx context.Context, domain, alias, address string) (*Alias, bool, error) {
+	current, error := session.Aliases.Read(ctx, domain, alias)
+	if isNotFound(error) {
+		current, error = session.Aliases.Create(ctx, domain, alias, address)
+		if error == nil {
+			return current, true, nil
+		}
+		if !isAlreadyExists(error) {
+			return nil, false, error
+		}
+		current, error = session.Aliases.Read(ctx, domain, alias)
+	}
+	if error != nil {
+		return nil, false, error
+	}
+	if normalizeAddress(current.Address) == normalizeAddress(address) {
+		return current, false, nil
+	}
+	current, error = session.Aliases.Update(ctx, domain, alias, address)
+	if error != nil {
+		return nil, false, error
+	}
+	return current, true, nil
+}
+
+// Makes sure the SMTP credential of the given domain exists, creating it only
+// when needed. Returns the credential, and whether a change was made.
+//
+// The ImprovMX REST API does not reveal passwords, so the password of an
+// existing credential is left untouched. Use Credentials.Update to rotate it.
+// If another creator adds the credential concurrently, the resulting "already
+// exists" error is treated as success.
+func (session *Session) EnsureCredential(ctx context.Context, domain string, user User) (*Credential, bool, error) {
+	credential, error := session.findCredential(ctx, domain, user.Username)
+	if error != nil || credential != nil {
+		return credential, false, error
+	}
+	credential, error = session.Credentials.Create(ctx, domain, user)
+	if error == nil {
+		return credential, true, nil
+	}
+	if !isAlreadyExists(error) {
+		return nil, false, error
+	}
+	if credential, error = session.findCredential(ctx, domain, user.Username); credential == nil && error == nil {
+		return nil, false, &Error{Message: "credential reported as existing but not listed", Code: http.StatusConflict}
+	}
+	return credential, false, error
+}
+
+// Returns the credential with the given username, or nil if there is none.
+func (session *Session) findCredential(ctx context.Context, domain, username string) (*Credential, error) {
+	credentials, error := session.Credentials.List(ctx, domain)
+	if error != nil {
+		return nil, error
+	}
+	for index := range credentials {
+		if strings.EqualFold(credentials[index].Username, username) {
+			return &credentials[index], nil
+		}
+	}
+	return nil, nil
+}
+
+func domainMatches(domain *Domain, option DomainOption) bool {
+	if option.Email != "" && !strings.EqualFold(option.Email, domain.NotificationEmail) {
+		return false
+	}
+	return option.Label == "" || option.Label == domain.Whitelabel
+}
+
+// Returns the address with its comma separated recipients trimmed, lowercased
+// and sorted.
+func normalizeAddress(address string) string {
+	recipients := strings.Split(address, ",")
+	for index, recipient := range recipients {
+		recipients[index] = strings.ToLower(strings.TrimSpace(recipient))
+	}
+	sort.Strings(recipients)
+	return strings.Join(recipients, ",")
+}
@@ -0,0 +1,208 @@
+package improvmx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"occult.work/doze/test"
+)
+
+// Keeps the state of a single fake account, so that Ensure operations can be
+// run repeatedly against it.
+type EnsureTestSuite struct {
+	test.Suite
+	session     *Session
+	domains     map[string]DomainOption
+	aliases     map[string]string
+	credentials map[string]bool
+	// Creates the resource before rejecting the create request, as a racing
+	// creator would.
+	racing bool
+	writes int
+}
+
+func (suite *EnsureTestSuite) SetupSuite() {
+	notFound := func(writer http.ResponseWriter) {
+		writer.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(writer, `{ "error": "Not found", "code": 404, "success": false }`)
+	}
+	exists := func(writer http.ResponseWriter) {
+		writer.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(writer, `{ "error": "This resource already exists", "code": 400, "success": false }`)
+	}
+	writeDomain := func(writer http.ResponseWriter, name string) {
+		option := suite.domains[name]
+		json.NewEncoder(writer).Encode(map[string]any{
+			"domain":  map[string]any{"domain": name, "notification_email": option.Email, "white_label": option.Label},
+			"success": true,
+		})
+	}
+	writeAlias := func(writer http.ResponseWriter, name string) {
+		fmt.Fprintf(writer, `{ "alias": { "alias": %q, "forward": %q, "id": 1 }, "success": true }`, name, suite.aliases[name])
+	}
+	router := test.NewRouter().
+		Get(domainReadPath, func(writer http.ResponseWriter, request *http.Request) {
+			name := path.Base(request.URL.Path)
+			if _, ok := suite.domains[name]; !ok {
+				notFound(writer)
+				return
+			}
+			writeDomain(writer, name)
+		}).
+		Post(domainCreatePath, func(writer http.ResponseWriter, request *http.Request) {
+			option := DomainOption{}
+			json.NewDecoder(request.Body).Decode(&option)
+			suite.writes++
+			suite.domains["example.com"] = option
+			if suite.racing {
+				exists(writer)
+				return
+			}
+			writeDomain(writer, "example.com")
+		}).
+		Put(domainUpdatePath, func(writer http.ResponseWriter, request *http.Request) {
+			option := DomainOption{}
+			json.NewDecoder(request.Body).Decode(&option)
+			suite.writes++
+			name := path.Base(request.URL.Path)
+			suite.domains[name] = option
+			writeDomain(writer, name)
+		}).
+		Get(aliasReadPath, func(writer http.ResponseWriter, request *http.Request) {
+			name := path.Base(request.URL.Path)
+			if _, ok := suite.aliases[name]; !ok {
+				notFound(writer)
+				return
+			}
+			writeAlias(writer, name)
+		}).
+		Post(aliasCreatePath, func(writer http.ResponseWriter, request *http.Request) {
+			parameters := suite.Parameters(request)
+			suite.writes++
+			suite.aliases[parameters["alias"]] = parameters["forward"]
+			if suite.racing {
+				exists(writer)
+				return
+			}
+			writeAlias(writer, parameters["alias"])
+		}).
+		Put(aliasUpdatePath, func(writer http.ResponseWriter, request *http.Request) {
+			name := path.Base(request.URL.Path)
+			suite.writes++
+			suite.aliases[name] = suite.Parameters(request)["forward"]
+			writeAlias(writer, name)
+		}).
+		Get(credentialsListPath, func(writer http.ResponseWriter, request *http.Request) {
+			credentials := []map[string]any{}
+			for username := range suite.credentials {
+				credentials = append(credentials, map[string]any{"username": username, "usage": 0, "created": 1581604970000})
+			}
+			json.NewEncoder(writer).Encode(map[string]any{"credentials": credentials, "success": true})
+		}).
+		Post(credentialsCreatePath, func(writer http.ResponseWriter, request *http.Request) {
+			parameters := suite.Parameters(request)
+			suite.writes++
+			suite.credentials[parameters["username"]] = true
+			if suite.racing {
+				exists(writer)
+				return
+			}
+			fmt.Fprintf(writer, `{ "credential": { "username": %q, "usage": 0, "created": 1581604970000 }, "success": true }`, parameters["username"])
+		})
+	suite.Initialize(router)
+	suite.Data = &testData
+	suite.session = setupSession(suite.Server)
+}
+
+func (suite *EnsureTestSuite) SetupTest() {
+	suite.domains = make(map[string]DomainOption)
+	suite.aliases = make(map[string]string)
+	suite.credentials = make(map[string]bool)
+	suite.racing = false
+	suite.writes = 0
+}
+
+func TestEnsure(t *testing.T) {
+	test.Run(t, new(EnsureTestSuite))
+}
+
+func (suite *EnsureTestSuite) TestEnsureDomain() {
+	ctx := context.Background()
+	domain, changed, error := suite.session.EnsureDomain(ctx, "example.com", DomainOption{Email: "admin@example.com"})
+	suite.Require().NoError(error)
+	suite.True(changed)
+	suite.Equal("admin@example.com", domain.NotificationEmail)
+
+	_, changed, error = suite.session.EnsureDomain(ctx, "example.com", DomainOption{Email: "ADMIN@example.com"})
+	suite.Require().NoError(error)
+	suite.False(changed)
+	_, changed, error = suite.session.EnsureDomain(ctx, "example.com")
+	suite.Require().NoError(error)
+	suite.False(changed)
+
+	domain, changed, error = suite.session.Domain("example.com").Ensure(ctx, DomainOption{Email: "ops@example.com"})
+	suite.Require().NoError(error)
+	suite.True(changed)
+	suite.Equal("ops@example.com", domain.NotificationEmail)
+	suite.Equal(2, suite.writes)
+}
+
+func (suite *EnsureTestSuite) TestEnsureAlias() {
+	ctx := context.Background()
+	alias, changed, error := suite.session.EnsureAlias(ctx, "example.com", "richard", "richard@example.com, jared@example.com")
+	suite.Require().NoError(error)
+	suite.True(changed)
+	suite.Equal("richard", alias.Name)
+
+	_, changed, error = suite.session.EnsureAlias(ctx, "example.com", "richard", "Jared@example.com,richard@example.com")
+	suite.Require().NoError(error)
+	suite.False(changed)
+
+	alias, changed, error = suite.session.Domain("example.com").Aliases().Ensure(ctx, "richard", "monica@example.com")
+	suite.Require().NoError(error)
+	suite.True(changed)
+	suite.Equal("monica@example.com", alias.Address)
+	suite.Equal(2, suite.writes)
+}
+
+func (suite *EnsureTestSuite) TestEnsureCredential() {
+	ctx := context.Background()
+	credential, changed, error := suite.session.EnsureCredential(ctx, "example.com", User{"richard", "hunter2"})
+	suite.Require().NoError(error)
+	suite.True(changed)
+	suite.Equal("richard", credential.Username)
+
+	_, changed, error = suite.session.Domain("example.com").Credentials().Ensure(ctx, User{"richard", "hunter3"})
+	suite.Require().NoError(error)
+	suite.False(changed)
+	suite.Equal(1, suite.writes)
+}
+
+func (suite *EnsureTestSuite) TestRacingCreator() {
+	ctx := context.Background()
+	suite.racing = true
+	_, changed, error := suite.session.EnsureDomain(ctx, "example.com")
+	suite.NoError(error)
+	suite.False(changed)
+
+	alias, changed, error := suite.session.EnsureAlias(ctx, "example.com", "richard", "richard@example.com")
+	suite.Require().NoError(error)
+	suite.False(changed)
+	suite.Equal("richard@example.com", alias.Address)
+
+	credential, changed, error := suite.session.EnsureCredential(ctx, "example.com", User{"richard", "hunter2"})
+	suite.Require().NoError(error)
+	suite.False(changed)
+	suite.Equal("richard", credential.Username)
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("a@example.com,b@example.com", normalizeAddress(" B@example.com,a@EXAMPLE.com "))
+	assert.Equal("", normalizeAddress(""))
+}
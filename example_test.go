@@ -2,6 +2,7 @@ package improvmx_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 
@@ -42,16 +43,10 @@ func Example_credentials() {
 	if error != nil {
 		log.Fatal(error)
 	}
-	ctx := context.Background()
-	account, error := session.Account.Read(ctx)
-	if error != nil {
-		log.Fatal(error)
-	}
-	if !account.Premium {
+	credentials, error := session.Credentials.List(context.Background(), "example.com")
+	if errors.Is(error, improvmx.ErrPremiumRequired) {
 		log.Fatal("SMTP Credentials are a premium account feature")
-	}
-	credentials, error := session.Credentials.List(ctx, "example.com")
-	if error != nil {
+	} else if error != nil {
 		log.Fatal(error)
 	}
 	for _, credential := range credentials {
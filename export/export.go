@@ -0,0 +1,177 @@
+// Package export writes ImprovMX log entries and events as CSV or JSON Lines.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"occult.work/improvmx"
+)
+
+// A single LogEntry, tagged with the domain it was retrieved from.
+type Record struct {
+	Domain string            `json:"domain"`
+	Entry  improvmx.LogEntry `json:"entry"`
+}
+
+// Implemented by every exporter in this package. Close must be called once
+// all records are written, and does not close the underlying io.Writer.
+type Writer interface {
+	Write(record Record) error
+	Close() error
+}
+
+// Writes one CSV row per LogEntry.
+type EntryCSVWriter struct {
+	writer *csv.Writer
+	header bool
+}
+
+// Writes one CSV row per LogEvent, repeating the identifying columns of the
+// LogEntry it belongs to.
+type EventCSVWriter struct {
+	writer *csv.Writer
+	header bool
+}
+
+// Writes one JSON object per line for each Record.
+type JSONLinesWriter struct {
+	encoder *json.Encoder
+}
+
+// The columns written by EntryCSVWriter
+var EntryColumns = []string{
+	"domain", "id", "created", "status", "sender", "sender_name", "recipient",
+	"recipient_name", "forward", "forward_name", "subject", "message_id",
+	"hostname", "transport", "events",
+}
+
+// The columns written by EventCSVWriter
+var EventColumns = []string{
+	"domain", "entry_id", "message_id", "sender", "recipient", "subject",
+	"event_id", "created", "status", "code", "message", "server", "local",
+}
+
+func NewEntryCSVWriter(writer io.Writer) *EntryCSVWriter {
+	return &EntryCSVWriter{writer: csv.NewWriter(writer)}
+}
+
+func NewEventCSVWriter(writer io.Writer) *EventCSVWriter {
+	return &EventCSVWriter{writer: csv.NewWriter(writer)}
+}
+
+func NewJSONLinesWriter(writer io.Writer) *JSONLinesWriter {
+	return &JSONLinesWriter{encoder: json.NewEncoder(writer)}
+}
+
+// Returns the Writer for the given format, which is one of "csv",
+// "events-csv", or "jsonl".
+func NewWriter(format string, writer io.Writer) (Writer, error) {
+	switch format {
+	case "csv":
+		return NewEntryCSVWriter(writer), nil
+	case "events-csv":
+		return NewEventCSVWriter(writer), nil
+	case "jsonl", "ndjson":
+		return NewJSONLinesWriter(writer), nil
+	}
+	return nil, fmt.Errorf("unknown export format: %q", format)
+}
+
+// Writes every record to writer, and closes it.
+func WriteAll(writer Writer, records ...Record) error {
+	for _, record := range records {
+		if error := writer.Write(record); error != nil {
+			return error
+		}
+	}
+	return writer.Close()
+}
+
+// Returns a Record for each entry, tagged with the given domain.
+func Records(domain string, entries ...improvmx.LogEntry) []Record {
+	records := make([]Record, len(entries))
+	for index, entry := range entries {
+		records[index] = Record{Domain: domain, Entry: entry}
+	}
+	return records
+}
+
+func (writer *EntryCSVWriter) Write(record Record) error {
+	if !writer.header {
+		writer.header = true
+		if error := writer.writer.Write(EntryColumns); error != nil {
+			return error
+		}
+	}
+	entry := record.Entry
+	return writer.writer.Write([]string{
+		record.Domain,
+		entry.ID,
+		entry.CreatedAt,
+		string(entry.FinalStatus()),
+		entry.Sender.Email,
+		entry.Sender.Name,
+		entry.Recipient.Email,
+		entry.Recipient.Name,
+		entry.Address.Email,
+		entry.Address.Name,
+		entry.Subject,
+		entry.MessageID,
+		entry.Hostname,
+		entry.Transport,
+		strconv.Itoa(len(entry.Events)),
+	})
+}
+
+func (writer *EntryCSVWriter) Close() error {
+	writer.writer.Flush()
+	return writer.writer.Error()
+}
+
+func (writer *EventCSVWriter) Write(record Record) error {
+	if !writer.header {
+		writer.header = true
+		if error := writer.writer.Write(EventColumns); error != nil {
+			return error
+		}
+	}
+	entry := record.Entry
+	for _, event := range entry.Events {
+		error := writer.writer.Write([]string{
+			record.Domain,
+			entry.ID,
+			entry.MessageID,
+			entry.Sender.Email,
+			entry.Recipient.Email,
+			entry.Subject,
+			event.ID,
+			event.CreatedAt,
+			string(event.Status),
+			strconv.FormatInt(event.Code, 10),
+			event.Message,
+			event.Server,
+			event.Local,
+		})
+		if error != nil {
+			return error
+		}
+	}
+	return nil
+}
+
+func (writer *EventCSVWriter) Close() error {
+	writer.writer.Flush()
+	return writer.writer.Error()
+}
+
+func (writer *JSONLinesWriter) Write(record Record) error {
+	return writer.encoder.Encode(record)
+}
+
+func (writer *JSONLinesWriter) Close() error {
+	return nil
+}
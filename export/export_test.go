@@ -0,0 +1,69 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"occult.work/improvmx"
+)
+
+func loadRecords(t *testing.T) []Record {
+	data, error := os.ReadFile("../testdata/alias/logs.json")
+	assert.NoError(t, error)
+	response := struct{ Logs []improvmx.LogEntry }{}
+	assert.NoError(t, json.Unmarshal(data, &response))
+	return Records("piedpiper.com", response.Logs...)
+}
+
+func TestEntryCSVWriter(t *testing.T) {
+	assert := assert.New(t)
+	buffer := &bytes.Buffer{}
+	assert.NoError(WriteAll(NewEntryCSVWriter(buffer), loadRecords(t)...))
+	rows, error := csv.NewReader(buffer).ReadAll()
+	assert.NoError(error)
+	assert.Len(rows, 3)
+	assert.Equal(EntryColumns, rows[0])
+	assert.Equal("piedpiper.com", rows[1][0])
+	assert.Equal("DELIVERED", rows[1][3])
+	assert.Equal("REFUSED", rows[2][3])
+}
+
+func TestEventCSVWriter(t *testing.T) {
+	assert := assert.New(t)
+	buffer := &bytes.Buffer{}
+	assert.NoError(WriteAll(NewEventCSVWriter(buffer), loadRecords(t)...))
+	rows, error := csv.NewReader(buffer).ReadAll()
+	assert.NoError(error)
+	assert.Len(rows, 4)
+	assert.Equal(EventColumns, rows[0])
+	assert.Equal("QUEUED", rows[1][8])
+	assert.Equal("550", rows[3][9])
+}
+
+func TestJSONLinesWriter(t *testing.T) {
+	assert := assert.New(t)
+	buffer := &bytes.Buffer{}
+	records := loadRecords(t)
+	assert.NoError(WriteAll(NewJSONLinesWriter(buffer), records...))
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	assert.Len(lines, 2)
+	record := Record{}
+	assert.NoError(json.Unmarshal([]byte(lines[1]), &record))
+	assert.Equal(records[1], record)
+}
+
+func TestNewWriter(t *testing.T) {
+	assert := assert.New(t)
+	for _, format := range []string{"csv", "events-csv", "jsonl"} {
+		writer, error := NewWriter(format, &bytes.Buffer{})
+		assert.NoError(error)
+		assert.NotNil(writer)
+	}
+	_, error := NewWriter("xml", &bytes.Buffer{})
+	assert.Error(error)
+}
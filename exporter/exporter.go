@@ -0,0 +1,324 @@
+// Package exporter collects the state of an ImprovMX account, and exposes it
+// as Prometheus metrics in the text exposition format.
+//
+// The Collector is an http.Handler, and serves the most recent collection.
+// Collections are expensive, as they require several requests per domain, so
+// they are performed periodically by Run rather than on every scrape.
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"occult.work/improvmx"
+)
+
+// Collects metrics from an ImprovMX account.
+type Collector struct {
+	session *improvmx.Session
+	options Options
+	now     func() time.Time
+
+	mutex    sync.Mutex
+	latest   *exposition
+	statuses map[statusKey]float64
+	// The creation time of each log entry counted, by key
+	seen map[string]time.Time
+}
+
+// Configures what a Collector gathers. Each additional kind of metric costs at
+// least one request per domain on every collection.
+type Options struct {
+	// Collects verification results for every DNS record of each domain.
+	Records bool
+	// Collects usage of each SMTP credential. Ignored for non-premium
+	// accounts.
+	Credentials bool
+	// Counts new log entries of each domain by their final status.
+	Logs bool
+	// Log entries created longer ago than this are neither counted nor
+	// remembered. Should exceed how long the ImprovMX REST API returns log
+	// entries for. Defaults to DefaultLogLookback.
+	LogLookback time.Duration
+	// Restricts collection to the given domains. Defaults to every domain.
+	Domains []string
+	// Request metrics served alongside the collected metrics, if not nil.
+	Requests *RequestMetrics
+}
+
+// The default value of Options.LogLookback.
+const DefaultLogLookback = 30 * 24 * time.Hour
+
+// The metrics describing a collection itself, rather than the account.
+var collectionMetrics = []string{
+	"improvmx_up",
+	"improvmx_collection_duration_seconds",
+	"improvmx_collection_timestamp_seconds",
+}
+
+type statusKey struct {
+	domain string
+	status improvmx.MessageStatus
+}
+
+func NewCollector(session *improvmx.Session, options Options) *Collector {
+	if options.LogLookback <= 0 {
+		options.LogLookback = DefaultLogLookback
+	}
+	return &Collector{
+		session:  session,
+		options:  options,
+		now:      time.Now,
+		statuses: make(map[statusKey]float64),
+		seen:     make(map[string]time.Time),
+	}
+}
+
+// Performs a collection immediately, and then every interval until ctx is
+// done. Failed collections are exposed through the improvmx_up metric, and
+// passed to report if it is not nil.
+func (collector *Collector) Run(ctx context.Context, interval time.Duration, report func(error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if error := collector.Collect(ctx); error != nil && report != nil {
+			report(error)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Performs a single collection, replacing the metrics served by the
+// Collector. If the collection fails, the metrics of the previous collection
+// are kept, and improvmx_up is set to 0.
+func (collector *Collector) Collect(ctx context.Context) error {
+	start := collector.now()
+	metrics := newExposition()
+	error := collector.collect(ctx, metrics)
+	up := 1.0
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	if error != nil {
+		up = 0
+		metrics = collector.latest.without(collectionMetrics...)
+	}
+	end := collector.now()
+	metrics.gauge("improvmx_up", "Whether the last collection succeeded.", up)
+	metrics.gauge("improvmx_collection_duration_seconds", "Duration of the last collection.", end.Sub(start).Seconds())
+	metrics.gauge("improvmx_collection_timestamp_seconds", "Time of the last collection.", float64(end.UnixNano())/1e9)
+	collector.latest = metrics
+	return error
+}
+
+// Serves the metrics of the most recent collection.
+func (collector *Collector) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	collector.mutex.Lock()
+	latest := collector.latest
+	collector.mutex.Unlock()
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if latest == nil {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if requests := collector.options.Requests; requests != nil {
+		latest = latest.without()
+		requests.expose(latest)
+	}
+	latest.WriteTo(writer)
+}
+
+func (collector *Collector) collect(ctx context.Context, metrics *exposition) error {
+	session := collector.session
+	account, error := session.Account.Read(ctx)
+	if error != nil {
+		return error
+	}
+	premium := 0.0
+	if account.Premium {
+		premium = 1
+	}
+	metrics.gauge("improvmx_account_premium", "Whether the account is on a premium plan.", premium)
+	limits := map[string]int{
+		"aliases":      account.Limits.Aliases,
+		"daily_quota":  account.Limits.DailyQuota,
+		"domains":      account.Limits.Domains,
+		"ratelimit":    account.Limits.RateLimit,
+		"redirections": account.Limits.Redirections,
+		"subdomains":   account.Limits.Subdomains,
+	}
+	for _, resource := range sortedKeys(limits) {
+		metrics.gauge("improvmx_account_limit", "Limits of the account plan.", float64(limits[resource]), "resource", resource)
+	}
+
+	domains, error := session.Domains.List(ctx)
+	if error != nil {
+		return error
+	}
+	domains = collector.filter(domains)
+	metrics.gauge("improvmx_domains", "Number of domains in the account.", float64(len(domains)))
+	total := 0
+	for _, domain := range domains {
+		active := 0.0
+		if domain.Active {
+			active = 1
+		}
+		metrics.gauge("improvmx_domain_active", "Whether the domain is active.", active, "domain", domain.Name)
+		aliases, error := session.Aliases.List(ctx, domain.Name)
+		if error != nil {
+			return error
+		}
+		total += len(aliases)
+		metrics.gauge("improvmx_domain_aliases", "Number of aliases of the domain.", float64(len(aliases)), "domain", domain.Name)
+	}
+	metrics.gauge("improvmx_aliases", "Number of aliases across all domains.", float64(total))
+	if account.Limits.Aliases > 0 {
+		metrics.gauge("improvmx_aliases_limit_ratio", "Number of aliases relative to the account alias limit.", float64(total)/float64(account.Limits.Aliases))
+	}
+	if account.Limits.Domains > 0 {
+		metrics.gauge("improvmx_domains_limit_ratio", "Number of domains relative to the account domain limit.", float64(len(domains))/float64(account.Limits.Domains))
+	}
+
+	if collector.options.Logs {
+		collector.forget(collector.now().Add(-collector.options.LogLookback))
+	}
+	for _, domain := range domains {
+		if collector.options.Records {
+			if error := collectRecords(ctx, session, metrics, domain.Name); error != nil {
+				return error
+			}
+		}
+		if collector.options.Credentials && account.Premium {
+			credentials, error := session.Credentials.List(ctx, domain.Name)
+			if error != nil {
+				return error
+			}
+			for _, credential := range credentials {
+				metrics.gauge("improvmx_credential_usage", "Usage of the SMTP credential.", float64(credential.Usage), "domain", domain.Name, "username", credential.Username)
+			}
+		}
+		if collector.options.Logs {
+			if error := collector.collectLogs(ctx, domain.Name); error != nil {
+				return error
+			}
+		}
+	}
+	if collector.options.Logs {
+		collector.mutex.Lock()
+		keys := make([]statusKey, 0, len(collector.statuses))
+		for key := range collector.statuses {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i].domain != keys[j].domain {
+				return keys[i].domain < keys[j].domain
+			}
+			return keys[i].status < keys[j].status
+		})
+		for _, key := range keys {
+			metrics.counter("improvmx_log_entries_total", "Log entries observed, by their final status.", collector.statuses[key], "domain", key.domain, "status", string(key.status))
+		}
+		collector.mutex.Unlock()
+	}
+	return nil
+}
+
+func collectRecords(ctx context.Context, session *improvmx.Session, metrics *exposition, domain string) error {
+	check, error := session.Domains.Check(ctx, domain)
+	if error != nil {
+		return error
+	}
+	valid := 0.0
+	if check.Valid {
+		valid = 1
+	}
+	metrics.gauge("improvmx_domain_valid", "Whether every DNS record of the domain is valid.", valid, "domain", domain)
+	records := check.Records()
+	for _, name := range sortedKeys(records) {
+		valid := 0.0
+		if records[name].Valid {
+			valid = 1
+		}
+		metrics.gauge("improvmx_domain_record_valid", "Whether the DNS record of the domain is valid.", valid, "domain", domain, "record", name)
+	}
+	return nil
+}
+
+func (collector *Collector) collectLogs(ctx context.Context, domain string) error {
+	entries, error := collector.session.Domains.Logs(ctx, domain)
+	if error != nil {
+		return error
+	}
+	now := collector.now()
+	cutoff := now.Add(-collector.options.LogLookback)
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	for index := range entries {
+		entry := &entries[index]
+		key := entry.ID
+		if key == "" {
+			key = entry.MessageID + "@" + entry.CreatedAt
+		}
+		status := entry.FinalStatus()
+		// Entries still in flight are counted once they reach a terminal state
+		if !status.IsTerminal() {
+			continue
+		}
+		created, error := entry.Created()
+		if error != nil {
+			created = now
+		}
+		if created.Before(cutoff) {
+			continue
+		}
+		if _, ok := collector.seen[key]; ok {
+			continue
+		}
+		collector.seen[key] = created
+		collector.statuses[statusKey{domain, status}]++
+	}
+	return nil
+}
+
+// Forgets the log entries created before cutoff, which are no longer counted.
+func (collector *Collector) forget(cutoff time.Time) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	for key, created := range collector.seen {
+		if created.Before(cutoff) {
+			delete(collector.seen, key)
+		}
+	}
+}
+
+func (collector *Collector) filter(domains []improvmx.Domain) []improvmx.Domain {
+	if len(collector.options.Domains) == 0 {
+		return domains
+	}
+	var filtered []improvmx.Domain
+	for _, domain := range domains {
+		for _, name := range collector.options.Domains {
+			if strings.EqualFold(domain.Name, name) {
+				filtered = append(filtered, domain)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+func sortedKeys[T any](values map[string]T) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,164 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"occult.work/improvmx"
+)
+
+// Serves the files of the testdata directory in place of the ImprovMX REST API.
+func newServer(t *testing.T, failures *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if *failures > 0 {
+			*failures--
+			writer.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(writer, `{ "error": "fake error", "code": 500, "success": false }`)
+			return
+		}
+		path := request.URL.Path
+		var file string
+		switch {
+		case path == "/account/":
+			file = "account/read.json"
+		case path == "/domains/":
+			file = "domain/list.json"
+		case strings.HasSuffix(path, "/aliases/"):
+			file = "alias/list.json"
+		case strings.HasSuffix(path, "/check/"):
+			file = "domain/verify.json"
+		case strings.HasSuffix(path, "/logs/"):
+			file = "domain/logs.json"
+		case strings.HasSuffix(path, "/credentials/"):
+			writer.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(writer, `{ "credentials": [{ "created": 1581604970000, "usage": 42, "username": "richard" }], "success": true }`)
+			return
+		default:
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		data, error := os.ReadFile("../testdata/" + file)
+		assert.NoError(t, error)
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write(data)
+	}))
+}
+
+func scrape(collector *Collector) (int, string) {
+	recorder := httptest.NewRecorder()
+	collector.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	return recorder.Code, recorder.Body.String()
+}
+
+func TestCollector(t *testing.T) {
+	assert := assert.New(t)
+	failures := 0
+	server := newServer(t, &failures)
+	defer server.Close()
+	session, error := improvmx.New("token", improvmx.WithBaseURL(server.URL))
+	assert.NoError(error)
+
+	collector := NewCollector(session, Options{Records: true, Credentials: true, Logs: true, Domains: []string{"piedpiper.com"}})
+	now := time.Date(2020, 1, 26, 0, 0, 0, 0, time.UTC)
+	collector.now = func() time.Time { return now }
+	code, _ := scrape(collector)
+	assert.Equal(http.StatusServiceUnavailable, code)
+
+	assert.NoError(collector.Collect(context.Background()))
+	code, body := scrape(collector)
+	assert.Equal(http.StatusOK, code)
+	for _, line := range []string{
+		"# TYPE improvmx_domains gauge",
+		"improvmx_up 1",
+		"improvmx_account_premium 1",
+		`improvmx_account_limit{resource="aliases"} 10000`,
+		"improvmx_domains 1",
+		`improvmx_domain_aliases{domain="piedpiper.com"} 10`,
+		"improvmx_aliases 10",
+		"improvmx_aliases_limit_ratio 0.001",
+		`improvmx_domain_valid{domain="piedpiper.com"} 0`,
+		`improvmx_domain_record_valid{domain="piedpiper.com",record="mx"} 1`,
+		`improvmx_domain_record_valid{domain="piedpiper.com",record="spf"} 0`,
+		`improvmx_credential_usage{domain="piedpiper.com",username="richard"} 42`,
+		"# TYPE improvmx_log_entries_total counter",
+		`improvmx_log_entries_total{domain="piedpiper.com",status="DELIVERED"} 2`,
+		`improvmx_log_entries_total{domain="piedpiper.com",status="REFUSED"} 1`,
+	} {
+		assert.Contains(body, line+"\n")
+	}
+
+	assert.NoError(collector.Collect(context.Background()))
+	_, body = scrape(collector)
+	assert.Contains(body, `improvmx_log_entries_total{domain="piedpiper.com",status="DELIVERED"} 2`+"\n")
+	assert.Len(collector.seen, 3)
+
+	now = now.Add(DefaultLogLookback)
+	assert.NoError(collector.Collect(context.Background()))
+	_, body = scrape(collector)
+	assert.Contains(body, `improvmx_log_entries_total{domain="piedpiper.com",status="DELIVERED"} 2`+"\n")
+	assert.Empty(collector.seen)
+
+	failures = 1
+	assert.Error(collector.Collect(context.Background()))
+	_, body = scrape(collector)
+	assert.Contains(body, "improvmx_up 0\n")
+	assert.Contains(body, "improvmx_aliases 10\n")
+	assert.Equal(1, strings.Count(body, "# TYPE improvmx_up gauge"))
+}
+
+func TestExposition(t *testing.T) {
+	assert := assert.New(t)
+	metrics := newExposition()
+	metrics.gauge("test_metric", "A help\nstring.", 1.5, "label", `a "quoted" \ value`)
+	metrics.counter("test_total", "Counter.", 3)
+	builder := &strings.Builder{}
+	_, error := metrics.WriteTo(builder)
+	assert.NoError(error)
+	assert.Equal(`# HELP test_metric A help\nstring.
+# TYPE test_metric gauge
+test_metric{label="a \"quoted\" \\ value"} 1.5
+# HELP test_total Counter.
+# TYPE test_total counter
+test_total 3
+`, builder.String())
+	assert.Empty(metrics.without("test_metric", "test_total").order)
+}
+
+func TestRequestMetrics(t *testing.T) {
+	assert := assert.New(t)
+	failures := 0
+	server := newServer(t, &failures)
+	defer server.Close()
+	requests := NewRequestMetrics(0.5, 0.1)
+	session, error := improvmx.New("token",
+		improvmx.WithBaseURL(server.URL),
+		improvmx.WithHooks(improvmx.MetricsHooks(requests)))
+	assert.NoError(error)
+
+	collector := NewCollector(session, Options{Domains: []string{"piedpiper.com"}, Requests: requests})
+	assert.NoError(collector.Collect(context.Background()))
+	_, body := scrape(collector)
+	for _, line := range []string{
+		`improvmx_requests_total{endpoint="Account.Read",failed="false",method="GET",status="200"} 1`,
+		`improvmx_requests_total{endpoint="Aliases.List",failed="false",method="GET",status="200"} 2`,
+		"# TYPE improvmx_request_duration_seconds histogram",
+		`improvmx_request_duration_seconds_bucket{endpoint="Domains.List",le="+Inf",method="GET"} 1`,
+		`improvmx_request_duration_seconds_bucket{endpoint="Domains.List",le="0.1",method="GET"} 1`,
+		`improvmx_request_duration_seconds_count{endpoint="Domains.List",method="GET"} 1`,
+	} {
+		assert.Contains(body, line+"\n")
+	}
+
+	failures = 1
+	assert.Error(collector.Collect(context.Background()))
+	builder := &strings.Builder{}
+	requests.WriteTo(builder)
+	assert.Contains(builder.String(), `improvmx_requests_total{endpoint="Account.Read",failed="true",method="GET",status="500"} 1`)
+}
@@ -0,0 +1,147 @@
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	gauge     = "gauge"
+	counter   = "counter"
+	histogram = "histogram"
+)
+
+// A single metric family in the Prometheus text exposition format.
+type family struct {
+	name    string
+	help    string
+	kind    string
+	samples []sample
+}
+
+type sample struct {
+	// Appended to the family name, such as _bucket for histograms
+	suffix string
+	labels map[string]string
+	value  float64
+}
+
+// Accumulates metric families, and writes them in the Prometheus text
+// exposition format.
+type exposition struct {
+	families map[string]*family
+	order    []string
+}
+
+func newExposition() *exposition {
+	return &exposition{families: make(map[string]*family)}
+}
+
+// Returns a copy of the exposition without the named families. A nil
+// exposition results in an empty one.
+func (exposition *exposition) without(names ...string) *exposition {
+	result := newExposition()
+	if exposition == nil {
+		return result
+	}
+	excluded := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		excluded[name] = struct{}{}
+	}
+	for _, name := range exposition.order {
+		if _, ok := excluded[name]; ok {
+			continue
+		}
+		result.families[name] = exposition.families[name]
+		result.order = append(result.order, name)
+	}
+	return result
+}
+
+func (exposition *exposition) add(name, kind, help string, value float64, labels ...string) {
+	exposition.addSuffixed(name, "", kind, help, value, labels...)
+}
+
+func (exposition *exposition) addSuffixed(name, suffix, kind, help string, value float64, labels ...string) {
+	current, ok := exposition.families[name]
+	if !ok {
+		current = &family{name: name, help: help, kind: kind}
+		exposition.families[name] = current
+		exposition.order = append(exposition.order, name)
+	}
+	pairs := make(map[string]string, len(labels)/2)
+	for index := 0; index+1 < len(labels); index += 2 {
+		pairs[labels[index]] = labels[index+1]
+	}
+	current.samples = append(current.samples, sample{suffix, pairs, value})
+}
+
+func (exposition *exposition) gauge(name, help string, value float64, labels ...string) {
+	exposition.add(name, gauge, help, value, labels...)
+}
+
+func (exposition *exposition) counter(name, help string, value float64, labels ...string) {
+	exposition.add(name, counter, help, value, labels...)
+}
+
+func (exposition *exposition) WriteTo(writer io.Writer) (int64, error) {
+	var builder strings.Builder
+	for _, name := range exposition.order {
+		current := exposition.families[name]
+		fmt.Fprintf(&builder, "# HELP %s %s\n", name, escapeHelp(current.help))
+		fmt.Fprintf(&builder, "# TYPE %s %s\n", name, current.kind)
+		for _, sample := range current.samples {
+			builder.WriteString(name)
+			builder.WriteString(sample.suffix)
+			writeLabels(&builder, sample.labels)
+			builder.WriteByte(' ')
+			builder.WriteString(formatValue(sample.value))
+			builder.WriteByte('\n')
+		}
+	}
+	written, error := io.WriteString(writer, builder.String())
+	return int64(written), error
+}
+
+func writeLabels(builder *strings.Builder, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	builder.WriteByte('{')
+	for index, key := range keys {
+		if index > 0 {
+			builder.WriteByte(',')
+		}
+		fmt.Fprintf(builder, `%s="%s"`, key, escapeLabel(labels[key]))
+	}
+	builder.WriteByte('}')
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(value)
+}
+
+func escapeHelp(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,147 @@
+package exporter
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The default latency histogram buckets, in seconds.
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Implements improvmx.Metrics, and exposes request counts and latency
+// histograms in the Prometheus text exposition format. Use it with
+// improvmx.MetricsHooks, and either serve it directly or pass it to a
+// Collector through Options.Requests.
+type RequestMetrics struct {
+	buckets    []float64
+	mutex      sync.Mutex
+	counts     map[requestKey]float64
+	histograms map[latencyKey]*latency
+}
+
+type requestKey struct {
+	endpoint string
+	method   string
+	status   int
+	failed   bool
+}
+
+type latencyKey struct {
+	endpoint string
+	method   string
+}
+
+type latency struct {
+	counts []float64
+	sum    float64
+	total  float64
+}
+
+// Returns RequestMetrics using the given histogram buckets, in seconds. If no
+// buckets are given, DefaultBuckets is used.
+func NewRequestMetrics(buckets ...float64) *RequestMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := make([]float64, len(buckets))
+	copy(sorted, buckets)
+	sort.Float64s(sorted)
+	return &RequestMetrics{
+		buckets:    sorted,
+		counts:     make(map[requestKey]float64),
+		histograms: make(map[latencyKey]*latency),
+	}
+}
+
+func (metrics *RequestMetrics) IncrementRequests(endpoint, method string, status int, failed bool) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.counts[requestKey{endpoint, method, status, failed}]++
+}
+
+func (metrics *RequestMetrics) ObserveLatency(endpoint, method string, duration time.Duration) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	key := latencyKey{endpoint, method}
+	current, ok := metrics.histograms[key]
+	if !ok {
+		current = &latency{counts: make([]float64, len(metrics.buckets))}
+		metrics.histograms[key] = current
+	}
+	seconds := duration.Seconds()
+	for index, bound := range metrics.buckets {
+		if seconds <= bound {
+			current.counts[index]++
+		}
+	}
+	current.sum += seconds
+	current.total++
+}
+
+// Serves the request metrics.
+func (metrics *RequestMetrics) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.WriteTo(writer)
+}
+
+func (metrics *RequestMetrics) WriteTo(writer io.Writer) (int64, error) {
+	exposition := newExposition()
+	metrics.expose(exposition)
+	return exposition.WriteTo(writer)
+}
+
+func (metrics *RequestMetrics) expose(exposition *exposition) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	requests := make([]requestKey, 0, len(metrics.counts))
+	for key := range metrics.counts {
+		requests = append(requests, key)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		a, b := requests[i], requests[j]
+		if a.endpoint != b.endpoint {
+			return a.endpoint < b.endpoint
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		if a.status != b.status {
+			return a.status < b.status
+		}
+		return !a.failed && b.failed
+	})
+	for _, key := range requests {
+		exposition.counter("improvmx_requests_total", "Requests sent to the ImprovMX REST API.", metrics.counts[key],
+			"endpoint", key.endpoint,
+			"method", key.method,
+			"status", strconv.Itoa(key.status),
+			"failed", strconv.FormatBool(key.failed))
+	}
+	latencies := make([]latencyKey, 0, len(metrics.histograms))
+	for key := range metrics.histograms {
+		latencies = append(latencies, key)
+	}
+	sort.Slice(latencies, func(i, j int) bool {
+		if latencies[i].endpoint != latencies[j].endpoint {
+			return latencies[i].endpoint < latencies[j].endpoint
+		}
+		return latencies[i].method < latencies[j].method
+	})
+	const name = "improvmx_request_duration_seconds"
+	const help = "Latency of requests sent to the ImprovMX REST API."
+	for _, key := range latencies {
+		current := metrics.histograms[key]
+		for index, bound := range metrics.buckets {
+			exposition.addSuffixed(name, "_bucket", histogram, help, current.counts[index],
+				"endpoint", key.endpoint, "method", key.method, "le", formatValue(bound))
+		}
+		exposition.addSuffixed(name, "_bucket", histogram, help, current.total,
+			"endpoint", key.endpoint, "method", key.method, "le", "+Inf")
+		exposition.addSuffixed(name, "_sum", histogram, help, current.sum, "endpoint", key.endpoint, "method", key.method)
+		exposition.addSuffixed(name, "_count", histogram, help, current.total, "endpoint", key.endpoint, "method", key.method)
+	}
+}
@@ -0,0 +1,257 @@
+package improvmx
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// An in-memory ImprovMX account, serving the subset of the ImprovMX REST API
+// needed to test operations made of several requests.
+type fakeAccount struct {
+	mutex   sync.Mutex
+	domains map[string]*fakeDomain
+	// Maps "METHOD path" to the status code the request fails with, once.
+	failures map[string]int
+	// Like failures, but the request is applied before its response fails.
+	losses map[string]int
+	nextID int64
+}
+
+type fakeDomain struct {
+	option      DomainOption
+	aliases     map[string]Alias
+	credentials map[string]string
+}
+
+// Returns a fake account, and a session connected to it with the given
+// options.
+func newFakeAccount(t *testing.T, options ...SessionOption) (*fakeAccount, *Session) {
+	account := &fakeAccount{
+		domains:  make(map[string]*fakeDomain),
+		failures: make(map[string]int),
+		losses:   make(map[string]int),
+	}
+	server := httptest.NewServer(account)
+	t.Cleanup(server.Close)
+	session, error := New("token", append([]SessionOption{WithBaseURL(server.URL)}, options...)...)
+	if error != nil {
+		t.Fatal(error)
+	}
+	return account, session
+}
+
+// Adds a domain with the given aliases, as "name=address" pairs.
+func (account *fakeAccount) addDomain(name string, aliases ...string) *fakeDomain {
+	account.mutex.Lock()
+	defer account.mutex.Unlock()
+	domain := &fakeDomain{aliases: make(map[string]Alias), credentials: make(map[string]string)}
+	for _, pair := range aliases {
+		alias, address, _ := strings.Cut(pair, "=")
+		account.nextID++
+		domain.aliases[alias] = Alias{address, alias, account.nextID}
+	}
+	account.domains[name] = domain
+	return domain
+}
+
+// Fails the next request with the given method and path.
+func (account *fakeAccount) fail(method, path string, status int) {
+	account.mutex.Lock()
+	defer account.mutex.Unlock()
+	account.failures[method+" "+path] = status
+}
+
+// Applies the next request with the given method and path, but fails its
+// response, as when a connection drops after the request was handled.
+func (account *fakeAccount) lose(method, path string, status int) {
+	account.mutex.Lock()
+	defer account.mutex.Unlock()
+	account.losses[method+" "+path] = status
+}
+
+// Returns the aliases of the domain as "name=address" pairs, sorted by name.
+func (account *fakeAccount) aliases(domain string) []string {
+	account.mutex.Lock()
+	defer account.mutex.Unlock()
+	var pairs []string
+	if current, ok := account.domains[domain]; ok {
+		for name, alias := range current.aliases {
+			pairs = append(pairs, name+"="+alias.Address)
+		}
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+func (account *fakeAccount) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	account.mutex.Lock()
+	defer account.mutex.Unlock()
+	writer.Header().Set("Content-Type", "application/json")
+	key := request.Method + " " + request.URL.Path
+	if status, ok := account.failures[key]; ok {
+		delete(account.failures, key)
+		writeFakeError(writer, status, http.StatusText(status))
+		return
+	}
+	if status, ok := account.losses[key]; ok {
+		delete(account.losses, key)
+		account.serve(httptest.NewRecorder(), request)
+		writeFakeError(writer, status, http.StatusText(status))
+		return
+	}
+	account.serve(writer, request)
+}
+
+func (account *fakeAccount) serve(writer http.ResponseWriter, request *http.Request) {
+	body := map[string]string{}
+	json.NewDecoder(request.Body).Decode(&body)
+	segments := splitPath(request.URL.Path)
+	if segments[0] != "domains" {
+		writeFakeError(writer, http.StatusNotFound, "Not found")
+		return
+	}
+	if len(segments) == 1 {
+		account.serveDomains(writer, request.Method, body)
+		return
+	}
+	domain, ok := account.domains[segments[1]]
+	if !ok {
+		writeFakeError(writer, http.StatusNotFound, "Domain not found")
+		return
+	}
+	switch {
+	case len(segments) == 2:
+		account.serveDomain(writer, request.Method, segments[1], body)
+	case len(segments) == 3 && segments[2] == "aliases":
+		account.serveAliases(writer, request.Method, domain, body)
+	case len(segments) == 4 && segments[2] == "aliases":
+		account.serveAlias(writer, request.Method, domain, segments[3], body)
+	default:
+		writeFakeError(writer, http.StatusNotFound, "Not found")
+	}
+}
+
+func (account *fakeAccount) serveDomains(writer http.ResponseWriter, method string, body map[string]string) {
+	switch method {
+	case http.MethodGet:
+		domains := make([]map[string]any, 0, len(account.domains))
+		for _, name := range sortedKeys(account.domains) {
+			domains = append(domains, account.domain(name))
+		}
+		writeFakeJSON(writer, map[string]any{"domains": domains, "total": len(domains), "page": 1, "success": true})
+	case http.MethodPost:
+		name := body["domain"]
+		if _, ok := account.domains[name]; ok {
+			writeFakeError(writer, http.StatusBadRequest, "This domain already exists")
+			return
+		}
+		domain := &fakeDomain{
+			option:      DomainOption{body["notification_email"], body["whitelabel"]},
+			aliases:     make(map[string]Alias),
+			credentials: make(map[string]string),
+		}
+		// Like ImprovMX, forwards every address of a new domain to its owner
+		if address := body["notification_email"]; address != "" {
+			account.nextID++
+			domain.aliases[CatchAllName] = Alias{address, CatchAllName, account.nextID}
+		}
+		account.domains[name] = domain
+		writeFakeJSON(writer, map[string]any{"domain": account.domain(name), "success": true})
+	default:
+		writeFakeError(writer, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (account *fakeAccount) serveDomain(writer http.ResponseWriter, method, name string, body map[string]string) {
+	switch method {
+	case http.MethodGet:
+		writeFakeJSON(writer, map[string]any{"domain": account.domain(name), "success": true})
+	case http.MethodPut:
+		account.domains[name].option = DomainOption{body["notification_email"], body["whitelabel"]}
+		writeFakeJSON(writer, map[string]any{"domain": account.domain(name), "success": true})
+	case http.MethodDelete:
+		delete(account.domains, name)
+		writeFakeJSON(writer, map[string]any{"success": true})
+	default:
+		writeFakeError(writer, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// Returns the domain as it would be sent by the ImprovMX REST API. A map is
+// used, as Time is not marshaled the way the ImprovMX REST API sends it.
+func (account *fakeAccount) domain(name string) map[string]any {
+	current := account.domains[name]
+	aliases := make([]Alias, 0, len(current.aliases))
+	for _, alias := range current.aliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i].Name < aliases[j].Name })
+	return map[string]any{
+		"active":             true,
+		"domain":             name,
+		"display":            name,
+		"notification_email": current.option.Email,
+		"white_label":        current.option.Label,
+		"added":              1559639733000,
+		"aliases":            aliases,
+	}
+}
+
+func (account *fakeAccount) serveAliases(writer http.ResponseWriter, method string, domain *fakeDomain, body map[string]string) {
+	switch method {
+	case http.MethodGet:
+		aliases := make([]Alias, 0, len(domain.aliases))
+		for _, alias := range domain.aliases {
+			aliases = append(aliases, alias)
+		}
+		sort.Slice(aliases, func(i, j int) bool { return aliases[i].Name < aliases[j].Name })
+		writeFakeJSON(writer, map[string]any{"aliases": aliases, "total": len(aliases), "page": 1, "success": true})
+	case http.MethodPost:
+		if _, ok := domain.aliases[body["alias"]]; ok {
+			writeFakeError(writer, http.StatusBadRequest, "This alias already exists")
+			return
+		}
+		account.nextID++
+		alias := Alias{body["forward"], body["alias"], account.nextID}
+		domain.aliases[alias.Name] = alias
+		writeFakeJSON(writer, map[string]any{"alias": alias, "success": true})
+	default:
+		writeFakeError(writer, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (account *fakeAccount) serveAlias(writer http.ResponseWriter, method string, domain *fakeDomain, name string, body map[string]string) {
+	alias, ok := domain.aliases[name]
+	if !ok {
+		writeFakeError(writer, http.StatusNotFound, "Alias not found")
+		return
+	}
+	switch method {
+	case http.MethodGet:
+		writeFakeJSON(writer, map[string]any{"alias": alias, "success": true})
+	case http.MethodPut:
+		alias.Address = body["forward"]
+		domain.aliases[name] = alias
+		writeFakeJSON(writer, map[string]any{"alias": alias, "success": true})
+	case http.MethodDelete:
+		delete(domain.aliases, name)
+		writeFakeJSON(writer, map[string]any{"success": true})
+	default:
+		writeFakeError(writer, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func writeFakeJSON(writer http.ResponseWriter, value any) {
+	json.NewEncoder(writer).Encode(value)
+}
+
+func writeFakeError(writer http.ResponseWriter, status int, message string) {
+	writer.WriteHeader(status)
+	fmt.Fprintf(writer, `{ "error": %q, "code": %d, "success": false }`, message, status)
+}
@@ -0,0 +1,232 @@
+package forwarding
+
+import (
+	"sort"
+	"strings"
+)
+
+// The default maximum number of hops used by Analyze.
+const DefaultMaxHops = 3
+
+// The forwarding graph of an account, where every alias is a node, and every
+// recipient on a domain of the account is an edge to the alias handling it,
+// which is either the alias of the same name or the catch-all alias "*".
+type Graph struct {
+	// Maps "name@domain" to the alias, with lowercased keys
+	aliases map[string]Entry
+	// Maps each domain of the account to whether it is active
+	domains map[string]bool
+	edges   map[string][]string
+	nodes   []string
+}
+
+// A path through the graph longer than the maximum number of hops.
+type Chain struct {
+	// The alias, and every address the message is forwarded through, ending
+	// either with an address outside of the account or once the maximum number
+	// of hops is exceeded.
+	Path []string
+}
+
+// An alias forwarding to an alias of an inactive domain, which ImprovMX does
+// not forward further.
+type InactiveTarget struct {
+	// The forwarding alias, as "name@domain"
+	Source string
+	// The recipient of the forwarding alias
+	Recipient string
+	// The alias handling the recipient, as "name@domain"
+	Target string
+}
+
+// The findings of Analyze.
+type Report struct {
+	// Each cycle is a sorted set of aliases forwarding to one another.
+	Cycles [][]string
+	// Chains longer than the maximum number of hops, one per starting alias
+	Chains   []Chain
+	Inactive []InactiveTarget
+}
+
+// Returns the forwarding graph of the indexed aliases.
+func NewGraph(index *Index) *Graph {
+	graph := &Graph{
+		aliases: make(map[string]Entry),
+		domains: make(map[string]bool),
+		edges:   make(map[string][]string),
+	}
+	for _, entry := range index.entries {
+		key := strings.ToLower(entry.Alias.Name + "@" + entry.Domain)
+		graph.aliases[key] = entry
+		graph.domains[strings.ToLower(entry.Domain)] = entry.Active
+		graph.nodes = append(graph.nodes, key)
+	}
+	sort.Strings(graph.nodes)
+	for _, node := range graph.nodes {
+		for _, recipient := range graph.aliases[node].Alias.Recipients() {
+			if target, ok := graph.Resolve(recipient); ok {
+				graph.edges[node] = append(graph.edges[node], target)
+			}
+		}
+	}
+	return graph
+}
+
+// Returns the alias receiving mail sent to the address, as "name@domain", if
+// the address belongs to a domain of the account. The alias of the same name
+// takes precedence over the catch-all alias.
+func (graph *Graph) Resolve(address string) (string, bool) {
+	address = strings.ToLower(strings.TrimSpace(address))
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return "", false
+	}
+	if _, ok := graph.aliases[address]; ok {
+		return address, true
+	}
+	catchAll := "*" + address[at:]
+	if _, ok := graph.aliases[catchAll]; ok {
+		return catchAll, true
+	}
+	return "", false
+}
+
+// Returns the cycles, chains longer than maxHops, and aliases forwarding to
+// inactive domains. If maxHops is not positive, DefaultMaxHops is used.
+func (graph *Graph) Analyze(maxHops int) *Report {
+	if maxHops <= 0 {
+		maxHops = DefaultMaxHops
+	}
+	report := &Report{Cycles: graph.cycles()}
+	memo := make(map[string]hop)
+	for _, node := range graph.nodes {
+		if path := graph.longChain(node, maxHops, memo); path != nil {
+			report.Chains = append(report.Chains, Chain{path})
+		}
+		for _, recipient := range graph.aliases[node].Alias.Recipients() {
+			target, ok := graph.Resolve(recipient)
+			if !ok {
+				continue
+			}
+			if !graph.domains[strings.ToLower(graph.aliases[target].Domain)] {
+				report.Inactive = append(report.Inactive, InactiveTarget{node, recipient, target})
+			}
+		}
+	}
+	return report
+}
+
+// Returns the forwarding graph of the index, analyzed with the given maximum
+// number of hops. See Graph.Analyze
+func Analyze(index *Index, maxHops int) *Report {
+	return NewGraph(index).Analyze(maxHops)
+}
+
+// Returns the strongly connected components forming cycles, using Tarjan's
+// algorithm.
+func (graph *Graph) cycles() [][]string {
+	indices := make(map[string]int)
+	lowlinks := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var cycles [][]string
+	var connect func(node string)
+	connect = func(node string) {
+		indices[node] = len(indices)
+		lowlinks[node] = indices[node]
+		stack = append(stack, node)
+		onStack[node] = true
+		for _, target := range graph.edges[node] {
+			if _, visited := indices[target]; !visited {
+				connect(target)
+				lowlinks[node] = min(lowlinks[node], lowlinks[target])
+			} else if onStack[target] {
+				lowlinks[node] = min(lowlinks[node], indices[target])
+			}
+		}
+		if lowlinks[node] != indices[node] {
+			return
+		}
+		var component []string
+		for {
+			last := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[last] = false
+			component = append(component, last)
+			if last == node {
+				break
+			}
+		}
+		if len(component) > 1 || graph.loops(node) {
+			sort.Strings(component)
+			cycles = append(cycles, component)
+		}
+	}
+	for _, node := range graph.nodes {
+		if _, visited := indices[node]; !visited {
+			connect(node)
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+	return cycles
+}
+
+// Returns true if the alias forwards to itself.
+func (graph *Graph) loops(node string) bool {
+	for _, target := range graph.edges[node] {
+		if target == node {
+			return true
+		}
+	}
+	return false
+}
+
+// The longest path from an alias, as memoised by Graph.longest.
+type hop struct {
+	// The number of hops, including the last one to an address outside of the
+	// account
+	length int
+	// The next alias or address of the path, empty if the alias has no
+	// recipients
+	next string
+}
+
+// Returns the longest path from the alias, cut once it exceeds maxHops, or nil
+// if it does not exceed maxHops.
+func (graph *Graph) longChain(start string, maxHops int, memo map[string]hop) []string {
+	if graph.longest(start, memo, make(map[string]bool)).length <= maxHops {
+		return nil
+	}
+	path := []string{start}
+	for node := start; len(path)-1 <= maxHops; node = memo[node].next {
+		path = append(path, memo[node].next)
+	}
+	return path
+}
+
+// Returns the longest path from the alias that does not go through an active
+// alias, which is one being walked. Each alias is only walked once, as its
+// path is memoised. Aliases forwarding back to an active alias form a cycle,
+// which is reported separately, and do not extend the path.
+func (graph *Graph) longest(node string, memo map[string]hop, active map[string]bool) hop {
+	if path, ok := memo[node]; ok {
+		return path
+	}
+	active[node] = true
+	best := hop{}
+	for _, recipient := range graph.aliases[node].Alias.Recipients() {
+		candidate := hop{1, strings.ToLower(recipient)}
+		if target, ok := graph.Resolve(recipient); ok {
+			if active[target] {
+				continue
+			}
+			candidate = hop{1 + graph.longest(target, memo, active).length, target}
+		}
+		if candidate.length > best.length {
+			best = candidate
+		}
+	}
+	active[node] = false
+	memo[node] = best
+	return best
+}
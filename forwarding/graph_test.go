@@ -0,0 +1,86 @@
+package forwarding
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"occult.work/improvmx"
+)
+
+func entry(domain string, active bool, name, address string) Entry {
+	return Entry{domain, active, improvmx.Alias{Name: name, Address: address}}
+}
+
+func TestResolve(t *testing.T) {
+	assert := assert.New(t)
+	graph := NewGraph(NewIndex(
+		entry("piedpiper.com", true, "richard", "richard@example.com"),
+		entry("piedpiper.com", true, "*", "inbox@example.com"),
+		entry("hooli.com", true, "gavin", "gavin@example.com"),
+	))
+	target, ok := graph.Resolve("Richard@PiedPiper.com")
+	assert.True(ok)
+	assert.Equal("richard@piedpiper.com", target)
+	target, ok = graph.Resolve("jared@piedpiper.com")
+	assert.True(ok)
+	assert.Equal("*@piedpiper.com", target)
+	_, ok = graph.Resolve("denpok@hooli.com")
+	assert.False(ok)
+	_, ok = graph.Resolve("richard@example.com")
+	assert.False(ok)
+	_, ok = graph.Resolve("richard")
+	assert.False(ok)
+}
+
+func TestAnalyze(t *testing.T) {
+	assert := assert.New(t)
+	index := NewIndex(
+		// A loop through the catch-all of another domain
+		entry("piedpiper.com", true, "richard", "nobody@hooli.com"),
+		entry("hooli.com", true, "*", "richard@piedpiper.com"),
+		// A self loop
+		entry("piedpiper.com", true, "echo", "echo@piedpiper.com, monica@example.com"),
+		// A chain of four hops
+		entry("piedpiper.com", true, "a", "b@piedpiper.com"),
+		entry("piedpiper.com", true, "b", "c@piperchat.com"),
+		entry("piperchat.com", false, "c", "d@piperchat.com"),
+		entry("piperchat.com", false, "d", "jared@example.com"),
+	)
+	report := Analyze(index, 0)
+	assert.Equal([][]string{
+		{"*@hooli.com", "richard@piedpiper.com"},
+		{"echo@piedpiper.com"},
+	}, report.Cycles)
+	assert.Equal([]Chain{
+		{[]string{"a@piedpiper.com", "b@piedpiper.com", "c@piperchat.com", "d@piperchat.com", "jared@example.com"}},
+	}, report.Chains)
+	assert.Equal([]InactiveTarget{
+		{"b@piedpiper.com", "c@piperchat.com", "c@piperchat.com"},
+		{"c@piperchat.com", "d@piperchat.com", "d@piperchat.com"},
+	}, report.Inactive)
+
+	report = Analyze(index, 2)
+	assert.Len(report.Chains, 2)
+	assert.Equal([]string{"a@piedpiper.com", "b@piedpiper.com", "c@piperchat.com", "d@piperchat.com"}, report.Chains[0].Path)
+	assert.Equal([]string{"b@piedpiper.com", "c@piperchat.com", "d@piperchat.com", "jared@example.com"}, report.Chains[1].Path)
+}
+
+func TestAnalyzeLayers(t *testing.T) {
+	assert := assert.New(t)
+	// Every alias of a layer forwards to both aliases of the next layer, which
+	// doubles the number of paths with each layer
+	var entries []Entry
+	for layer := 0; layer < 40; layer++ {
+		next := fmt.Sprintf("a%d@piedpiper.com, b%d@piedpiper.com", layer+1, layer+1)
+		entries = append(entries, entry("piedpiper.com", true, fmt.Sprintf("a%d", layer), next))
+		entries = append(entries, entry("piedpiper.com", true, fmt.Sprintf("b%d", layer), next))
+	}
+	report := Analyze(NewIndex(entries...), 50)
+	assert.Empty(report.Chains)
+	report = Analyze(NewIndex(entries...), 39)
+	assert.Len(report.Chains, 2)
+	assert.Len(report.Chains[0].Path, 41)
+	assert.Equal("a0@piedpiper.com", report.Chains[0].Path[0])
+	assert.Equal("a40@piedpiper.com", report.Chains[0].Path[40])
+}
@@ -0,0 +1,211 @@
+// Package forwarding indexes the aliases of an ImprovMX account by the
+// addresses they forward to, to answer which aliases deliver to a mailbox and
+// to remove or replace that mailbox everywhere. It also analyzes the graph of
+// aliases forwarding to other aliases of the account, reporting cycles, long
+// chains and forwards to inactive domains.
+package forwarding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"occult.work/improvmx"
+)
+
+const (
+	// The alias forwards to a different set of recipients.
+	ActionUpdate Action = "update"
+	// The alias has no recipients left, and is deleted.
+	ActionDelete Action = "delete"
+)
+
+// An alias of a domain, as indexed.
+type Entry struct {
+	Domain string
+	// Whether the domain is active
+	Active bool
+	Alias  improvmx.Alias
+}
+
+// Maps every forwarded address of an account to the aliases forwarding to it.
+// Addresses are compared case insensitively.
+type Index struct {
+	entries   []Entry
+	addresses map[string][]int
+}
+
+// What a Change does to an alias.
+type Action string
+
+// A single alias modification, as planned by Index.Replace or Index.Remove.
+type Change struct {
+	Action Action
+	Domain string
+	Alias  string
+	Before string
+	// The new forward address, empty if Action is ActionDelete
+	After string
+}
+
+// A list of changes, which is only applied to the account by Plan.Apply. Use
+// Plan.WriteTo for a dry-run report.
+type Plan []Change
+
+// Returns an index of every alias of the given domains, or of every domain in
+// the account if none are given. Domain names are compared case insensitively.
+func Build(ctx context.Context, session *improvmx.Session, domains ...string) (*Index, error) {
+	list, error := session.Domains.List(ctx)
+	if error != nil {
+		return nil, error
+	}
+	var entries []Entry
+	for _, domain := range list {
+		wanted := func(given string) bool { return strings.EqualFold(given, domain.Name) }
+		if len(domains) != 0 && !slices.ContainsFunc(domains, wanted) {
+			continue
+		}
+		aliases, error := session.Aliases.List(ctx, domain.Name)
+		if error != nil {
+			return nil, fmt.Errorf("%s: %w", domain.Name, error)
+		}
+		for _, alias := range aliases {
+			entries = append(entries, Entry{domain.Name, domain.Active, alias})
+		}
+	}
+	return NewIndex(entries...), nil
+}
+
+// Returns an index of the given entries.
+func NewIndex(entries ...Entry) *Index {
+	index := &Index{entries: entries, addresses: make(map[string][]int)}
+	for position, entry := range entries {
+		for _, recipient := range entry.Alias.Recipients() {
+			// An alias listing a recipient twice is only indexed once
+			key := strings.ToLower(recipient)
+			if positions := index.addresses[key]; len(positions) != 0 && positions[len(positions)-1] == position {
+				continue
+			}
+			index.addresses[key] = append(index.addresses[key], position)
+		}
+	}
+	return index
+}
+
+// Returns every indexed entry.
+func (index *Index) Entries() []Entry {
+	return append([]Entry(nil), index.entries...)
+}
+
+// Returns every forwarded address, lowercased and sorted.
+func (index *Index) Addresses() []string {
+	addresses := make([]string, 0, len(index.addresses))
+	for address := range index.addresses {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// Returns the aliases forwarding to the given address, ordered by domain then
+// alias name.
+func (index *Index) ForwardersOf(address string) []Entry {
+	positions := index.addresses[strings.ToLower(strings.TrimSpace(address))]
+	entries := make([]Entry, len(positions))
+	for position, entry := range positions {
+		entries[position] = index.entries[entry]
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Domain != entries[j].Domain {
+			return entries[i].Domain < entries[j].Domain
+		}
+		return entries[i].Alias.Name < entries[j].Alias.Name
+	})
+	return entries
+}
+
+// Plans replacing the address with replacement in every alias forwarding to
+// it. The replacement is not added twice to aliases that already forward to
+// it. If replacement is empty, this is equivalent to Remove.
+func (index *Index) Replace(address, replacement string) Plan {
+	address = strings.ToLower(strings.TrimSpace(address))
+	replacement = strings.TrimSpace(replacement)
+	var plan Plan
+	for _, entry := range index.ForwardersOf(address) {
+		var recipients []string
+		for _, recipient := range entry.Alias.Recipients() {
+			if strings.EqualFold(recipient, address) {
+				recipient = replacement
+			}
+			if recipient != "" && !containsFold(recipients, recipient) {
+				recipients = append(recipients, recipient)
+			}
+		}
+		change := Change{ActionUpdate, entry.Domain, entry.Alias.Name, entry.Alias.Address, strings.Join(recipients, ",")}
+		if len(recipients) == 0 {
+			change.Action = ActionDelete
+		}
+		plan = append(plan, change)
+	}
+	return plan
+}
+
+// Plans removing the address from every alias forwarding to it. Aliases left
+// without recipients are deleted.
+func (index *Index) Remove(address string) Plan {
+	return index.Replace(address, "")
+}
+
+// Applies every change of the plan, and returns those that succeeded. Changes
+// are applied in order, and failures do not stop the remaining changes.
+func (plan Plan) Apply(ctx context.Context, session *improvmx.Session) (Plan, error) {
+	var applied Plan
+	var failures []error
+	for _, change := range plan {
+		var failure error
+		switch change.Action {
+		case ActionDelete:
+			failure = session.Aliases.Delete(ctx, change.Domain, change.Alias)
+		case ActionUpdate:
+			_, failure = session.Aliases.Update(ctx, change.Domain, change.Alias, change.After)
+		default:
+			failure = fmt.Errorf("unknown action %q", change.Action)
+		}
+		if failure != nil {
+			failures = append(failures, fmt.Errorf("%s@%s: %w", change.Alias, change.Domain, failure))
+			continue
+		}
+		applied = append(applied, change)
+	}
+	return applied, errors.Join(failures...)
+}
+
+// Writes a human readable report of the plan, one change per line.
+func (plan Plan) WriteTo(writer io.Writer) (int64, error) {
+	builder := &strings.Builder{}
+	if len(plan) == 0 {
+		builder.WriteString("no changes\n")
+	}
+	for _, change := range plan {
+		fmt.Fprintf(builder, "%-6s %s@%s: %s", change.Action, change.Alias, change.Domain, change.Before)
+		if change.Action == ActionUpdate {
+			fmt.Fprintf(builder, " -> %s", change.After)
+		}
+		builder.WriteString("\n")
+	}
+	written, error := io.WriteString(writer, builder.String())
+	return int64(written), error
+}
+
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
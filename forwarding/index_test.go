@@ -0,0 +1,111 @@
+package forwarding
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"occult.work/improvmx"
+)
+
+func testIndex() *Index {
+	return NewIndex(
+		Entry{"piedpiper.com", true, improvmx.Alias{Name: "richard", Address: "richard@example.com"}},
+		Entry{"piedpiper.com", true, improvmx.Alias{Name: "team", Address: "richard@example.com, Jared@example.com"}},
+		Entry{"piedpiper.com", true, improvmx.Alias{Name: "*", Address: "jared@example.com"}},
+		Entry{"hooli.com", false, improvmx.Alias{Name: "jared", Address: "JARED@example.com,gavin@hooli.com"}},
+	)
+}
+
+func TestForwardersOf(t *testing.T) {
+	assert := assert.New(t)
+	index := testIndex()
+	var names []string
+	for _, entry := range index.ForwardersOf(" jared@EXAMPLE.com") {
+		names = append(names, entry.Alias.Name+"@"+entry.Domain)
+	}
+	assert.Equal([]string{"jared@hooli.com", "*@piedpiper.com", "team@piedpiper.com"}, names)
+	assert.Empty(index.ForwardersOf("monica@example.com"))
+	assert.Equal([]string{"gavin@hooli.com", "jared@example.com", "richard@example.com"}, index.Addresses())
+	assert.Len(index.Entries(), 4)
+}
+
+func TestReplace(t *testing.T) {
+	assert := assert.New(t)
+	index := testIndex()
+	assert.Equal(Plan{
+		{ActionUpdate, "hooli.com", "jared", "JARED@example.com,gavin@hooli.com", "gavin@hooli.com"},
+		{ActionDelete, "piedpiper.com", "*", "jared@example.com", ""},
+		{ActionUpdate, "piedpiper.com", "team", "richard@example.com, Jared@example.com", "richard@example.com"},
+	}, index.Remove("jared@example.com"))
+
+	plan := index.Replace("jared@example.com", "richard@example.com")
+	assert.Equal("richard@example.com", plan[2].After)
+	assert.Equal(ActionUpdate, plan[1].Action)
+	assert.Equal("richard@example.com", plan[1].After)
+
+	builder := &strings.Builder{}
+	plan.WriteTo(builder)
+	assert.Equal(`update jared@hooli.com: JARED@example.com,gavin@hooli.com -> richard@example.com,gavin@hooli.com
+update *@piedpiper.com: jared@example.com -> richard@example.com
+update team@piedpiper.com: richard@example.com, Jared@example.com -> richard@example.com
+`, builder.String())
+
+	builder.Reset()
+	index.Remove("monica@example.com").WriteTo(builder)
+	assert.Equal("no changes\n", builder.String())
+
+	index = NewIndex(Entry{"piedpiper.com", true, improvmx.Alias{Name: "monica", Address: "monica@example.com, Monica@example.com"}})
+	assert.Equal(Plan{
+		{ActionDelete, "piedpiper.com", "monica", "monica@example.com, Monica@example.com", ""},
+	}, index.Remove(" Monica@EXAMPLE.com "))
+}
+
+func TestBuildAndApply(t *testing.T) {
+	assert := assert.New(t)
+	var writes []string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		switch request.Method + " " + request.URL.Path {
+		case "GET /domains/":
+			fmt.Fprint(writer, `{ "domains": [{ "domain": "piedpiper.com", "active": true }, { "domain": "hooli.com" }], "total": 2, "success": true }`)
+		case "GET /domains/piedpiper.com/aliases/":
+			fmt.Fprint(writer, `{ "aliases": [{ "alias": "team", "forward": "richard@example.com,jared@example.com" }], "total": 1, "success": true }`)
+		case "GET /domains/hooli.com/aliases/":
+			fmt.Fprint(writer, `{ "aliases": [{ "alias": "jared", "forward": "jared@example.com" }], "total": 1, "success": true }`)
+		case "DELETE /domains/hooli.com/aliases/jared/":
+			writer.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(writer, `{ "error": "failure", "code": 500, "success": false }`)
+		default:
+			body := map[string]string{}
+			json.NewDecoder(request.Body).Decode(&body)
+			writes = append(writes, request.Method+" "+request.URL.Path+" "+body["forward"])
+			fmt.Fprint(writer, `{ "alias": { "alias": "team", "forward": "richard@example.com" }, "success": true }`)
+		}
+	}))
+	defer server.Close()
+	session, error := improvmx.New("token", improvmx.WithBaseURL(server.URL))
+	require.NoError(t, error)
+
+	index, error := Build(context.Background(), session)
+	require.NoError(t, error)
+	forwarders := index.ForwardersOf("jared@example.com")
+	require.Len(t, forwarders, 2)
+	assert.False(forwarders[0].Active)
+	assert.True(forwarders[1].Active)
+
+	applied, error := index.Remove("jared@example.com").Apply(context.Background(), session)
+	assert.ErrorContains(error, "jared@hooli.com")
+	assert.Equal(Plan{{ActionUpdate, "piedpiper.com", "team", "richard@example.com,jared@example.com", "richard@example.com"}}, applied)
+	assert.Equal([]string{"PUT /domains/piedpiper.com/aliases/team/ richard@example.com"}, writes)
+
+	index, error = Build(context.Background(), session, "Hooli.com")
+	require.NoError(t, error)
+	assert.Len(index.Entries(), 1)
+}
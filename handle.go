@@ -0,0 +1,189 @@
+package improvmx
+
+import "context"
+
+// Binds the Domains endpoint of a Session to a single domain. Use Aliases and
+// Credentials to access the aliases and SMTP credentials of the same domain.
+type DomainHandle struct {
+	session *Session
+	name    string
+}
+
+// The Aliases endpoint of a Session, bound to a single domain.
+type DomainAliases struct {
+	session *Session
+	domain  string
+}
+
+// The Credentials endpoint of a Session, bound to a single domain.
+type DomainCredentials struct {
+	session *Session
+	domain  string
+}
+
+// Returns a handle to the given domain. No request is sent until one of its
+// methods is called, so the domain does not need to exist yet.
+func (session *Session) Domain(name string) *DomainHandle {
+	return &DomainHandle{session, name}
+}
+
+// Returns the name of the domain.
+func (handle *DomainHandle) Name() string {
+	return handle.name
+}
+
+// Returns the aliases of the domain.
+func (handle *DomainHandle) Aliases() *DomainAliases {
+	return &DomainAliases{handle.session, handle.name}
+}
+
+// Returns the SMTP credentials of the domain.
+func (handle *DomainHandle) Credentials() *DomainCredentials {
+	return &DomainCredentials{handle.session, handle.name}
+}
+
+// See DomainEndpoint.Create
+func (handle *DomainHandle) Create(ctx context.Context, options ...DomainOption) (*Domain, error) {
+	return handle.session.Domains.Create(ctx, handle.name, options...)
+}
+
+// See DomainEndpoint.Read
+func (handle *DomainHandle) Read(ctx context.Context) (*Domain, error) {
+	return handle.session.Domains.Read(ctx, handle.name)
+}
+
+// See DomainEndpoint.Update
+func (handle *DomainHandle) Update(ctx context.Context, options ...DomainOption) (*Domain, error) {
+	return handle.session.Domains.Update(ctx, handle.name, options...)
+}
+
+// See DomainEndpoint.Delete
+func (handle *DomainHandle) Delete(ctx context.Context) error {
+	return handle.session.Domains.Delete(ctx, handle.name)
+}
+
+// See DomainEndpoint.Check
+func (handle *DomainHandle) Check(ctx context.Context) (*DomainCheck, error) {
+	return handle.session.Domains.Check(ctx, handle.name)
+}
+
+// See DomainEndpoint.Verify
+func (handle *DomainHandle) Verify(ctx context.Context) error {
+	return handle.session.Domains.Verify(ctx, handle.name)
+}
+
+// See DomainEndpoint.Logs
+func (handle *DomainHandle) Logs(ctx context.Context) ([]LogEntry, error) {
+	return handle.session.Domains.Logs(ctx, handle.name)
+}
+
+// Returns the name of the domain.
+func (aliases *DomainAliases) Domain() string {
+	return aliases.domain
+}
+
+// See AliasEndpoint.List
+func (aliases *DomainAliases) List(ctx context.Context, options ...*ListOption) ([]Alias, error) {
+	return aliases.session.Aliases.List(ctx, aliases.domain, options...)
+}
+
+// See AliasEndpoint.Create
+func (aliases *DomainAliases) Create(ctx context.Context, alias, address string) (*Alias, error) {
+	return aliases.session.Aliases.Create(ctx, aliases.domain, alias, address)
+}
+
+// See AliasEndpoint.Read
+func (aliases *DomainAliases) Read(ctx context.Context, alias string) (*Alias, error) {
+	return aliases.session.Aliases.Read(ctx, aliases.domain, alias)
+}
+
+// See AliasEndpoint.Update
+func (aliases *DomainAliases) Update(ctx context.Context, alias, address string) (*Alias, error) {
+	return aliases.session.Aliases.Update(ctx, aliases.domain, alias, address)
+}
+
+// See AliasEndpoint.Delete
+func (aliases *DomainAliases) Delete(ctx context.Context, alias string) error {
+	return aliases.session.Aliases.Delete(ctx, aliases.domain, alias)
+}
+
+// See AliasEndpoint.Logs
+func (aliases *DomainAliases) Logs(ctx context.Context, alias string) ([]LogEntry, error) {
+	return aliases.session.Aliases.Logs(ctx, aliases.domain, alias)
+}
+
+// Returns the name of the domain.
+func (credentials *DomainCredentials) Domain() string {
+	return credentials.domain
+}
+
+// See CredentialEndpoint.List
+func (credentials *DomainCredentials) List(ctx context.Context) ([]Credential, error) {
+	return credentials.session.Credentials.List(ctx, credentials.domain)
+}
+
+// See CredentialEndpoint.Create
+func (credentials *DomainCredentials) Create(ctx context.Context, user User) (*Credential, error) {
+	return credentials.session.Credentials.Create(ctx, credentials.domain, user)
+}
+
+// See CredentialEndpoint.Update
+func (credentials *DomainCredentials) Update(ctx context.Context, user User) (*Credential, error) {
+	return credentials.session.Credentials.Update(ctx, credentials.domain, user)
+}
+
+// See CredentialEndpoint.Delete
+func (credentials *DomainCredentials) Delete(ctx context.Context, username string) error {
+	return credentials.session.Credentials.Delete(ctx, credentials.domain, username)
+}
+
+// See Session.EnsureDomain
+func (handle *DomainHandle) Ensure(ctx context.Context, options ...DomainOption) (*Domain, bool, error) {
+	return handle.session.EnsureDomain(ctx, handle.name, options...)
+}
+
+// See Session.EnsureAlias
+func (aliases *DomainAliases) Ensure(ctx context.Context, alias, address string) (*Alias, bool, error) {
+	return aliases.session.EnsureAlias(ctx, aliases.domain, alias, address)
+}
+
+// See Session.EnsureCredential
+func (credentials *DomainCredentials) Ensure(ctx context.Context, user User) (*Credential, bool, error) {
+	return credentials.session.EnsureCredential(ctx, credentials.domain, user)
+}
+
+// See AliasEndpoint.Rename
+func (aliases *DomainAliases) Rename(ctx context.Context, old, new string) (*Alias, error) {
+	return aliases.session.Aliases.Rename(ctx, aliases.domain, old, new)
+}
+
+// Moves the alias to another domain. See AliasEndpoint.Move
+func (aliases *DomainAliases) Move(ctx context.Context, toDomain, name string) (*Alias, error) {
+	return aliases.session.Aliases.Move(ctx, aliases.domain, toDomain, name)
+}
+
+// Copies the aliases of the domain to the target domain. See
+// DomainEndpoint.Clone
+func (handle *DomainHandle) Clone(ctx context.Context, target string, options ...CloneOption) (*CloneResult, error) {
+	return handle.session.Domains.Clone(ctx, handle.name, target, options...)
+}
+
+// See AliasEndpoint.CatchAll
+func (aliases *DomainAliases) CatchAll(ctx context.Context) (*Alias, error) {
+	return aliases.session.Aliases.CatchAll(ctx, aliases.domain)
+}
+
+// See AliasEndpoint.SetCatchAll
+func (aliases *DomainAliases) SetCatchAll(ctx context.Context, address string) (*Alias, error) {
+	return aliases.session.Aliases.SetCatchAll(ctx, aliases.domain, address)
+}
+
+// See AliasEndpoint.RemoveCatchAll
+func (aliases *DomainAliases) RemoveCatchAll(ctx context.Context) error {
+	return aliases.session.Aliases.RemoveCatchAll(ctx, aliases.domain)
+}
+
+// See AliasEndpoint.AnalyzeCatchAll
+func (aliases *DomainAliases) AnalyzeCatchAll(ctx context.Context) (*CatchAllReport, error) {
+	return aliases.session.Aliases.AnalyzeCatchAll(ctx, aliases.domain)
+}
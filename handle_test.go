@@ -0,0 +1,94 @@
+package improvmx
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"occult.work/doze/test"
+)
+
+type HandleTestSuite struct {
+	test.Suite
+	paths  []string
+	domain *DomainHandle
+}
+
+func (suite *HandleTestSuite) SetupSuite() {
+	record := func(path string) http.HandlerFunc {
+		handler := suite.FileResponseHandler(path)
+		return func(writer http.ResponseWriter, request *http.Request) {
+			suite.paths = append(suite.paths, request.Method+" "+request.URL.Path)
+			handler(writer, request)
+		}
+	}
+	router := test.NewRouter().
+		Get(domainReadPath, record("testdata/domain/read.json")).
+		Get(domainVerifyPath, record("testdata/domain/verify.json")).
+		Get(domainLogsPath, record("testdata/domain/logs.json")).
+		Get(aliasReadPath, record("testdata/alias/read.json")).
+		Get(aliasLogsPath, record("testdata/alias/logs.json")).
+		Post(credentialsCreatePath, record("testdata/credential/create.json")).
+		Delete(credentialsDeletePath, func(writer http.ResponseWriter, request *http.Request) {
+			suite.paths = append(suite.paths, request.Method+" "+request.URL.Path)
+			fmt.Fprint(writer, `{ "success": true }`)
+		})
+	suite.Initialize(router)
+	suite.Data = &testData
+	suite.domain = setupSession(suite.Server).Domain("piedpiper.com")
+}
+
+func (suite *HandleTestSuite) SetupTest() {
+	suite.paths = nil
+}
+
+func TestHandle(t *testing.T) {
+	test.Run(t, new(HandleTestSuite))
+}
+
+func (suite *HandleTestSuite) TestDomain() {
+	ctx := context.Background()
+	suite.Equal("piedpiper.com", suite.domain.Name())
+	domain, error := suite.domain.Read(ctx)
+	suite.Require().NoError(error)
+	suite.Equal("piedpiper.com", domain.Name)
+	_, error = suite.domain.Check(ctx)
+	suite.NoError(error)
+	_, error = suite.domain.Logs(ctx)
+	suite.NoError(error)
+	suite.Equal([]string{
+		"GET /domains/piedpiper.com/",
+		"GET /domains/piedpiper.com/check/",
+		"GET /domains/piedpiper.com/logs/",
+	}, suite.paths)
+}
+
+func (suite *HandleTestSuite) TestAliases() {
+	ctx := context.Background()
+	aliases := suite.domain.Aliases()
+	suite.Equal("piedpiper.com", aliases.Domain())
+	alias, error := aliases.Read(ctx, "richard")
+	suite.Require().NoError(error)
+	suite.Equal("richard", alias.Name)
+	_, error = aliases.Logs(ctx, "richard")
+	suite.NoError(error)
+	suite.Equal([]string{
+		"GET /domains/piedpiper.com/aliases/richard/",
+		"GET /domains/piedpiper.com/logs/richard/",
+	}, suite.paths)
+}
+
+func (suite *HandleTestSuite) TestCredentials() {
+	ctx := context.Background()
+	credentials := suite.domain.Credentials()
+	suite.Equal("piedpiper.com", credentials.Domain())
+	credential, error := credentials.Create(ctx, User{"richard", "hunter2"})
+	suite.Require().NoError(error)
+	suite.Equal("richard", credential.Username)
+	suite.NoError(credentials.Delete(ctx, "richard"))
+	suite.Equal([]string{
+		"POST /domains/piedpiper.com/credentials/",
+		"DELETE /domains/piedpiper.com/credentials/richard",
+	}, suite.paths)
+}
@@ -0,0 +1,206 @@
+package improvmx
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Describes a single request sent by a Session, as passed to Hooks.
+type RequestInfo struct {
+	// The endpoint method that sent the request (e.g., "Aliases.Read"). Empty
+	// if the request does not correspond to a known endpoint.
+	Endpoint string
+	Method   string
+	// The path template of the request (e.g., "/domains/{domain}/aliases/{alias}/"),
+	// or the actual path if the request does not correspond to a known
+	// endpoint.
+	Path string
+	URL  *url.URL
+	// When the request was sent
+	Start time.Time
+	// The HTTP status code of the response. Zero if no response was received.
+	Status   int
+	Duration time.Duration
+	// The transport error, or an *Error if the status code indicates failure.
+	Error error
+	// Whether a dry-run Session answers the request without sending it. See
+	// WithDryRun.
+	DryRun bool
+}
+
+// Observes every request sent by a Session. Before is called before each
+// request is sent, and the context it returns is used for the request and
+// passed to After, which is called once the request completes. Either may be
+// nil.
+type Hooks struct {
+	Before func(ctx context.Context, info *RequestInfo) context.Context
+	After  func(ctx context.Context, info *RequestInfo)
+}
+
+// Wraps the http.RoundTripper used by a Session.
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// Records request counts and latencies, for example into Prometheus or
+// OpenTelemetry instruments. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// Increments the counter of requests sent to the given endpoint.
+	IncrementRequests(endpoint, method string, status int, failed bool)
+	// Adds the duration of a request to the latency histogram of the given
+	// endpoint.
+	ObserveLatency(endpoint, method string, duration time.Duration)
+}
+
+// Calls the given hooks for every request sent by the session. Hooks are
+// called in the order given for Before, and in reverse order for After.
+func WithHooks(hooks ...Hooks) SessionOption {
+	return func(session *Session) error {
+		session.hooks = append(session.hooks, hooks...)
+		return nil
+	}
+}
+
+// Wraps the transport of the session with the given middleware. Middleware
+// passed first is outermost, and observes requests before later middleware.
+func WithMiddleware(middleware ...Middleware) SessionOption {
+	return func(session *Session) error {
+		session.middleware = append(session.middleware, middleware...)
+		return nil
+	}
+}
+
+// Returns Hooks recording every request sent into metrics. Requests answered
+// by a dry run are not recorded.
+func MetricsHooks(metrics Metrics) Hooks {
+	return Hooks{
+		After: func(ctx context.Context, info *RequestInfo) {
+			if info.DryRun {
+				return
+			}
+			endpoint := info.Endpoint
+			if endpoint == "" {
+				endpoint = "unknown"
+			}
+			metrics.IncrementRequests(endpoint, info.Method, info.Status, info.Error != nil)
+			metrics.ObserveLatency(endpoint, info.Method, info.Duration)
+		},
+	}
+}
+
+// A known request of the ImprovMX REST API, and the endpoint method sending it.
+type operation struct {
+	method   string
+	path     string
+	endpoint string
+}
+
+var operations = []operation{
+	{http.MethodGet, accountLabelsPath, "Account.Labels"},
+	{http.MethodGet, accountReadPath, "Account.Read"},
+
+	{http.MethodGet, aliasListPath, "Aliases.List"},
+	{http.MethodPost, aliasCreatePath, "Aliases.Create"},
+	{http.MethodGet, aliasReadPath, "Aliases.Read"},
+	{http.MethodPut, aliasUpdatePath, "Aliases.Update"},
+	{http.MethodDelete, aliasDeletePath, "Aliases.Delete"},
+	{http.MethodGet, aliasLogsPath, "Aliases.Logs"},
+
+	{http.MethodGet, credentialsListPath, "Credentials.List"},
+	{http.MethodPost, credentialsCreatePath, "Credentials.Create"},
+	{http.MethodPut, credentialsUpdatePath, "Credentials.Update"},
+	{http.MethodDelete, credentialsDeletePath, "Credentials.Delete"},
+
+	{http.MethodGet, domainListPath, "Domains.List"},
+	{http.MethodPost, domainCreatePath, "Domains.Create"},
+	{http.MethodGet, domainReadPath, "Domains.Read"},
+	{http.MethodPut, domainUpdatePath, "Domains.Update"},
+	{http.MethodDelete, domainDeletePath, "Domains.Delete"},
+	{http.MethodGet, domainVerifyPath, "Domains.Check"},
+	{http.MethodGet, domainLogsPath, "Domains.Logs"},
+}
+
+// Returns the operation matching the given method and path, which must be
+// relative to the base URL of the session. Literal segments of a template
+// must match exactly, while {parameter} segments match any single segment.
+func findOperation(method, path string) (operation, map[string]string, bool) {
+	segments := splitPath(path)
+	for _, candidate := range operations {
+		if candidate.method != method {
+			continue
+		}
+		template := splitPath(candidate.path)
+		if len(template) != len(segments) {
+			continue
+		}
+		parameters := make(map[string]string)
+		matched := true
+		for index, segment := range template {
+			if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+				value, error := url.PathUnescape(segments[index])
+				if error != nil {
+					value = segments[index]
+				}
+				parameters[segment[1:len(segment)-1]] = value
+				continue
+			}
+			if segment != segments[index] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return candidate, parameters, true
+		}
+	}
+	return operation{}, nil, false
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// Calls hooks around every request sent through next.
+type hookTransport struct {
+	session *Session
+	hooks   []Hooks
+	next    http.RoundTripper
+}
+
+func (transport *hookTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	info := &RequestInfo{
+		Method: request.Method,
+		Path:   request.URL.Path,
+		URL:    request.URL,
+		Start:  time.Now(),
+	}
+	if operation, _, ok := transport.session.operation(request); ok {
+		info.Endpoint = operation.endpoint
+		info.Path = operation.path
+	}
+	if state := transport.session.dryRun; state != nil {
+		info.DryRun = state.answers(request.Method, transport.session.relativePath(request))
+	}
+	ctx := request.Context()
+	for _, hooks := range transport.hooks {
+		if hooks.Before != nil {
+			ctx = hooks.Before(ctx, info)
+		}
+	}
+	response, error := transport.next.RoundTrip(request.WithContext(ctx))
+	info.Duration = time.Since(info.Start)
+	info.Error = error
+	if response != nil {
+		info.Status = response.StatusCode
+		if error == nil && response.StatusCode >= 400 {
+			info.Error = &Error{Message: http.StatusText(response.StatusCode), Code: response.StatusCode}
+		}
+	}
+	for index := len(transport.hooks) - 1; index >= 0; index-- {
+		if after := transport.hooks[index].After; after != nil {
+			after(ctx, info)
+		}
+	}
+	return response, error
+}
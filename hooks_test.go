@@ -0,0 +1,142 @@
+package improvmx
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"occult.work/doze/test"
+)
+
+type HooksTestSuite struct {
+	test.Suite
+	mutex   sync.Mutex
+	infos   []RequestInfo
+	session *Session
+}
+
+type recordingMetrics struct {
+	requests  map[string]int
+	latencies map[string]int
+}
+
+func (metrics *recordingMetrics) IncrementRequests(endpoint, method string, status int, failed bool) {
+	metrics.requests[fmt.Sprintf("%s %s %d %t", endpoint, method, status, failed)]++
+}
+
+func (metrics *recordingMetrics) ObserveLatency(endpoint, method string, duration time.Duration) {
+	metrics.latencies[endpoint]++
+}
+
+func (suite *HooksTestSuite) SetupSuite() {
+	router := test.NewRouter().
+		Get(aliasReadPath, suite.FileResponseHandler("testdata/alias/read.json")).
+		Put(credentialsUpdatePath, func(writer http.ResponseWriter, request *http.Request) {
+			writer.WriteHeader(420)
+			fmt.Fprint(writer, `{ "error": "fake error", "code": 420, "success": false }`)
+		})
+	suite.Initialize(router)
+	suite.Data = &testData
+}
+
+func (suite *HooksTestSuite) SetupTest() {
+	suite.infos = nil
+	suite.session, _ = New("token", WithBaseURL(suite.Server.URL+"/"), WithHooks(Hooks{
+		After: func(ctx context.Context, info *RequestInfo) {
+			suite.mutex.Lock()
+			defer suite.mutex.Unlock()
+			suite.infos = append(suite.infos, *info)
+		},
+	}))
+}
+
+func TestHooks(t *testing.T) {
+	test.Run(t, new(HooksTestSuite))
+}
+
+func (suite *HooksTestSuite) TestSuccess() {
+	_, error := suite.session.Aliases.Read(context.Background(), "example.com", "richard")
+	suite.Require().NoError(error)
+	suite.Require().Len(suite.infos, 1)
+	info := suite.infos[0]
+	suite.Equal("Aliases.Read", info.Endpoint)
+	suite.Equal(http.MethodGet, info.Method)
+	suite.Equal(aliasReadPath, info.Path)
+	suite.Equal(http.StatusOK, info.Status)
+	suite.NoError(info.Error)
+	suite.Greater(info.Duration, time.Duration(0))
+}
+
+func (suite *HooksTestSuite) TestFailure() {
+	_, error := suite.session.Credentials.Update(context.Background(), "example.com", User{"richard", "hunter2"})
+	suite.Require().Error(error)
+	suite.Require().Len(suite.infos, 1)
+	suite.Equal("Credentials.Update", suite.infos[0].Endpoint)
+	suite.Equal(420, suite.infos[0].Status)
+	suite.Error(suite.infos[0].Error)
+}
+
+func (suite *HooksTestSuite) TestOrderAndMiddleware() {
+	var calls []string
+	hooks := func(name string) Hooks {
+		return Hooks{
+			Before: func(ctx context.Context, info *RequestInfo) context.Context {
+				calls = append(calls, "before "+name)
+				return ctx
+			},
+			After: func(ctx context.Context, info *RequestInfo) {
+				calls = append(calls, "after "+name)
+			},
+		}
+	}
+	middleware := func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			calls = append(calls, "middleware")
+			return next.RoundTrip(request)
+		})
+	}
+	session, error := New("token", WithBaseURL(suite.Server.URL), WithHooks(hooks("a"), hooks("b")), WithMiddleware(middleware))
+	suite.Require().NoError(error)
+	_, error = session.Aliases.Read(context.Background(), "example.com", "richard")
+	suite.Require().NoError(error)
+	suite.Equal([]string{"before a", "before b", "middleware", "after b", "after a"}, calls)
+}
+
+func (suite *HooksTestSuite) TestMetricsHooks() {
+	metrics := &recordingMetrics{make(map[string]int), make(map[string]int)}
+	session, error := New("token", WithBaseURL(suite.Server.URL), WithHooks(MetricsHooks(metrics)))
+	suite.Require().NoError(error)
+	session.Aliases.Read(context.Background(), "example.com", "richard")
+	session.Credentials.Update(context.Background(), "example.com", User{"richard", "hunter2"})
+	suite.Equal(map[string]int{
+		"Aliases.Read GET 200 false":      1,
+		"Credentials.Update PUT 420 true": 1,
+	}, metrics.requests)
+	suite.Equal(1, metrics.latencies["Aliases.Read"])
+}
+
+func TestFindOperation(t *testing.T) {
+	assert := assert.New(t)
+	operation, parameters, ok := findOperation(http.MethodGet, "/domains/example.com/logs/richard/")
+	assert.True(ok)
+	assert.Equal("Aliases.Logs", operation.endpoint)
+	assert.Equal(map[string]string{"domain": "example.com", "alias": "richard"}, parameters)
+
+	operation, _, ok = findOperation(http.MethodPost, "/domains/")
+	assert.True(ok)
+	assert.Equal("Domains.Create", operation.endpoint)
+
+	operation, parameters, ok = findOperation(http.MethodDelete, "/domains/example.com/credentials/richard")
+	assert.True(ok)
+	assert.Equal("Credentials.Delete", operation.endpoint)
+	assert.Equal("richard", parameters["username"])
+
+	_, _, ok = findOperation(http.MethodPatch, "/domains/")
+	assert.False(ok)
+	_, _, ok = findOperation(http.MethodGet, "/planets/")
+	assert.False(ok)
+}
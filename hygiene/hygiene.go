@@ -0,0 +1,342 @@
+// Package hygiene reports the resources of an ImprovMX account that appear to
+// be abandoned: aliases that received no mail recently, SMTP credentials that
+// were never used or are older than a maximum age, and inactive domains. The
+// findings of a Report may then be pruned, either all at once according to a
+// Policy, or one by one after confirmation.
+package hygiene
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"occult.work/improvmx"
+	"occult.work/improvmx/archive"
+)
+
+const (
+	// An alias without log entries in the reporting window.
+	KindAlias Kind = "alias"
+	// An SMTP credential never used, or older than the maximum age.
+	KindCredential Kind = "credential"
+	// A domain whose DNS records are not set up, which receives no mail.
+	KindDomain Kind = "domain"
+)
+
+// The default reporting window of Build.
+const DefaultWindow = 30 * 24 * time.Hour
+
+// Returned by Report.Prune when asked to delete aliases of a Report whose logs
+// do not cover the whole reporting window. See Policy.PartialLogs.
+var ErrPartialLogs = errors.New("logs do not cover the reporting window")
+
+// The type of resource a Finding refers to.
+type Kind string
+
+// Returns the log entries of a domain.
+type LogSource func(ctx context.Context, domain string) ([]improvmx.LogEntry, error)
+
+// Controls how Build gathers its findings.
+type Options struct {
+	// Domains to report on. Defaults to every domain of the account.
+	Domains []string
+	// Aliases without log entries in this window are reported. Defaults to
+	// DefaultWindow.
+	Window time.Duration
+	// Also reports SMTP credentials, which requires a premium account.
+	Credentials bool
+	// Credentials created longer ago than this are reported, even if used. Zero
+	// only reports credentials that were never used.
+	CredentialMaxAge time.Duration
+	// Where log entries are read from. Defaults to LiveLogs.
+	Logs LogSource
+	// The time the report is relative to. Defaults to the current time.
+	Now time.Time
+}
+
+// A single resource that appears to be abandoned.
+type Finding struct {
+	Kind   Kind
+	Domain string
+	// The alias name or credential username, empty for KindDomain
+	Name   string
+	Reason string
+}
+
+// The findings of Build, sorted by domain, kind and name.
+type Report struct {
+	// Start of the reporting window, or of the logs if they do not reach back
+	// that far for some domain
+	Since time.Time
+	// Whether the logs of some domain do not reach back to the start of the
+	// reporting window, in which case its aliases may have received mail
+	// before their oldest entry
+	Partial  bool
+	Findings []Finding
+}
+
+// Selects which findings Report.Prune deletes.
+type Policy struct {
+	Aliases     bool
+	Credentials bool
+	// Deletes inactive domains, along with all of their aliases and
+	// credentials.
+	Domains bool
+	// Deletes aliases even if the report is Partial. Otherwise, Prune refuses
+	// with ErrPartialLogs, and ArchiveLogs should be used to cover the window.
+	PartialLogs bool
+	// Called for each selected finding before it is deleted, which is skipped
+	// unless it returns true. May be nil to delete without confirmation.
+	Confirm func(Finding) (bool, error)
+}
+
+// Returns a LogSource reading the live logs of each domain, with a single
+// request per domain. The ImprovMX REST API only returns recent entries, which
+// may not cover the reporting window.
+func LiveLogs(session *improvmx.Session) LogSource {
+	return session.Domains.Logs
+}
+
+// Returns a LogSource reading the log entries stored in an archive, which
+// outlive the retention period of the ImprovMX REST API.
+func ArchiveLogs(store *archive.Archive) LogSource {
+	return func(ctx context.Context, domain string) ([]improvmx.LogEntry, error) {
+		records, error := store.Query(archive.Query{Domain: domain})
+		if error != nil {
+			return nil, error
+		}
+		entries := make([]improvmx.LogEntry, len(records))
+		for index, record := range records {
+			entries[index] = record.Entry
+		}
+		return entries, nil
+	}
+}
+
+// Returns the report of the account. Aliases and credentials of inactive
+// domains are not reported individually, as the domain itself is.
+func Build(ctx context.Context, session *improvmx.Session, options Options) (*Report, error) {
+	if options.Window <= 0 {
+		options.Window = DefaultWindow
+	}
+	if options.Logs == nil {
+		options.Logs = LiveLogs(session)
+	}
+	if options.Now.IsZero() {
+		options.Now = time.Now()
+	}
+	domains, error := listDomains(ctx, session, options.Domains)
+	if error != nil {
+		return nil, error
+	}
+	report := &Report{Since: options.Now.Add(-options.Window)}
+	for _, domain := range domains {
+		if !domain.Active {
+			report.add(Finding{KindDomain, domain.Name, "", "inactive"})
+			continue
+		}
+		if error := report.addAliases(ctx, session, domain.Name, options); error != nil {
+			return nil, fmt.Errorf("%s: %w", domain.Name, error)
+		}
+		if !options.Credentials {
+			continue
+		}
+		credentials, error := session.Credentials.List(ctx, domain.Name)
+		if error != nil {
+			return nil, fmt.Errorf("%s: %w", domain.Name, error)
+		}
+		for _, credential := range credentials {
+			switch {
+			case credential.Usage == 0:
+				report.add(Finding{KindCredential, domain.Name, credential.Username, "never used"})
+			case options.CredentialMaxAge > 0 && credential.CreatedAt.Before(options.Now.Add(-options.CredentialMaxAge)):
+				report.add(Finding{KindCredential, domain.Name, credential.Username, "created " + credential.CreatedAt.Format(time.DateOnly)})
+			}
+		}
+	}
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		first, second := report.Findings[i], report.Findings[j]
+		if first.Domain != second.Domain {
+			return first.Domain < second.Domain
+		}
+		if first.Kind != second.Kind {
+			return first.Kind < second.Kind
+		}
+		return first.Name < second.Name
+	})
+	return report, nil
+}
+
+// Returns the findings of the given kind.
+func (report *Report) Of(kind Kind) []Finding {
+	var findings []Finding
+	for _, finding := range report.Findings {
+		if finding.Kind == kind {
+			findings = append(findings, finding)
+		}
+	}
+	return findings
+}
+
+// Deletes the findings selected by the policy, and returns those deleted. A
+// failed deletion does not stop the others; their errors are joined.
+func (report *Report) Prune(ctx context.Context, session *improvmx.Session, policy Policy) ([]Finding, error) {
+	if policy.Aliases && report.Partial && !policy.PartialLogs && len(report.Of(KindAlias)) != 0 {
+		return nil, fmt.Errorf("%w: the oldest entry is from %s", ErrPartialLogs, report.Since.Format(time.DateOnly))
+	}
+	var failures []error
+	var pruned []Finding
+	for _, finding := range report.Findings {
+		if !policy.selects(finding.Kind) {
+			continue
+		}
+		if policy.Confirm != nil {
+			confirmed, error := policy.Confirm(finding)
+			if error != nil {
+				return pruned, errors.Join(append(failures, error)...)
+			}
+			if !confirmed {
+				continue
+			}
+		}
+		if error := remove(ctx, session, finding); error != nil {
+			failures = append(failures, fmt.Errorf("failed to delete %s: %w", finding, error))
+			continue
+		}
+		pruned = append(pruned, finding)
+	}
+	return pruned, errors.Join(failures...)
+}
+
+// Writes the findings as a table.
+func (report *Report) WriteTo(writer io.Writer) (int64, error) {
+	builder := &strings.Builder{}
+	if report.Partial {
+		fmt.Fprintf(builder, "logs only reach back to %s\n", report.Since.Format(time.DateOnly))
+	}
+	if len(report.Findings) == 0 {
+		builder.WriteString("no findings\n")
+	} else {
+		table := tabwriter.NewWriter(builder, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(table, "KIND\tDOMAIN\tNAME\tREASON")
+		for _, finding := range report.Findings {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", finding.Kind, finding.Domain, finding.Name, finding.Reason)
+		}
+		table.Flush()
+	}
+	written, error := io.WriteString(writer, builder.String())
+	return int64(written), error
+}
+
+// Returns the finding as "kind name@domain", or "domain name" for a domain.
+func (finding Finding) String() string {
+	if finding.Kind == KindDomain {
+		return fmt.Sprintf("%s %s", finding.Kind, finding.Domain)
+	}
+	return fmt.Sprintf("%s %s@%s", finding.Kind, finding.Name, finding.Domain)
+}
+
+// Reports the aliases of the domain without log entries since the start of
+// the reporting window, or since the oldest entry if the logs do not reach
+// back that far. Each entry is attributed to the alias of its recipient, or to
+// the catch-all alias if there is none.
+func (report *Report) addAliases(ctx context.Context, session *improvmx.Session, domain string, options Options) error {
+	aliases, error := session.Aliases.List(ctx, domain)
+	if error != nil {
+		return error
+	}
+	entries, error := options.Logs(ctx, domain)
+	if error != nil {
+		return error
+	}
+	start := options.Now.Add(-options.Window)
+	since := options.Now
+	names := make(map[string]bool)
+	for _, alias := range aliases {
+		names[strings.ToLower(alias.Name)] = true
+	}
+	received := make(map[string]bool)
+	for index := range entries {
+		created, error := entries[index].Created()
+		if error != nil {
+			continue
+		}
+		if created.Before(since) {
+			since = created
+		}
+		if created.Before(start) {
+			continue
+		}
+		local, host, _ := strings.Cut(strings.ToLower(entries[index].Recipient.Email), "@")
+		if !strings.EqualFold(host, domain) {
+			continue
+		}
+		if names[local] {
+			received[local] = true
+		} else {
+			received[improvmx.CatchAllName] = true
+		}
+	}
+	if since.After(start) {
+		report.Partial = true
+		if since.After(report.Since) {
+			report.Since = since
+		}
+	} else {
+		since = start
+	}
+	for _, alias := range aliases {
+		if !received[strings.ToLower(alias.Name)] {
+			reason := fmt.Sprintf("no mail since %s", since.Format(time.DateOnly))
+			report.add(Finding{KindAlias, domain, alias.Name, reason})
+		}
+	}
+	return nil
+}
+
+func (report *Report) add(finding Finding) {
+	report.Findings = append(report.Findings, finding)
+}
+
+func (policy *Policy) selects(kind Kind) bool {
+	switch kind {
+	case KindAlias:
+		return policy.Aliases
+	case KindCredential:
+		return policy.Credentials
+	case KindDomain:
+		return policy.Domains
+	}
+	return false
+}
+
+func remove(ctx context.Context, session *improvmx.Session, finding Finding) error {
+	switch finding.Kind {
+	case KindAlias:
+		return session.Aliases.Delete(ctx, finding.Domain, finding.Name)
+	case KindCredential:
+		return session.Credentials.Delete(ctx, finding.Domain, finding.Name)
+	}
+	return session.Domains.Delete(ctx, finding.Domain)
+}
+
+// Returns the given domains, or every domain of the account if none are given.
+func listDomains(ctx context.Context, session *improvmx.Session, names []string) ([]improvmx.Domain, error) {
+	if len(names) == 0 {
+		return session.Domains.List(ctx)
+	}
+	domains := make([]improvmx.Domain, 0, len(names))
+	for _, name := range names {
+		domain, error := session.Domains.Read(ctx, name)
+		if error != nil {
+			return nil, error
+		}
+		domains = append(domains, *domain)
+	}
+	return domains, nil
+}
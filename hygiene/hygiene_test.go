@@ -0,0 +1,181 @@
+package hygiene
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"occult.work/improvmx"
+	"occult.work/improvmx/archive"
+	"occult.work/improvmx/export"
+)
+
+var now = time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+
+// Serves canned responses by path, and records every deletion.
+type fakeAccount struct {
+	mutex     sync.Mutex
+	responses map[string]string
+	deleted   []string
+}
+
+func (account *fakeAccount) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	account.mutex.Lock()
+	defer account.mutex.Unlock()
+	writer.Header().Set("Content-Type", "application/json")
+	if request.Method == http.MethodDelete {
+		account.deleted = append(account.deleted, request.URL.Path)
+		fmt.Fprint(writer, `{ "success": true }`)
+		return
+	}
+	response, ok := account.responses[request.URL.Path]
+	if !ok {
+		writer.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(writer, `{ "error": "Not found", "code": 404, "success": false }`)
+		return
+	}
+	fmt.Fprint(writer, response)
+}
+
+func logEntry(recipient string, created time.Time) string {
+	return fmt.Sprintf(`{ "id": %q, "created": %q, "recipient": { "email": %q, "name": "" }, "events": [] }`,
+		recipient+created.String(), created.Format("2006-01-02 15:04:05-0700"), recipient)
+}
+
+func setup(t *testing.T) (*fakeAccount, *improvmx.Session) {
+	account := &fakeAccount{responses: map[string]string{
+		"/domains/": `{ "domains": [
+			{ "domain": "piedpiper.com", "active": true, "added": 0 },
+			{ "domain": "hooli.com", "active": false, "added": 0 }
+		], "total": 2, "page": 1, "success": true }`,
+		"/domains/piedpiper.com/": `{ "domain": { "domain": "piedpiper.com", "active": true, "added": 0 }, "success": true }`,
+		"/domains/piedpiper.com/aliases/": `{ "aliases": [
+			{ "alias": "*", "forward": "inbox@example.com", "id": 1 },
+			{ "alias": "jared", "forward": "jared@example.com", "id": 2 },
+			{ "alias": "richard", "forward": "richard@example.com", "id": 3 }
+		], "total": 3, "page": 1, "success": true }`,
+		"/domains/piedpiper.com/logs/": fmt.Sprintf(`{ "logs": [%s, %s, %s], "success": true }`,
+			logEntry("Richard@piedpiper.com", now.Add(-24*time.Hour)),
+			logEntry("jared@piedpiper.com", now.Add(-90*24*time.Hour)),
+			logEntry("nobody@piedpiper.com", now.Add(-time.Hour))),
+		"/domains/piedpiper.com/credentials/": `{ "credentials": [
+			{ "username": "monica", "usage": 0, "created": 1577836800000 },
+			{ "username": "richard", "usage": 12, "created": 1420070400000 },
+			{ "username": "gilfoyle", "usage": 3, "created": 1577836800000 }
+		], "success": true }`,
+	}}
+	server := httptest.NewServer(account)
+	t.Cleanup(server.Close)
+	session, error := improvmx.New("token", improvmx.WithBaseURL(server.URL))
+	require.NoError(t, error)
+	return account, session
+}
+
+func TestBuild(t *testing.T) {
+	assert := assert.New(t)
+	_, session := setup(t)
+	report, error := Build(context.Background(), session, Options{
+		Credentials:      true,
+		CredentialMaxAge: 365 * 24 * time.Hour,
+		Now:              now,
+	})
+	require.NoError(t, error)
+	assert.Equal(now.Add(-DefaultWindow), report.Since)
+	assert.False(report.Partial)
+	assert.Equal([]Finding{
+		{KindDomain, "hooli.com", "", "inactive"},
+		{KindAlias, "piedpiper.com", "jared", "no mail since 2020-01-02"},
+		{KindCredential, "piedpiper.com", "monica", "never used"},
+		{KindCredential, "piedpiper.com", "richard", "created 2015-01-01"},
+	}, report.Findings)
+	assert.Len(report.Of(KindCredential), 2)
+
+	output := &bytes.Buffer{}
+	_, error = report.WriteTo(output)
+	assert.NoError(error)
+	assert.Contains(output.String(), "alias       piedpiper.com  jared")
+
+	report, error = Build(context.Background(), session, Options{Domains: []string{"piedpiper.com"}, Window: time.Hour, Now: now})
+	require.NoError(t, error)
+	assert.Equal([]Finding{
+		{KindAlias, "piedpiper.com", "jared", "no mail since 2020-01-31"},
+		{KindAlias, "piedpiper.com", "richard", "no mail since 2020-01-31"},
+	}, report.Findings)
+}
+
+func TestBuildFromArchive(t *testing.T) {
+	assert := assert.New(t)
+	account, session := setup(t)
+	store, error := archive.Open(filepath.Join(t.TempDir(), "archive"))
+	require.NoError(t, error)
+	jared := improvmx.LogEntry{ID: "1", CreatedAt: now.Add(-time.Hour).Format("2006-01-02 15:04:05-0700")}
+	jared.Recipient.Email = "jared@piedpiper.com"
+	_, error = store.Append(export.Records("piedpiper.com", jared)...)
+	require.NoError(t, error)
+
+	report, error := Build(context.Background(), session, Options{Domains: []string{"piedpiper.com"}, Logs: ArchiveLogs(store), Now: now})
+	require.NoError(t, error)
+	assert.True(report.Partial)
+	assert.True(now.Add(-time.Hour).Equal(report.Since))
+	assert.Equal([]Finding{
+		{KindAlias, "piedpiper.com", "*", "no mail since 2020-01-31"},
+		{KindAlias, "piedpiper.com", "richard", "no mail since 2020-01-31"},
+	}, report.Findings)
+
+	pruned, error := report.Prune(context.Background(), session, Policy{Aliases: true})
+	assert.ErrorIs(error, ErrPartialLogs)
+	assert.Empty(pruned)
+	assert.Empty(account.deleted)
+
+	pruned, error = report.Prune(context.Background(), session, Policy{Aliases: true, PartialLogs: true})
+	assert.NoError(error)
+	assert.Len(pruned, 2)
+}
+
+func TestPrune(t *testing.T) {
+	assert := assert.New(t)
+	account, session := setup(t)
+	report := &Report{Findings: []Finding{
+		{KindDomain, "hooli.com", "", "inactive"},
+		{KindAlias, "piedpiper.com", "jared", "no mail"},
+		{KindAlias, "piedpiper.com", "richard", "no mail"},
+		{KindCredential, "piedpiper.com", "monica", "never used"},
+	}}
+	var asked []string
+	pruned, error := report.Prune(context.Background(), session, Policy{
+		Aliases:     true,
+		Credentials: true,
+		Confirm: func(finding Finding) (bool, error) {
+			asked = append(asked, finding.String())
+			return finding.Name != "richard", nil
+		},
+	})
+	assert.NoError(error)
+	assert.Equal([]string{"alias jared@piedpiper.com", "alias richard@piedpiper.com", "credential monica@piedpiper.com"}, asked)
+	assert.Len(pruned, 2)
+	assert.Equal([]string{"/domains/piedpiper.com/aliases/jared/", "/domains/piedpiper.com/credentials/monica"}, account.deleted)
+
+	pruned, error = report.Prune(context.Background(), session, Policy{
+		Domains: true,
+		Confirm: abort,
+	})
+	assert.ErrorContains(error, "aborted")
+	assert.Empty(pruned)
+
+	pruned, error = report.Prune(context.Background(), session, Policy{Domains: true})
+	assert.NoError(error)
+	assert.Equal([]Finding{report.Findings[0]}, pruned)
+	assert.Contains(account.deleted, "/domains/hooli.com/")
+}
+
+func abort(Finding) (bool, error) {
+	return false, fmt.Errorf("aborted")
+}
@@ -0,0 +1,235 @@
+package improvmx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Returned by preflight checks when an operation would exceed a limit of the
+// account's plan. See WithPreflight.
+var ErrLimitExceeded = errors.New("plan limit exceeded")
+
+// The current count and the cap of a single limit. A Limit of zero or less
+// means the plan does not cap it.
+type Quota struct {
+	Used  int
+	Limit int
+}
+
+// The headroom of the account against the limits of its plan. Redirections
+// are not exposed by the ImprovMX REST API, and are not reported.
+type Usage struct {
+	Plan       *AccountPlan
+	Domains    Quota
+	Subdomains Quota
+	// The aliases of each domain, against the per-domain alias limit
+	Aliases map[string]Quota
+}
+
+// The resources an operation is about to create, as checked by Usage.Check.
+type Need struct {
+	// The names of the domains to create
+	Domains []string
+	// The number of aliases to create in each domain
+	Aliases map[string]int
+}
+
+// Returns true if the limit is not capped.
+func (quota Quota) Unlimited() bool {
+	return quota.Limit <= 0
+}
+
+// Returns how many more may be created, or -1 if the limit is not capped.
+func (quota Quota) Remaining() int {
+	if quota.Unlimited() {
+		return -1
+	}
+	return max(quota.Limit-quota.Used, 0)
+}
+
+// Returns true if count more may be created.
+func (quota Quota) Allows(count int) bool {
+	return quota.Unlimited() || quota.Used+count <= quota.Limit
+}
+
+// Returns the usage of the account, counting its domains and the aliases of
+// each domain against Account.Limits, falling back to the limits of
+// Account.Plan.
+func (session *Session) Usage(ctx context.Context) (*Usage, error) {
+	account, error := session.Account.Read(ctx)
+	if error != nil {
+		return nil, error
+	}
+	domains, error := session.Domains.List(ctx)
+	if error != nil {
+		return nil, error
+	}
+	usage := &Usage{
+		Plan:       account.Plan,
+		Domains:    Quota{len(domains), account.Limits.Domains},
+		Subdomains: Quota{0, account.Limits.Subdomains},
+		Aliases:    make(map[string]Quota, len(domains)),
+	}
+	aliasLimit := account.Limits.Aliases
+	if account.Plan != nil {
+		if usage.Domains.Limit == 0 {
+			usage.Domains.Limit = int(account.Plan.DomainsLimit)
+		}
+		if aliasLimit == 0 {
+			aliasLimit = int(account.Plan.AliasesLimit)
+		}
+	}
+	names := make([]string, len(domains))
+	for index, domain := range domains {
+		names[index] = domain.Name
+		usage.Aliases[domain.Name] = Quota{len(domain.Aliases), aliasLimit}
+	}
+	for _, name := range names {
+		if parentDomain(name, names) != "" {
+			usage.Subdomains.Used++
+		}
+	}
+	return usage, nil
+}
+
+// Returns an error wrapping ErrLimitExceeded if creating the needed resources
+// would exceed a limit. Domains to create start without aliases.
+func (usage *Usage) Check(need Need) error {
+	names := make([]string, 0, len(usage.Aliases)+len(need.Domains))
+	for name := range usage.Aliases {
+		names = append(names, name)
+	}
+	names = append(names, need.Domains...)
+	subdomains := 0
+	for _, domain := range need.Domains {
+		if parentDomain(domain, names) != "" {
+			subdomains++
+		}
+	}
+	if !usage.Domains.Allows(len(need.Domains)) {
+		return limitError("domains", "", usage.Domains, len(need.Domains))
+	}
+	if !usage.Subdomains.Allows(subdomains) {
+		return limitError("subdomains", "", usage.Subdomains, subdomains)
+	}
+	domains := make([]string, 0, len(need.Aliases))
+	for domain := range need.Aliases {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	for _, domain := range domains {
+		quota, ok := usage.Aliases[domain]
+		if !ok {
+			quota.Limit = usage.aliasLimit()
+		}
+		if !quota.Allows(need.Aliases[domain]) {
+			return limitError("aliases", domain, quota, need.Aliases[domain])
+		}
+	}
+	return nil
+}
+
+// Retrieves the usage of the account, and checks that the needed resources
+// may be created. See Usage.Check.
+func (session *Session) Preflight(ctx context.Context, need Need) error {
+	usage, error := session.Usage(ctx)
+	if error != nil {
+		return fmt.Errorf("preflight check failed: %w", error)
+	}
+	return usage.Check(need)
+}
+
+// Checks the limits of the account's plan before creating domains or aliases,
+// refusing with ErrLimitExceeded instead of failing partway through. Operations
+// creating several aliases, such as DomainEndpoint.Clone, are checked as a
+// whole before the first one is created. Each check retrieves the usage of the
+// account, which costs a request per page of domains.
+func WithPreflight() SessionOption {
+	return func(session *Session) error {
+		session.preflight = true
+		return nil
+	}
+}
+
+// The per-domain alias limit, which is the same for every domain.
+func (usage *Usage) aliasLimit() int {
+	for _, quota := range usage.Aliases {
+		return quota.Limit
+	}
+	return 0
+}
+
+func limitError(limit, domain string, quota Quota, count int) error {
+	if domain != "" {
+		limit = fmt.Sprintf("%s of %s", limit, domain)
+	}
+	return fmt.Errorf("%w: creating %d %s would exceed the limit of %d (%d used)", ErrLimitExceeded, count, limit, quota.Limit, quota.Used)
+}
+
+// Returns the domain among names that the given domain is a subdomain of, if
+// any.
+func parentDomain(domain string, names []string) string {
+	for _, name := range names {
+		if strings.HasSuffix(strings.ToLower(domain), "."+strings.ToLower(name)) {
+			return name
+		}
+	}
+	return ""
+}
+
+// The resources a batch operation is about to create, so that preflight
+// checks it as a whole.
+type plannedKey struct{}
+
+type plan struct {
+	need  Need
+	once  sync.Once
+	error error
+}
+
+// Returns a context declaring that the operation using it creates the needed
+// resources.
+func withPlan(ctx context.Context, need Need) context.Context {
+	return context.WithValue(ctx, plannedKey{}, &plan{need: need})
+}
+
+// Refuses requests creating domains or aliases that would exceed a limit.
+type preflightTransport struct {
+	session *Session
+	next    http.RoundTripper
+}
+
+func (transport *preflightTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	operation, parameters, _ := transport.session.operation(request)
+	need := Need{}
+	switch operation.endpoint {
+	case "Domains.Create":
+		body := struct {
+			Domain string `json:"domain"`
+		}{}
+		json.Unmarshal(requestBody(request), &body)
+		need.Domains = []string{body.Domain}
+	case "Aliases.Create":
+		need.Aliases = map[string]int{parameters["domain"]: 1}
+	default:
+		return transport.next.RoundTrip(request)
+	}
+	ctx := request.Context()
+	if planned, ok := ctx.Value(plannedKey{}).(*plan); ok && operation.endpoint == "Aliases.Create" {
+		planned.once.Do(func() { planned.error = transport.session.Preflight(ctx, planned.need) })
+		if planned.error != nil {
+			return nil, planned.error
+		}
+		return transport.next.RoundTrip(request)
+	}
+	if error := transport.session.Preflight(ctx, need); error != nil {
+		return nil, error
+	}
+	return transport.next.RoundTrip(request)
+}
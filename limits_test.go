@@ -0,0 +1,151 @@
+package improvmx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"occult.work/doze/test"
+)
+
+// Keeps the domains and aliases of a single account, so that its usage
+// follows the resources created against it.
+type LimitsTestSuite struct {
+	test.Suite
+	session *Session
+	// The limits returned by the account endpoint
+	limits map[string]int
+	// The aliases of every domain, by domain name
+	domains map[string][]Alias
+	// Every request that modified the account, as "METHOD path"
+	writes []string
+}
+
+func (suite *LimitsTestSuite) SetupSuite() {
+	domain := func(name string) map[string]any {
+		return map[string]any{"active": true, "domain": name, "display": name, "added": 1559639733000, "aliases": suite.domains[name]}
+	}
+	// Returns the domain of the request, writing an error if it does not exist
+	domainOf := func(writer http.ResponseWriter, request *http.Request) (string, bool) {
+		name := strings.Split(request.URL.Path, "/")[2]
+		if _, ok := suite.domains[name]; !ok {
+			writer.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(writer, `{ "error": "Domain not found", "code": 404, "success": false }`)
+			return name, false
+		}
+		return name, true
+	}
+	router := test.NewRouter().
+		Get(accountReadPath, func(writer http.ResponseWriter, request *http.Request) {
+			account := map[string]any{"limits": suite.limits, "premium": false, "plan": map[string]any{"name": "free"}}
+			json.NewEncoder(writer).Encode(map[string]any{"account": account, "success": true})
+		}).
+		Get(domainListPath, func(writer http.ResponseWriter, request *http.Request) {
+			domains := []map[string]any{}
+			for _, name := range sortedKeys(suite.domains) {
+				domains = append(domains, domain(name))
+			}
+			json.NewEncoder(writer).Encode(map[string]any{"domains": domains, "total": len(domains), "page": 1, "success": true})
+		}).
+		Post(domainCreatePath, func(writer http.ResponseWriter, request *http.Request) {
+			suite.writes = append(suite.writes, request.Method+" "+request.URL.Path)
+			name := suite.Parameters(request)["domain"]
+			suite.domains[name] = []Alias{}
+			json.NewEncoder(writer).Encode(map[string]any{"domain": domain(name), "success": true})
+		}).
+		Get(domainReadPath, func(writer http.ResponseWriter, request *http.Request) {
+			if name, ok := domainOf(writer, request); ok {
+				json.NewEncoder(writer).Encode(map[string]any{"domain": domain(name), "success": true})
+			}
+		}).
+		Get(aliasListPath, func(writer http.ResponseWriter, request *http.Request) {
+			if name, ok := domainOf(writer, request); ok {
+				aliases := suite.domains[name]
+				json.NewEncoder(writer).Encode(map[string]any{"aliases": aliases, "total": len(aliases), "page": 1, "success": true})
+			}
+		}).
+		Post(aliasCreatePath, func(writer http.ResponseWriter, request *http.Request) {
+			suite.writes = append(suite.writes, request.Method+" "+request.URL.Path)
+			if name, ok := domainOf(writer, request); ok {
+				parameters := suite.Parameters(request)
+				alias := Alias{parameters["forward"], parameters["alias"], int64(len(suite.domains[name]) + 1)}
+				suite.domains[name] = append(suite.domains[name], alias)
+				suite.Render(writer, "testdata/alias/create.json.tmpl", alias)
+			}
+		})
+	suite.Initialize(router)
+	suite.Data = &testData
+	suite.session, _ = New("limits-test-suite", WithBaseURL(suite.Server.URL))
+}
+
+func (suite *LimitsTestSuite) SetupTest() {
+	suite.limits = nil
+	suite.domains = make(map[string][]Alias)
+	suite.writes = nil
+}
+
+func TestLimits(t *testing.T) {
+	test.Run(t, new(LimitsTestSuite))
+}
+
+// Adds a domain with the given aliases, as "name=address" pairs.
+func (suite *LimitsTestSuite) addDomain(name string, aliases ...string) {
+	suite.domains[name] = []Alias{}
+	for _, pair := range aliases {
+		alias, address, _ := strings.Cut(pair, "=")
+		suite.domains[name] = append(suite.domains[name], Alias{address, alias, int64(len(suite.domains[name]) + 1)})
+	}
+}
+
+func (suite *LimitsTestSuite) TestUsage() {
+	suite.limits = map[string]int{"domains": 3, "aliases": 2, "subdomains": 1}
+	suite.addDomain("piedpiper.com", "richard=richard@example.com", "jared=jared@example.com")
+	suite.addDomain("eu.piedpiper.com")
+
+	usage, error := suite.session.Usage(context.Background())
+	suite.Require().NoError(error)
+	suite.Equal(Quota{2, 3}, usage.Domains)
+	suite.Equal(Quota{1, 1}, usage.Subdomains)
+	suite.Equal(map[string]Quota{"piedpiper.com": {2, 2}, "eu.piedpiper.com": {0, 2}}, usage.Aliases)
+	suite.Equal(1, usage.Domains.Remaining())
+	suite.Equal(-1, Quota{5, 0}.Remaining())
+
+	suite.NoError(usage.Check(Need{Domains: []string{"hooli.com"}, Aliases: map[string]int{"eu.piedpiper.com": 2, "hooli.com": 2}}))
+	suite.ErrorIs(usage.Check(Need{Domains: []string{"hooli.com", "piperchat.com"}}), ErrLimitExceeded)
+	suite.ErrorIs(usage.Check(Need{Domains: []string{"us.piedpiper.com"}}), ErrLimitExceeded)
+	error = usage.Check(Need{Aliases: map[string]int{"piedpiper.com": 1}})
+	suite.ErrorIs(error, ErrLimitExceeded)
+	suite.ErrorContains(error, "creating 1 aliases of piedpiper.com would exceed the limit of 2 (2 used)")
+}
+
+func (suite *LimitsTestSuite) TestPreflight() {
+	session, error := New("limits-test-suite", WithBaseURL(suite.Server.URL), WithPreflight())
+	suite.Require().NoError(error)
+	suite.limits = map[string]int{"domains": 2, "aliases": 2}
+	suite.addDomain("piedpiper.com", "richard=richard@example.com", "jared=jared@example.com", "monica=monica@example.com")
+	suite.addDomain("hooli.com", "gavin=gavin@example.com")
+	ctx := context.Background()
+
+	_, error = session.Aliases.Create(ctx, "hooli.com", "denpok", "denpok@example.com")
+	suite.NoError(error)
+	_, error = session.Aliases.Create(ctx, "hooli.com", "hoover", "hoover@example.com")
+	suite.ErrorIs(error, ErrLimitExceeded)
+	_, error = session.Domains.Create(ctx, "piperchat.com")
+	suite.ErrorIs(error, ErrLimitExceeded)
+	suite.Equal([]string{"POST /domains/hooli.com/aliases/"}, suite.writes)
+
+	suite.limits["domains"] = 3
+	result, error := session.Domains.Clone(ctx, "piedpiper.com", "piperchat.com")
+	suite.ErrorIs(error, ErrLimitExceeded)
+	suite.True(result.DomainCreated)
+	suite.Empty(result.Created)
+	suite.Empty(suite.domains["piperchat.com"])
+
+	suite.limits["aliases"] = 3
+	result, error = session.Domains.Clone(ctx, "piedpiper.com", "piperchat.com")
+	suite.NoError(error)
+	suite.Len(result.Created, 3)
+}
@@ -0,0 +1,174 @@
+package improvmx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The layout used by the ImprovMX REST API for the created field of both
+// LogEntry and LogEvent.
+const logTimeLayout = "2006-01-02 15:04:05-0700"
+
+// Describes the delivery of a single LogEntry, as derived from its Events.
+type Timeline struct {
+	// The current delivery state of the message. See LogEntry.FinalStatus.
+	Status MessageStatus
+	// When the message was first queued. Zero if no QUEUED event was found.
+	Queued time.Time
+	// When the message reached a terminal state. Zero if it has not yet done
+	// so.
+	Finished time.Time
+	// Number of times the end destination temporarily refused the message.
+	Retries int
+	// Time between Queued and Finished. Zero if either of them is unknown.
+	Latency time.Duration
+}
+
+// Parses the given string into a MessageStatus. The comparison is case
+// insensitive, and underscores or spaces are treated as dashes, so that
+// "hard_bounce" results in HardBounce.
+//
+// If the status is not one of the known constants, the normalized status is
+// still returned alongside an error, so callers may decide whether to keep it.
+func ParseMessageStatus(value string) (MessageStatus, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(value))
+	normalized = strings.NewReplacer("_", "-", " ", "-").Replace(normalized)
+	status := MessageStatus(normalized)
+	if !status.IsKnown() {
+		return status, fmt.Errorf("unknown message status: %q", value)
+	}
+	return status, nil
+}
+
+// Returns true if the status is one of the statuses documented by the
+// ImprovMX REST API.
+func (status MessageStatus) IsKnown() bool {
+	switch status {
+	case Queued, Refused, Delivered, SoftBounce, HardBounce:
+		return true
+	}
+	return false
+}
+
+// Returns true if no further events are expected for a message with this
+// status.
+func (status MessageStatus) IsTerminal() bool {
+	switch status {
+	case Refused, Delivered, HardBounce:
+		return true
+	}
+	return false
+}
+
+// Returns true if the message was not, and will not be, delivered.
+func (status MessageStatus) IsFailure() bool {
+	return status == Refused || status == HardBounce
+}
+
+// Returns true if ImprovMX will attempt to deliver the message again.
+func (status MessageStatus) IsRetrying() bool {
+	return status == SoftBounce
+}
+
+func (status MessageStatus) String() string {
+	return string(status)
+}
+
+// Returns the parsed value of CreatedAt.
+func (event *LogEvent) Created() (time.Time, error) {
+	return parseLogTime(event.CreatedAt)
+}
+
+// Returns the parsed value of CreatedAt.
+func (entry *LogEntry) Created() (time.Time, error) {
+	return parseLogTime(entry.CreatedAt)
+}
+
+// Returns the current delivery state of the entry. This is the status of the
+// first terminal event, or the status of the most recent event if the message
+// is still in flight. An empty MessageStatus is returned if there are no
+// events.
+func (entry *LogEntry) FinalStatus() MessageStatus {
+	events, _ := entry.sortedEvents()
+	return finalStatus(events)
+}
+
+// Returns the Timeline of the entry. An error is returned if the created time
+// of any event cannot be parsed.
+func (entry *LogEntry) Timeline() (*Timeline, error) {
+	events, error := entry.sortedEvents()
+	if error != nil {
+		return nil, error
+	}
+	timeline := &Timeline{Status: finalStatus(events)}
+	for _, event := range events {
+		created, _ := event.Created()
+		switch {
+		case event.Status == Queued && timeline.Queued.IsZero():
+			timeline.Queued = created
+		case event.Status.IsRetrying():
+			timeline.Retries++
+		case event.Status.IsTerminal():
+			timeline.Finished = created
+		}
+		if event.Status.IsTerminal() {
+			break
+		}
+	}
+	if !timeline.Queued.IsZero() && !timeline.Finished.IsZero() {
+		timeline.Latency = timeline.Finished.Sub(timeline.Queued)
+	}
+	return timeline, nil
+}
+
+// Returns a copy of the entry's events, ordered by their created time. If any
+// time cannot be parsed, the events are returned in their original order
+// alongside the error.
+func (entry *LogEntry) sortedEvents() ([]LogEvent, error) {
+	events := make([]LogEvent, len(entry.Events))
+	copy(events, entry.Events)
+	times := make([]time.Time, len(events))
+	for index := range events {
+		created, error := events[index].Created()
+		if error != nil {
+			return events, error
+		}
+		times[index] = created
+	}
+	sort.Stable(eventsByTime{events, times})
+	return events, nil
+}
+
+func finalStatus(events []LogEvent) MessageStatus {
+	var status MessageStatus
+	for _, event := range events {
+		status = event.Status
+		if status.IsTerminal() {
+			break
+		}
+	}
+	return status
+}
+
+func parseLogTime(value string) (time.Time, error) {
+	return time.Parse(logTimeLayout, value)
+}
+
+// Sorts a slice of LogEvent by their parsed created time.
+type eventsByTime struct {
+	events []LogEvent
+	times  []time.Time
+}
+
+func (sorter eventsByTime) Len() int { return len(sorter.events) }
+
+func (sorter eventsByTime) Less(i, j int) bool {
+	return sorter.times[i].Before(sorter.times[j])
+}
+
+func (sorter eventsByTime) Swap(i, j int) {
+	sorter.events[i], sorter.events[j] = sorter.events[j], sorter.events[i]
+	sorter.times[i], sorter.times[j] = sorter.times[j], sorter.times[i]
+}
@@ -0,0 +1,79 @@
+package improvmx
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func loadLogs(t *testing.T, path string) []LogEntry {
+	data, error := testData.ReadFile(path)
+	assert.NoError(t, error)
+	response := logsResponse{}
+	assert.NoError(t, json.Unmarshal(data, &response))
+	return response.Logs
+}
+
+func TestParseMessageStatus(t *testing.T) {
+	assert := assert.New(t)
+	status, error := ParseMessageStatus("hard_bounce")
+	assert.NoError(error)
+	assert.Equal(HardBounce, status)
+
+	status, error = ParseMessageStatus(" delivered ")
+	assert.NoError(error)
+	assert.Equal(Delivered, status)
+
+	status, error = ParseMessageStatus("deferred")
+	assert.Error(error)
+	assert.Equal(MessageStatus("DEFERRED"), status)
+	assert.False(status.IsKnown())
+}
+
+func TestMessageStatusPredicates(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(Delivered.IsTerminal())
+	assert.False(Delivered.IsFailure())
+	assert.True(Refused.IsFailure())
+	assert.True(HardBounce.IsFailure())
+	assert.True(SoftBounce.IsRetrying())
+	assert.False(SoftBounce.IsTerminal())
+	assert.False(Queued.IsTerminal())
+	assert.Equal(Delivered, Delievered)
+}
+
+func TestLogEntryFinalStatus(t *testing.T) {
+	assert := assert.New(t)
+	logs := loadLogs(t, "testdata/alias/logs.json")
+	assert.Len(logs, 2)
+	assert.Equal(Delivered, logs[0].FinalStatus())
+	assert.Equal(Refused, logs[1].FinalStatus())
+	assert.Equal(MessageStatus(""), (&LogEntry{}).FinalStatus())
+}
+
+func TestLogEntryTimeline(t *testing.T) {
+	assert := assert.New(t)
+	logs := loadLogs(t, "testdata/alias/logs.json")
+	timeline, error := logs[0].Timeline()
+	assert.NoError(error)
+	assert.Equal(Delivered, timeline.Status)
+	assert.Equal(time.Second, timeline.Latency)
+	assert.Zero(timeline.Retries)
+
+	entry := LogEntry{Events: []LogEvent{
+		{CreatedAt: "2020-01-25 12:30:00+0000", Status: Delivered},
+		{CreatedAt: "2020-01-25 12:00:00+0000", Status: Queued},
+		{CreatedAt: "2020-01-25 12:10:00+0000", Status: SoftBounce},
+	}}
+	timeline, error = entry.Timeline()
+	assert.NoError(error)
+	assert.Equal(Delivered, timeline.Status)
+	assert.Equal(1, timeline.Retries)
+	assert.Equal(30*time.Minute, timeline.Latency)
+
+	entry.Events[0].CreatedAt = "yesterday"
+	_, error = entry.Timeline()
+	assert.Error(error)
+}
@@ -0,0 +1,183 @@
+package improvmx
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// Replaces secrets in logged headers and bodies.
+const redacted = "[REDACTED]"
+
+// The levels at which a Session created WithLogger logs its requests.
+type LogLevels struct {
+	// Level of requests about to be sent
+	Request slog.Level
+	// Level of responses with a successful status code
+	Response slog.Level
+	// Level of responses with a failing status code, and of transport errors
+	Failure slog.Level
+}
+
+// The levels used by WithLogger unless WithLogLevels is given.
+var DefaultLogLevels = LogLevels{
+	Request:  slog.LevelDebug,
+	Response: slog.LevelDebug,
+	Failure:  slog.LevelWarn,
+}
+
+// Logs every request and response of the session to the given logger. The
+// Authorization header and any password within a request or response body are
+// always redacted, and bodies are only read when the logger is enabled for the
+// level they would be logged at.
+func WithLogger(logger *slog.Logger) SessionOption {
+	return func(session *Session) error {
+		session.logger = logger
+		return nil
+	}
+}
+
+// Sets the levels used by WithLogger. By default, this is DefaultLogLevels.
+func WithLogLevels(levels LogLevels) SessionOption {
+	return func(session *Session) error {
+		session.logLevels = levels
+		return nil
+	}
+}
+
+// Logs requests sent through next.
+type logTransport struct {
+	session *Session
+	logger  *slog.Logger
+	levels  LogLevels
+	next    http.RoundTripper
+}
+
+func (transport *logTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	ctx := request.Context()
+	attributes := []slog.Attr{
+		slog.String("method", request.Method),
+		slog.String("url", request.URL.String()),
+	}
+	if operation, _, ok := transport.session.operation(request); ok {
+		attributes = append(attributes, slog.String("endpoint", operation.endpoint))
+	}
+	if transport.logger.Enabled(ctx, transport.levels.Request) {
+		transport.logger.LogAttrs(ctx, transport.levels.Request, "improvmx request", append(attributes,
+			slog.Any("header", redactHeader(request.Header)),
+			slog.String("body", redactBody(requestBody(request))))...)
+	}
+	start := time.Now()
+	response, error := transport.next.RoundTrip(request)
+	attributes = append(attributes, slog.Duration("duration", time.Since(start)))
+	if error != nil {
+		transport.logger.LogAttrs(ctx, transport.levels.Failure, "improvmx request failed",
+			append(attributes, slog.Any("error", error))...)
+		return response, error
+	}
+	level := transport.levels.Response
+	if response.StatusCode >= 400 {
+		level = transport.levels.Failure
+	}
+	if transport.logger.Enabled(ctx, level) {
+		transport.logger.LogAttrs(ctx, level, "improvmx response", append(attributes,
+			slog.Int("status", response.StatusCode),
+			slog.String("body", redactBody(responseBody(response))))...)
+	}
+	return response, error
+}
+
+// Returns the body of the request without consuming it.
+func requestBody(request *http.Request) []byte {
+	if request.Body == nil || request.Body == http.NoBody {
+		return nil
+	}
+	if request.GetBody != nil {
+		if body, error := request.GetBody(); error == nil {
+			defer body.Close()
+			data, _ := io.ReadAll(body)
+			return data
+		}
+	}
+	data, _ := io.ReadAll(request.Body)
+	request.Body.Close()
+	request.Body = io.NopCloser(bytes.NewReader(data))
+	return data
+}
+
+// Returns the body of the response, replacing it with an in-memory copy.
+func responseBody(response *http.Response) []byte {
+	if response.Body == nil {
+		return nil
+	}
+	data, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	response.Body = io.NopCloser(bytes.NewReader(data))
+	return data
+}
+
+// Returns a copy of the header with any credentials redacted.
+func redactHeader(header http.Header) http.Header {
+	copied := header.Clone()
+	for _, name := range []string{"Authorization", "Proxy-Authorization"} {
+		if _, ok := copied[name]; ok {
+			copied.Set(name, redacted)
+		}
+	}
+	return copied
+}
+
+// Returns the body with the value of every "password" field redacted. Bodies
+// that are not JSON are returned unchanged, as the ImprovMX REST API only
+// sends passwords as JSON.
+func redactBody(body []byte) string {
+	var value any
+	if len(body) == 0 || json.Unmarshal(body, &value) != nil {
+		return string(body)
+	}
+	if !redactValue(value) {
+		return string(body)
+	}
+	data, error := json.Marshal(value)
+	if error != nil {
+		return redacted
+	}
+	return string(data)
+}
+
+// Redacts password fields within the decoded JSON value in place, and returns
+// true if any were found.
+func redactValue(value any) bool {
+	found := false
+	switch value := value.(type) {
+	case map[string]any:
+		for key, field := range value {
+			if strings.EqualFold(key, "password") {
+				value[key] = redacted
+				found = true
+			} else if redactValue(field) {
+				found = true
+			}
+		}
+	case []any:
+		for _, element := range value {
+			if redactValue(element) {
+				found = true
+			}
+		}
+	}
+	return found
+}
+
+// Redacts credentials from the requests logged by resty in debug mode.
+func redactRequestLog(log *resty.RequestLog) error {
+	log.Header = redactHeader(log.Header)
+	log.Body = redactBody([]byte(log.Body))
+	return nil
+}
@@ -0,0 +1,115 @@
+package improvmx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"occult.work/doze/test"
+)
+
+type LoggerTestSuite struct {
+	test.Suite
+	output *bytes.Buffer
+}
+
+func (suite *LoggerTestSuite) SetupSuite() {
+	router := test.NewRouter().
+		Post(credentialsCreatePath, suite.FileResponseHandler("testdata/credential/create.json")).
+		Put(credentialsUpdatePath, func(writer http.ResponseWriter, request *http.Request) {
+			writer.WriteHeader(420)
+			fmt.Fprint(writer, `{ "error": "fake error", "code": 420, "success": false }`)
+		})
+	suite.Initialize(router)
+	suite.Data = &testData
+}
+
+func (suite *LoggerTestSuite) SetupTest() {
+	suite.output = &bytes.Buffer{}
+}
+
+func (suite *LoggerTestSuite) session(level slog.Level) *Session {
+	logger := slog.New(slog.NewJSONHandler(suite.output, &slog.HandlerOptions{Level: level}))
+	session, error := New("secret-token", WithBaseURL(suite.Server.URL), WithLogger(logger))
+	suite.Require().NoError(error)
+	return session
+}
+
+func (suite *LoggerTestSuite) records() []map[string]any {
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(suite.output.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		record := map[string]any{}
+		suite.Require().NoError(json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLogger(t *testing.T) {
+	test.Run(t, new(LoggerTestSuite))
+}
+
+func (suite *LoggerTestSuite) TestRedaction() {
+	session := suite.session(slog.LevelDebug)
+	_, error := session.Credentials.Create(context.Background(), "example.com", User{"richard", "hunter2"})
+	suite.Require().NoError(error)
+	suite.NotContains(suite.output.String(), "hunter2")
+	suite.NotContains(suite.output.String(), "secret-token")
+
+	records := suite.records()
+	suite.Require().Len(records, 2)
+	suite.Equal("improvmx request", records[0]["msg"])
+	suite.Equal("DEBUG", records[0]["level"])
+	suite.Equal("Credentials.Create", records[0]["endpoint"])
+	suite.Equal(`{"password":"[REDACTED]","username":"richard"}`, records[0]["body"])
+	header := records[0]["header"].(map[string]any)
+	suite.Equal([]any{redacted}, header["Authorization"])
+	suite.Equal("improvmx response", records[1]["msg"])
+	suite.Equal(float64(http.StatusOK), records[1]["status"])
+}
+
+func (suite *LoggerTestSuite) TestLevels() {
+	session := suite.session(slog.LevelInfo)
+	_, error := session.Credentials.Create(context.Background(), "example.com", User{"richard", "hunter2"})
+	suite.Require().NoError(error)
+	suite.Empty(suite.output.String())
+
+	_, error = session.Credentials.Update(context.Background(), "example.com", User{"richard", "hunter2"})
+	suite.Require().Error(error)
+	records := suite.records()
+	suite.Require().Len(records, 1)
+	suite.Equal("WARN", records[0]["level"])
+	suite.Equal("Credentials.Update", records[0]["endpoint"])
+	suite.Equal(float64(420), records[0]["status"])
+}
+
+func TestRedactBody(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`{"password":"[REDACTED]"}`, redactBody([]byte(`{"password": "hunter2"}`)))
+	assert.Equal(`[{"user":{"Password":"[REDACTED]"}}]`, redactBody([]byte(`[{"user": {"Password": "hunter2"}}]`)))
+	assert.Equal(`{"alias": "richard"}`, redactBody([]byte(`{"alias": "richard"}`)))
+	assert.Equal("password=hunter2", redactBody([]byte("password=hunter2")))
+	assert.Equal("", redactBody(nil))
+}
+
+func TestRedactRequestLog(t *testing.T) {
+	assert := assert.New(t)
+	log := &resty.RequestLog{
+		Header: http.Header{"Authorization": {"Basic YXBpOnRva2Vu"}, "Accept": {"application/json"}},
+		Body:   `{"password": "hunter2"}`,
+	}
+	assert.NoError(redactRequestLog(log))
+	assert.Equal(redacted, log.Header.Get("Authorization"))
+	assert.Equal("application/json", log.Header.Get("Accept"))
+	assert.NotContains(log.Body, "hunter2")
+}
@@ -0,0 +1,351 @@
+// Package migrate emulates renaming a domain, which the ImprovMX REST API does
+// not support, by creating the new domain, copying its aliases and SMTP
+// credentials, waiting for its DNS records to be verified, and only then
+// optionally deleting the old domain.
+//
+// Progress is recorded in a state file after every step, so that an
+// interrupted migration resumes where it stopped when run again.
+package migrate
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"occult.work/improvmx"
+)
+
+const (
+	// The target domain exists.
+	StepCreate Step = "create-domain"
+	// Every alias of the source domain exists on the target domain.
+	StepAliases Step = "copy-aliases"
+	// Every SMTP credential of the source domain exists on the target domain.
+	StepCredentials Step = "copy-credentials"
+	// The DNS records of the target domain are valid.
+	StepVerify Step = "verify"
+	// The source domain was deleted.
+	StepDelete Step = "delete-source"
+)
+
+// The default time between checks of the target domain's DNS records.
+const DefaultVerifyInterval = time.Minute
+
+// The alphabet used by GeneratePassword.
+const passwordAlphabet = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// A stage of a migration, in the order they are run.
+type Step string
+
+// Returns the password of a credential copied to the target domain.
+type PasswordFunc func(ctx context.Context, username string) (string, error)
+
+// Controls how a Migration is run.
+type Options struct {
+	// The path of the state file. If empty, progress is not persisted.
+	StateFile string
+	// Controls how aliases are copied. See improvmx.DomainEndpoint.Clone.
+	Clone improvmx.CloneOption
+	// Copies SMTP credentials, which requires a premium account.
+	Credentials bool
+	// Returns the password of each copied credential, as the ImprovMX REST
+	// API does not reveal existing passwords. Defaults to GeneratePassword.
+	Password PasswordFunc
+	// Time between checks of the target domain's DNS records. Defaults to
+	// DefaultVerifyInterval.
+	VerifyInterval time.Duration
+	// How long to wait for the target domain to be verified. If zero, Run
+	// waits until its context is done.
+	VerifyTimeout time.Duration
+	// Deletes the source domain once the target domain is verified.
+	DeleteSource bool
+	// Deletes the source domain even if some of its aliases conflicted with
+	// existing aliases of the target domain, whose mail is then forwarded to
+	// the existing addresses. Otherwise, deleting the source domain fails.
+	AllowConflicts bool
+	// Called when a step starts, and for each copied resource. May be nil.
+	Progress func(step Step, message string)
+}
+
+// The progress of a migration, as persisted to the state file. Passwords are
+// never persisted.
+type State struct {
+	Source    string    `json:"source"`
+	Target    string    `json:"target"`
+	Completed []Step    `json:"completed"`
+	Started   time.Time `json:"started"`
+	Updated   time.Time `json:"updated"`
+	// Usernames of the credentials already copied to the target domain.
+	Credentials []string `json:"credentials,omitempty"`
+	// Aliases that already existed on the target domain with a different
+	// address, and were left untouched.
+	Conflicts []improvmx.CloneConflict `json:"conflicts,omitempty"`
+}
+
+// The outcome of a single Run.
+type Result struct {
+	State State
+	// Passwords of the credentials copied during this run, keyed by username.
+	// These are not persisted, and cannot be recovered from the ImprovMX REST
+	// API later.
+	Passwords map[string]string
+}
+
+// Moves a domain to a new name. Create one with New, and call Run until it
+// succeeds.
+type Migration struct {
+	session *improvmx.Session
+	options Options
+	state   State
+}
+
+// Returns a migration of source to target. If the state file already exists,
+// it is loaded so that Run resumes where a previous run stopped. An error is
+// returned if it records a migration between different domains.
+func New(session *improvmx.Session, source, target string, options Options) (*Migration, error) {
+	if source == "" || target == "" || source == target {
+		return nil, fmt.Errorf("invalid migration from %q to %q", source, target)
+	}
+	if options.Password == nil {
+		options.Password = func(context.Context, string) (string, error) { return GeneratePassword(24) }
+	}
+	if options.VerifyInterval <= 0 {
+		options.VerifyInterval = DefaultVerifyInterval
+	}
+	migration := &Migration{session, options, State{Source: source, Target: target, Started: time.Now().UTC()}}
+	if options.StateFile == "" {
+		return migration, nil
+	}
+	data, error := os.ReadFile(options.StateFile)
+	if errors.Is(error, fs.ErrNotExist) {
+		return migration, nil
+	}
+	if error != nil {
+		return nil, error
+	}
+	state := State{}
+	if error := json.Unmarshal(data, &state); error != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", options.StateFile, error)
+	}
+	if state.Source != source || state.Target != target {
+		return nil, fmt.Errorf("%s records a migration from %s to %s", options.StateFile, state.Source, state.Target)
+	}
+	migration.state = state
+	return migration, nil
+}
+
+// Returns a copy of the current state of the migration.
+func (migration *Migration) State() State {
+	state := migration.state
+	state.Completed = append([]Step(nil), state.Completed...)
+	state.Credentials = append([]string(nil), state.Credentials...)
+	state.Conflicts = append([]improvmx.CloneConflict(nil), state.Conflicts...)
+	return state
+}
+
+// Returns true if the step was completed by this or a previous run.
+func (migration *Migration) Completed(step Step) bool {
+	for _, completed := range migration.state.Completed {
+		if completed == step {
+			return true
+		}
+	}
+	return false
+}
+
+// Runs every step not yet completed, saving the state file after each one.
+// If a step fails, its error is returned and Run may be called again, with the
+// same or a new Migration, to resume.
+func (migration *Migration) Run(ctx context.Context) (*Result, error) {
+	result := &Result{Passwords: make(map[string]string)}
+	steps := []struct {
+		step    Step
+		enabled bool
+		run     func(context.Context, *Result) error
+	}{
+		{StepCreate, true, migration.create},
+		{StepAliases, true, migration.copyAliases},
+		{StepCredentials, migration.options.Credentials, migration.copyCredentials},
+		{StepVerify, true, migration.verify},
+		{StepDelete, migration.options.DeleteSource, migration.deleteSource},
+	}
+	for _, step := range steps {
+		if !step.enabled || migration.Completed(step.step) {
+			continue
+		}
+		migration.progress(step.step, "starting")
+		failure := step.run(ctx, result)
+		if failure == nil {
+			migration.state.Completed = append(migration.state.Completed, step.step)
+		}
+		if error := migration.save(); error != nil {
+			return result, errors.Join(failure, error)
+		}
+		if failure != nil {
+			result.State = migration.State()
+			return result, fmt.Errorf("%s: %w", step.step, failure)
+		}
+	}
+	result.State = migration.State()
+	return result, nil
+}
+
+func (migration *Migration) create(ctx context.Context, result *Result) error {
+	source, error := migration.session.Domains.Read(ctx, migration.state.Source)
+	if error != nil {
+		return error
+	}
+	_, changed, error := migration.session.EnsureDomain(ctx, migration.state.Target, improvmx.DomainOption{
+		Email: source.NotificationEmail,
+		Label: source.Whitelabel,
+	})
+	if changed {
+		migration.progress(StepCreate, "created "+migration.state.Target)
+	}
+	return error
+}
+
+func (migration *Migration) copyAliases(ctx context.Context, result *Result) error {
+	clone, error := migration.session.Domains.Clone(ctx, migration.state.Source, migration.state.Target, migration.options.Clone)
+	if clone != nil {
+		for _, alias := range clone.Created {
+			migration.progress(StepAliases, fmt.Sprintf("created %s@%s", alias.Name, migration.state.Target))
+		}
+		for _, alias := range clone.Updated {
+			migration.progress(StepAliases, fmt.Sprintf("updated %s@%s", alias.Name, migration.state.Target))
+		}
+		migration.state.Conflicts = clone.Conflicts
+		for _, conflict := range clone.Conflicts {
+			migration.progress(StepAliases, fmt.Sprintf("conflict: %s@%s forwards to %s", conflict.Alias, migration.state.Target, conflict.Existing))
+		}
+	}
+	return error
+}
+
+func (migration *Migration) copyCredentials(ctx context.Context, result *Result) error {
+	credentials, error := migration.session.Credentials.List(ctx, migration.state.Source)
+	if error != nil {
+		return error
+	}
+	for _, credential := range credentials {
+		if migration.copied(credential.Username) {
+			continue
+		}
+		password, error := migration.options.Password(ctx, credential.Username)
+		if error != nil {
+			return fmt.Errorf("failed to get password for %s: %w", credential.Username, error)
+		}
+		user := improvmx.User{Username: credential.Username, Password: password}
+		_, changed, error := migration.session.EnsureCredential(ctx, migration.state.Target, user)
+		if error != nil {
+			return error
+		}
+		if changed {
+			result.Passwords[credential.Username] = password
+			migration.progress(StepCredentials, "created "+credential.Username)
+		}
+		migration.state.Credentials = append(migration.state.Credentials, credential.Username)
+		if error := migration.save(); error != nil {
+			return error
+		}
+	}
+	return nil
+}
+
+func (migration *Migration) verify(ctx context.Context, result *Result) error {
+	if migration.options.VerifyTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, migration.options.VerifyTimeout)
+		defer cancel()
+	}
+	ticker := time.NewTicker(migration.options.VerifyInterval)
+	defer ticker.Stop()
+	for {
+		check, error := migration.session.Domains.Check(ctx, migration.state.Target)
+		if error != nil {
+			return error
+		}
+		if check.Valid {
+			return nil
+		}
+		migration.progress(StepVerify, fmt.Sprintf("%s is not verified yet: %s", migration.state.Target, check.Error))
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s was not verified: %w", migration.state.Target, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (migration *Migration) deleteSource(ctx context.Context, result *Result) error {
+	if conflicts := len(migration.state.Conflicts); conflicts > 0 && !migration.options.AllowConflicts {
+		return fmt.Errorf("refusing to delete %s: %d aliases conflict with %s", migration.state.Source, conflicts, migration.state.Target)
+	}
+	if error := migration.session.Domains.Delete(ctx, migration.state.Source); error != nil {
+		return error
+	}
+	migration.progress(StepDelete, "deleted "+migration.state.Source)
+	return nil
+}
+
+func (migration *Migration) copied(username string) bool {
+	for _, copied := range migration.state.Credentials {
+		if copied == username {
+			return true
+		}
+	}
+	return false
+}
+
+func (migration *Migration) progress(step Step, message string) {
+	if migration.options.Progress != nil {
+		migration.options.Progress(step, message)
+	}
+}
+
+// Writes the state file atomically, if one is configured.
+func (migration *Migration) save() error {
+	migration.state.Updated = time.Now().UTC()
+	if migration.options.StateFile == "" {
+		return nil
+	}
+	data, error := json.MarshalIndent(migration.state, "", "  ")
+	if error != nil {
+		return error
+	}
+	temporary, error := os.CreateTemp(filepath.Dir(migration.options.StateFile), ".migrate-*")
+	if error != nil {
+		return error
+	}
+	defer os.Remove(temporary.Name())
+	if _, error := temporary.Write(append(data, '\n')); error != nil {
+		temporary.Close()
+		return error
+	}
+	if error := temporary.Close(); error != nil {
+		return error
+	}
+	return os.Rename(temporary.Name(), migration.options.StateFile)
+}
+
+// Returns a random password of the given length, drawn from letters and digits
+// that cannot be mistaken for one another.
+func GeneratePassword(length int) (string, error) {
+	password := make([]byte, length)
+	limit := big.NewInt(int64(len(passwordAlphabet)))
+	for index := range password {
+		value, error := rand.Int(rand.Reader, limit)
+		if error != nil {
+			return "", error
+		}
+		password[index] = passwordAlphabet[value.Int64()]
+	}
+	return string(password), nil
+}
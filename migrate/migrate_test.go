@@ -0,0 +1,244 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"occult.work/improvmx"
+)
+
+type fakeDomain struct {
+	email       string
+	aliases     map[string]string
+	credentials map[string]string
+	// Number of checks left before the domain is reported as valid
+	checks int
+}
+
+// Serves the requests made by a Migration from memory.
+type fakeAccount struct {
+	mutex    sync.Mutex
+	domains  map[string]*fakeDomain
+	failures map[string]int
+}
+
+func (account *fakeAccount) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	account.mutex.Lock()
+	defer account.mutex.Unlock()
+	writer.Header().Set("Content-Type", "application/json")
+	key := request.Method + " " + request.URL.Path
+	if status, ok := account.failures[key]; ok {
+		delete(account.failures, key)
+		writer.WriteHeader(status)
+		fmt.Fprintf(writer, `{ "error": "failure", "code": %d, "success": false }`, status)
+		return
+	}
+	body := map[string]string{}
+	json.NewDecoder(request.Body).Decode(&body)
+	segments := strings.Split(strings.Trim(request.URL.Path, "/"), "/")
+	respond := func(value map[string]any) {
+		value["success"] = true
+		json.NewEncoder(writer).Encode(value)
+	}
+	domainJSON := func(name string) map[string]any {
+		return map[string]any{"domain": name, "notification_email": account.domains[name].email, "added": 0}
+	}
+	if len(segments) == 1 && request.Method == http.MethodPost {
+		account.domains[body["domain"]] = &fakeDomain{body["notification_email"], map[string]string{}, map[string]string{}, 1}
+		respond(map[string]any{"domain": domainJSON(body["domain"])})
+		return
+	}
+	domain, ok := account.domains[segments[1]]
+	if !ok {
+		writer.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(writer, `{ "error": "Domain not found", "code": 404, "success": false }`)
+		return
+	}
+	switch request.Method + " " + strings.Join(append([]string{""}, segments[2:]...), "/") {
+	case "GET ":
+		respond(map[string]any{"domain": domainJSON(segments[1])})
+	case "DELETE ":
+		delete(account.domains, segments[1])
+		respond(map[string]any{})
+	case "GET /check":
+		domain.checks--
+		respond(map[string]any{"records": map[string]any{"valid": domain.checks < 0, "error": "MX record missing"}})
+	case "GET /aliases":
+		var aliases []improvmx.Alias
+		for name, address := range domain.aliases {
+			aliases = append(aliases, improvmx.Alias{Name: name, Address: address})
+		}
+		sort.Slice(aliases, func(i, j int) bool { return aliases[i].Name < aliases[j].Name })
+		respond(map[string]any{"aliases": aliases, "total": len(aliases)})
+	case "POST /aliases":
+		domain.aliases[body["alias"]] = body["forward"]
+		respond(map[string]any{"alias": map[string]any{"alias": body["alias"], "forward": body["forward"]}})
+	case "GET /credentials":
+		credentials := []map[string]any{}
+		for _, username := range sortedKeys(domain.credentials) {
+			credentials = append(credentials, map[string]any{"username": username, "created": 0})
+		}
+		respond(map[string]any{"credentials": credentials})
+	case "POST /credentials":
+		domain.credentials[body["username"]] = body["password"]
+		respond(map[string]any{"credential": map[string]any{"username": body["username"], "created": 0}})
+	default:
+		writer.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(writer, `{ "error": "Not found", "code": 404, "success": false }`)
+	}
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func setup(t *testing.T) (*fakeAccount, *improvmx.Session) {
+	account := &fakeAccount{
+		domains: map[string]*fakeDomain{
+			"piedpiper.com": {
+				email:       "admin@piedpiper.com",
+				aliases:     map[string]string{"richard": "richard@example.com", "jared": "jared@example.com"},
+				credentials: map[string]string{"richard": "hunter2", "monica": "hunter3"},
+			},
+		},
+		failures: make(map[string]int),
+	}
+	server := httptest.NewServer(account)
+	t.Cleanup(server.Close)
+	session, error := improvmx.New("token", improvmx.WithBaseURL(server.URL))
+	require.NoError(t, error)
+	return account, session
+}
+
+func TestMigration(t *testing.T) {
+	assert := assert.New(t)
+	account, session := setup(t)
+	var messages []string
+	options := Options{
+		StateFile:      filepath.Join(t.TempDir(), "state.json"),
+		Credentials:    true,
+		VerifyInterval: time.Millisecond,
+		DeleteSource:   true,
+		Password: func(ctx context.Context, username string) (string, error) {
+			return "new-" + username, nil
+		},
+		Progress: func(step Step, message string) {
+			messages = append(messages, fmt.Sprintf("%s: %s", step, message))
+		},
+	}
+	migration, error := New(session, "piedpiper.com", "piperchat.com", options)
+	require.NoError(t, error)
+	result, error := migration.Run(context.Background())
+	require.NoError(t, error)
+	assert.Equal([]Step{StepCreate, StepAliases, StepCredentials, StepVerify, StepDelete}, result.State.Completed)
+	assert.Equal(map[string]string{"monica": "new-monica", "richard": "new-richard"}, result.Passwords)
+	assert.Equal([]string{"monica", "richard"}, result.State.Credentials)
+
+	assert.NotContains(account.domains, "piedpiper.com")
+	target := account.domains["piperchat.com"]
+	assert.Equal("admin@piedpiper.com", target.email)
+	assert.Equal(map[string]string{"richard": "richard@example.com", "jared": "jared@example.com"}, target.aliases)
+	assert.Equal(map[string]string{"richard": "new-richard", "monica": "new-monica"}, target.credentials)
+	assert.Contains(messages, "verify: piperchat.com is not verified yet: MX record missing")
+
+	data, error := os.ReadFile(options.StateFile)
+	require.NoError(t, error)
+	assert.NotContains(string(data), "new-richard")
+}
+
+func TestMigrationResume(t *testing.T) {
+	assert := assert.New(t)
+	account, session := setup(t)
+	options := Options{
+		StateFile:      filepath.Join(t.TempDir(), "state.json"),
+		Credentials:    true,
+		VerifyInterval: time.Millisecond,
+		VerifyTimeout:  50 * time.Millisecond,
+		DeleteSource:   true,
+	}
+	account.failures["POST /domains/piperchat.com/credentials/"] = http.StatusInternalServerError
+	migration, error := New(session, "piedpiper.com", "piperchat.com", options)
+	require.NoError(t, error)
+	result, error := migration.Run(context.Background())
+	assert.ErrorContains(error, string(StepCredentials))
+	assert.Equal([]Step{StepCreate, StepAliases}, result.State.Completed)
+	assert.Contains(account.domains, "piedpiper.com")
+
+	account.domains["piperchat.com"].checks = 1 << 30
+	migration, error = New(session, "piedpiper.com", "piperchat.com", options)
+	require.NoError(t, error)
+	result, error = migration.Run(context.Background())
+	assert.ErrorIs(error, context.DeadlineExceeded)
+	assert.Equal([]Step{StepCreate, StepAliases, StepCredentials}, result.State.Completed)
+	assert.Len(result.Passwords, 2)
+	assert.Len(result.Passwords["monica"], 24)
+	assert.Contains(account.domains, "piedpiper.com")
+
+	account.domains["piperchat.com"].checks = 0
+	migration, error = New(session, "piedpiper.com", "piperchat.com", options)
+	require.NoError(t, error)
+	result, error = migration.Run(context.Background())
+	assert.NoError(error)
+	assert.Empty(result.Passwords)
+	assert.NotContains(account.domains, "piedpiper.com")
+
+	_, error = New(session, "piedpiper.com", "hooli.com", options)
+	assert.Error(error)
+	_, error = New(session, "piedpiper.com", "piedpiper.com", Options{})
+	assert.Error(error)
+}
+
+func TestMigrationConflicts(t *testing.T) {
+	assert := assert.New(t)
+	account, session := setup(t)
+	account.domains["piperchat.com"] = &fakeDomain{"admin@piedpiper.com", map[string]string{"richard": "gavin@hooli.com"}, map[string]string{}, 0}
+	options := Options{
+		StateFile:      filepath.Join(t.TempDir(), "state.json"),
+		VerifyInterval: time.Millisecond,
+		DeleteSource:   true,
+	}
+	migration, error := New(session, "piedpiper.com", "piperchat.com", options)
+	require.NoError(t, error)
+	result, error := migration.Run(context.Background())
+	assert.ErrorContains(error, "1 aliases conflict with piperchat.com")
+	assert.Equal([]Step{StepCreate, StepAliases, StepVerify}, result.State.Completed)
+	assert.Equal([]improvmx.CloneConflict{{Alias: "richard", Existing: "gavin@hooli.com", Wanted: "richard@example.com"}}, result.State.Conflicts)
+	assert.Contains(account.domains, "piedpiper.com")
+
+	options.AllowConflicts = true
+	migration, error = New(session, "piedpiper.com", "piperchat.com", options)
+	require.NoError(t, error)
+	result, error = migration.Run(context.Background())
+	assert.NoError(error)
+	assert.Contains(result.State.Completed, StepDelete)
+	assert.NotContains(account.domains, "piedpiper.com")
+	assert.Equal("gavin@hooli.com", account.domains["piperchat.com"].aliases["richard"])
+}
+
+func TestGeneratePassword(t *testing.T) {
+	assert := assert.New(t)
+	first, error := GeneratePassword(32)
+	assert.NoError(error)
+	second, error := GeneratePassword(32)
+	assert.NoError(error)
+	assert.Len(first, 32)
+	assert.NotEqual(first, second)
+	assert.Empty(strings.Trim(first, passwordAlphabet))
+}
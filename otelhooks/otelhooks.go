@@ -0,0 +1,52 @@
+// Package otelhooks records the requests sent by an improvmx.Session as
+// OpenTelemetry spans.
+//
+//	tracer := otel.Tracer("occult.work/improvmx")
+//	session, error := improvmx.New(token, improvmx.WithHooks(otelhooks.Hooks(tracer)))
+package otelhooks
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"occult.work/improvmx"
+)
+
+// Returns improvmx.Hooks that start a client span for every request, named
+// after the endpoint method that sent it (e.g., "improvmx Aliases.Read").
+func Hooks(tracer trace.Tracer) improvmx.Hooks {
+	return improvmx.Hooks{
+		Before: func(ctx context.Context, info *improvmx.RequestInfo) context.Context {
+			name := info.Endpoint
+			if name == "" {
+				name = fmt.Sprintf("%s %s", info.Method, info.Path)
+			}
+			ctx, _ = tracer.Start(ctx, "improvmx "+name,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithTimestamp(info.Start),
+				trace.WithAttributes(
+					attribute.String("http.method", info.Method),
+					attribute.String("http.route", info.Path),
+					attribute.String("http.url", info.URL.String()),
+					attribute.String("improvmx.endpoint", info.Endpoint),
+					attribute.Bool("improvmx.dry_run", info.DryRun),
+				),
+			)
+			return ctx
+		},
+		After: func(ctx context.Context, info *improvmx.RequestInfo) {
+			span := trace.SpanFromContext(ctx)
+			if info.Status != 0 {
+				span.SetAttributes(attribute.Int("http.status_code", info.Status))
+			}
+			if info.Error != nil {
+				span.RecordError(info.Error)
+				span.SetStatus(codes.Error, info.Error.Error())
+			}
+			span.End(trace.WithTimestamp(info.Start.Add(info.Duration)))
+		},
+	}
+}
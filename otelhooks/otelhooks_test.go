@@ -0,0 +1,51 @@
+package otelhooks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"occult.work/improvmx"
+)
+
+func TestHooks(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		if request.Method == http.MethodDelete {
+			writer.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(writer, `{ "error": "not found", "code": 404, "success": false }`)
+			return
+		}
+		fmt.Fprint(writer, `{ "alias": { "forward": "richard@example.com", "alias": "richard", "id": 1 }, "success": true }`)
+	}))
+	defer server.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	session, error := improvmx.New("token",
+		improvmx.WithBaseURL(server.URL),
+		improvmx.WithHooks(Hooks(provider.Tracer("test"))))
+	assert.NoError(error)
+
+	_, error = session.Aliases.Read(context.Background(), "example.com", "richard")
+	assert.NoError(error)
+	assert.Error(session.Aliases.Delete(context.Background(), "example.com", "richard"))
+
+	spans := recorder.Ended()
+	assert.Len(spans, 2)
+	assert.Equal("improvmx Aliases.Read", spans[0].Name())
+	assert.Contains(spans[0].Attributes(), attribute.String("http.route", "/domains/{domain}/aliases/{alias}/"))
+	assert.Contains(spans[0].Attributes(), attribute.Int("http.status_code", 200))
+	assert.Contains(spans[0].Attributes(), attribute.Bool("improvmx.dry_run", false))
+	assert.Equal(codes.Unset, spans[0].Status().Code)
+	assert.Equal("improvmx Aliases.Delete", spans[1].Name())
+	assert.Equal(codes.Error, spans[1].Status().Code)
+}
@@ -0,0 +1,59 @@
+package improvmx
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A token bucket shared by every request of a session.
+type rateLimiter struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// Takes a token from the bucket, waiting until one is available or the
+// context is done.
+func (limiter *rateLimiter) wait(ctx context.Context) error {
+	limiter.mutex.Lock()
+	now := time.Now()
+	limiter.tokens = min(limiter.burst, limiter.tokens+now.Sub(limiter.last).Seconds()*limiter.rate)
+	limiter.last = now
+	limiter.tokens--
+	delay := time.Duration(-limiter.tokens / limiter.rate * float64(time.Second))
+	limiter.mutex.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		limiter.mutex.Lock()
+		limiter.tokens++
+		limiter.mutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (limiter *rateLimiter) middleware(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		if error := limiter.wait(request.Context()); error != nil {
+			return nil, error
+		}
+		return next.RoundTrip(request)
+	})
+}
+
+// Adapts a function to the http.RoundTripper interface.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (function roundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return function(request)
+}
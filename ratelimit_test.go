@@ -0,0 +1,27 @@
+package improvmx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	assert := assert.New(t)
+	limiter := &rateLimiter{rate: 100, burst: 2, tokens: 2, last: time.Now()}
+	ctx := context.Background()
+	start := time.Now()
+	assert.NoError(limiter.wait(ctx))
+	assert.NoError(limiter.wait(ctx))
+	assert.Less(time.Since(start), 5*time.Millisecond)
+	assert.NoError(limiter.wait(ctx))
+	assert.GreaterOrEqual(time.Since(start), 5*time.Millisecond)
+
+	limiter = &rateLimiter{rate: 0.001, burst: 1, last: time.Now()}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(limiter.wait(ctx), context.DeadlineExceeded)
+	assert.InDelta(0, limiter.tokens, 0.001)
+}
@@ -0,0 +1,45 @@
+package improvmx
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Returned by a read-only Session for every request that could modify the
+// account. See WithReadOnly.
+var ErrReadOnly = errors.New("session is read-only")
+
+// Refuses every request with a method other than GET, HEAD or OPTIONS with
+// ErrReadOnly, without sending it. This is enforced by the transport of the
+// session, so requests sent by any endpoint, helper or middleware are covered.
+func WithReadOnly() SessionOption {
+	return func(session *Session) error {
+		session.readOnly = true
+		return nil
+	}
+}
+
+// Returns true if the session was created with WithReadOnly.
+func (session *Session) ReadOnly() bool {
+	return session.readOnly
+}
+
+type readOnlyTransport struct {
+	session *Session
+	next    http.RoundTripper
+}
+
+func (transport *readOnlyTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	switch request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return transport.next.RoundTrip(request)
+	}
+	if request.Body != nil {
+		request.Body.Close()
+	}
+	if operation, _, ok := transport.session.operation(request); ok {
+		return nil, fmt.Errorf("%s: %w", operation.endpoint, ErrReadOnly)
+	}
+	return nil, fmt.Errorf("%s %s: %w", request.Method, request.URL.Path, ErrReadOnly)
+}
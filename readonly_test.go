@@ -0,0 +1,75 @@
+package improvmx
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"occult.work/doze/test"
+)
+
+type ReadOnlyTestSuite struct {
+	test.Suite
+	session *Session
+	// The endpoints observed by hooks, whether or not they were sent
+	observed []string
+}
+
+func (suite *ReadOnlyTestSuite) SetupSuite() {
+	sent := func(writer http.ResponseWriter, request *http.Request) {
+		suite.Fail("request was sent", "%s %s", request.Method, request.URL.Path)
+	}
+	router := test.NewRouter().
+		Get(aliasListPath, suite.FileResponseHandler("testdata/alias/list.json")).
+		Get(aliasReadPath, suite.FileResponseHandler("testdata/alias/read.json")).
+		Post(domainCreatePath, sent).
+		Delete(domainDeletePath, sent).
+		Post(aliasCreatePath, sent).
+		Put(aliasUpdatePath, sent).
+		Delete(aliasDeletePath, func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.Write([]byte(`{ "success": true }`))
+		})
+	suite.Initialize(router)
+	suite.Data = &testData
+	observe := Hooks{After: func(ctx context.Context, info *RequestInfo) { suite.observed = append(suite.observed, info.Endpoint) }}
+	suite.session, _ = New("read-only-test-suite", WithBaseURL(suite.Server.URL), WithReadOnly(), WithHooks(observe))
+}
+
+func TestReadOnly(t *testing.T) {
+	test.Run(t, new(ReadOnlyTestSuite))
+}
+
+func (suite *ReadOnlyTestSuite) TestMutations() {
+	ctx := context.Background()
+	suite.True(suite.session.ReadOnly())
+
+	aliases, error := suite.session.Aliases.List(ctx, "example.com")
+	suite.Require().NoError(error)
+	suite.NotEmpty(aliases)
+
+	_, error = suite.session.Aliases.Create(ctx, "example.com", "jared", "jared@example.com")
+	suite.ErrorIs(error, ErrReadOnly)
+	suite.ErrorContains(error, "Aliases.Create")
+	_, error = suite.session.Aliases.Update(ctx, "example.com", "richard", "richard@hooli.com")
+	suite.ErrorIs(error, ErrReadOnly)
+	suite.ErrorIs(suite.session.Aliases.Delete(ctx, "example.com", "richard"), ErrReadOnly)
+	_, error = suite.session.Domains.Create(ctx, "hooli.com")
+	suite.ErrorIs(error, ErrReadOnly)
+	suite.ErrorIs(suite.session.Domains.Delete(ctx, "example.com"), ErrReadOnly)
+	_, _, error = suite.session.EnsureAlias(ctx, "example.com", "jared", "jared@example.com")
+	suite.ErrorIs(error, ErrReadOnly)
+
+	_, error = (*resty.Client)(suite.session.client).R().SetContext(ctx).Patch("/domains/example.com/")
+	suite.ErrorIs(error, ErrReadOnly)
+	suite.ErrorContains(error, "PATCH /domains/example.com/")
+	suite.Contains(suite.observed, "Aliases.Delete")
+}
+
+func (suite *ReadOnlyTestSuite) TestReadWrite() {
+	session, error := New("token", WithBaseURL(suite.Server.URL))
+	suite.Require().NoError(error)
+	suite.False(session.ReadOnly())
+	suite.NoError(session.Aliases.Delete(context.Background(), "example.com", "richard"))
+}
@@ -0,0 +1,280 @@
+// Package redact removes personal data from ImprovMX log entries before they
+// are shared, by masking, hashing, or dropping email addresses, names,
+// subjects, and message IDs.
+//
+// Hashed values are keyed HMAC-SHA256 pseudonyms. The same value always maps
+// to the same pseudonym for a given key, so redacted exports remain joinable
+// with each other, while the original value cannot be recovered without the
+// key.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"occult.work/improvmx"
+	"occult.work/improvmx/export"
+)
+
+const (
+	// Leaves the value untouched.
+	Keep Action = iota
+
+	// Replaces all but the first character of the value with asterisks.
+	Mask
+
+	// Replaces the value with a keyed pseudonym.
+	Hash
+
+	// Replaces the value with an empty string.
+	Drop
+)
+
+// Describes how a single kind of value is redacted.
+type Action int
+
+// Describes how each kind of value within a LogEntry is redacted. Emails
+// apply to sender, recipient, and forward addresses, as well as any address
+// found within the message of a LogEvent.
+type Policy struct {
+	Emails     Action
+	Names      Action
+	Subjects   Action
+	MessageIDs Action
+	// Leaves the domain of email addresses untouched when masking or hashing
+	KeepDomain bool
+	// The HMAC key used by Hash. Required if any field uses Hash.
+	Key []byte
+}
+
+// Applies a Policy to log entries, contacts, and export records.
+type Redactor struct {
+	policy Policy
+}
+
+// Masks every field, but keeps the domain of email addresses.
+var Masked = Policy{Emails: Mask, Names: Mask, Subjects: Mask, MessageIDs: Mask, KeepDomain: true}
+
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9.!#$%&'*+/=?^_{|}~-]+@[A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?(?:\.[A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?)*`)
+
+// Hashes emails and message IDs with the given key, so that they remain
+// joinable, keeps the domain of email addresses, and drops names and subjects.
+func Pseudonymous(key []byte) Policy {
+	return Policy{Emails: Hash, Names: Drop, Subjects: Drop, MessageIDs: Hash, KeepDomain: true, Key: key}
+}
+
+// Parses a policy from a comma separated list. The first item may be one of
+// the presets "mask" or "pseudonymous", and every other item is either
+// field=action, where field is one of emails, names, subjects, or message-ids
+// and action is one of keep, mask, hash, or drop, or the flag keep-domain.
+// The key is used for any field that is hashed.
+func ParsePolicy(value string, key []byte) (Policy, error) {
+	policy := Policy{Key: key}
+	for index, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(strings.ToLower(item))
+		switch {
+		case item == "":
+			continue
+		case index == 0 && item == "mask":
+			policy = Masked
+			policy.Key = key
+			continue
+		case index == 0 && item == "pseudonymous":
+			policy = Pseudonymous(key)
+			continue
+		case item == "keep-domain":
+			policy.KeepDomain = true
+			continue
+		}
+		field, name, ok := strings.Cut(item, "=")
+		if !ok {
+			return Policy{}, fmt.Errorf("invalid redaction policy item: %q", item)
+		}
+		action, error := ParseAction(name)
+		if error != nil {
+			return Policy{}, error
+		}
+		switch field {
+		case "emails":
+			policy.Emails = action
+		case "names":
+			policy.Names = action
+		case "subjects":
+			policy.Subjects = action
+		case "message-ids":
+			policy.MessageIDs = action
+		default:
+			return Policy{}, fmt.Errorf("unknown redaction field: %q", field)
+		}
+	}
+	return policy, policy.validate()
+}
+
+// Parses the name of an Action.
+func ParseAction(value string) (Action, error) {
+	switch strings.ToLower(value) {
+	case "keep":
+		return Keep, nil
+	case "mask":
+		return Mask, nil
+	case "hash":
+		return Hash, nil
+	case "drop":
+		return Drop, nil
+	}
+	return Keep, fmt.Errorf("unknown redaction action: %q", value)
+}
+
+func (action Action) String() string {
+	switch action {
+	case Keep:
+		return "keep"
+	case Mask:
+		return "mask"
+	case Hash:
+		return "hash"
+	case Drop:
+		return "drop"
+	}
+	return fmt.Sprintf("Action(%d)", int(action))
+}
+
+// Returns a Redactor for the given policy. An error is returned if the policy
+// hashes a field but has no key.
+func New(policy Policy) (*Redactor, error) {
+	if error := policy.validate(); error != nil {
+		return nil, error
+	}
+	return &Redactor{policy}, nil
+}
+
+// Returns a redacted copy of the contact.
+func (redactor *Redactor) Contact(contact improvmx.Contact) improvmx.Contact {
+	return improvmx.Contact{
+		Email: redactor.Email(contact.Email),
+		Name:  redactor.apply(redactor.policy.Names, contact.Name),
+	}
+}
+
+// Returns the redacted email address.
+func (redactor *Redactor) Email(address string) string {
+	action := redactor.policy.Emails
+	if address == "" || action == Keep || action == Drop {
+		return redactor.apply(action, address)
+	}
+	if action == Hash {
+		address = strings.ToLower(address)
+	}
+	local, domain, ok := cutAddress(address)
+	if !ok {
+		return redactor.apply(action, address)
+	}
+	if redactor.policy.KeepDomain {
+		return fmt.Sprintf("%s@%s", redactor.apply(action, local), domain)
+	}
+	if action == Hash {
+		return fmt.Sprintf("%s@%s", redactor.apply(action, address), "redacted.invalid")
+	}
+	return fmt.Sprintf("%s@%s", redactor.apply(action, local), redactor.apply(action, domain))
+}
+
+// Returns a redacted copy of the entry. The Events slice is copied, and the
+// original entry is left untouched.
+func (redactor *Redactor) Entry(entry improvmx.LogEntry) improvmx.LogEntry {
+	policy := redactor.policy
+	entry.Sender = redactor.Contact(entry.Sender)
+	entry.Recipient = redactor.Contact(entry.Recipient)
+	entry.Address = redactor.Contact(entry.Address)
+	entry.Subject = redactor.apply(policy.Subjects, entry.Subject)
+	entry.MessageID = redactor.apply(policy.MessageIDs, entry.MessageID)
+	events := make([]improvmx.LogEvent, len(entry.Events))
+	for index, event := range entry.Events {
+		event.ID = redactor.apply(policy.MessageIDs, event.ID)
+		event.Message = redactor.Text(event.Message)
+		events[index] = event
+	}
+	if entry.Events != nil {
+		entry.Events = events
+	}
+	return entry
+}
+
+// Returns a redacted copy of the record.
+func (redactor *Redactor) Record(record export.Record) export.Record {
+	record.Entry = redactor.Entry(record.Entry)
+	return record
+}
+
+// Returns text with every email address redacted.
+func (redactor *Redactor) Text(text string) string {
+	if redactor.policy.Emails == Keep {
+		return text
+	}
+	return emailPattern.ReplaceAllStringFunc(text, func(address string) string {
+		if redacted := redactor.Email(address); redacted != "" {
+			return redacted
+		}
+		return "[redacted]"
+	})
+}
+
+// Returns an export.Writer that redacts every record before passing it to
+// writer.
+func (redactor *Redactor) Writer(writer export.Writer) export.Writer {
+	return &redactingWriter{redactor, writer}
+}
+
+type redactingWriter struct {
+	redactor *Redactor
+	writer   export.Writer
+}
+
+func (writer *redactingWriter) Write(record export.Record) error {
+	return writer.writer.Write(writer.redactor.Record(record))
+}
+
+func (writer *redactingWriter) Close() error {
+	return writer.writer.Close()
+}
+
+func (redactor *Redactor) apply(action Action, value string) string {
+	if value == "" {
+		return value
+	}
+	switch action {
+	case Mask:
+		runes := []rune(value)
+		return string(runes[0]) + strings.Repeat("*", len(runes)-1)
+	case Hash:
+		mac := hmac.New(sha256.New, redactor.policy.Key)
+		mac.Write([]byte(value))
+		return hex.EncodeToString(mac.Sum(nil))[:16]
+	case Drop:
+		return ""
+	}
+	return value
+}
+
+func (policy Policy) validate() error {
+	for _, action := range []Action{policy.Emails, policy.Names, policy.Subjects, policy.MessageIDs} {
+		if action < Keep || action > Drop {
+			return fmt.Errorf("unknown redaction action: %v", action)
+		}
+		if action == Hash && len(policy.Key) == 0 {
+			return fmt.Errorf("redaction policy hashes values but no key was provided")
+		}
+	}
+	return nil
+}
+
+func cutAddress(address string) (string, string, bool) {
+	index := strings.LastIndex(address, "@")
+	if index <= 0 || index == len(address)-1 {
+		return "", "", false
+	}
+	return address[:index], address[index+1:], true
+}
@@ -0,0 +1,102 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"occult.work/improvmx"
+	"occult.work/improvmx/export"
+)
+
+func loadLogs(t *testing.T) []improvmx.LogEntry {
+	data, error := os.ReadFile("../testdata/alias/logs.json")
+	assert.NoError(t, error)
+	response := struct{ Logs []improvmx.LogEntry }{}
+	assert.NoError(t, json.Unmarshal(data, &response))
+	return response.Logs
+}
+
+func TestMasked(t *testing.T) {
+	assert := assert.New(t)
+	redactor, error := New(Masked)
+	assert.NoError(error)
+	contact := redactor.Contact(improvmx.Contact{Email: "richard@piedpiper.com", Name: "Richard"})
+	assert.Equal("r******@piedpiper.com", contact.Email)
+	assert.Equal("R******", contact.Name)
+
+	entry := redactor.Entry(loadLogs(t)[0])
+	assert.Equal("g****@hooli.com", entry.Sender.Email)
+	assert.Equal("s*************", entry.MessageID)
+	assert.Equal("s*************", entry.Events[0].ID)
+	assert.NotContains(entry.Subject, "screwed")
+}
+
+func TestPseudonymous(t *testing.T) {
+	assert := assert.New(t)
+	redactor, error := New(Pseudonymous([]byte("secret")))
+	assert.NoError(error)
+	first := redactor.Email("Richard@PiedPiper.com")
+	second := redactor.Email("richard@piedpiper.com")
+	assert.Equal(first, second)
+	assert.True(strings.HasSuffix(first, "@piedpiper.com"))
+	assert.NotContains(first, "richard")
+
+	other, _ := New(Pseudonymous([]byte("other")))
+	assert.NotEqual(first, other.Email("richard@piedpiper.com"))
+
+	logs := loadLogs(t)
+	original := logs[0].Events[0].ID
+	entry := redactor.Entry(logs[0])
+	assert.Empty(entry.Subject)
+	assert.Empty(entry.Sender.Name)
+	assert.Equal(original, logs[0].Events[0].ID)
+	assert.Equal(entry.MessageID, entry.Events[0].ID)
+}
+
+func TestText(t *testing.T) {
+	assert := assert.New(t)
+	redactor, _ := New(Policy{Emails: Drop})
+	assert.Equal("5.1.1 <[redacted]> unknown", redactor.Text("5.1.1 <richard@piedpiper.com> unknown"))
+	redactor, _ = New(Policy{Emails: Mask})
+	assert.Equal("r******@p************", redactor.Email("richard@piedpiper.com"))
+}
+
+func TestParsePolicy(t *testing.T) {
+	assert := assert.New(t)
+	policy, error := ParsePolicy("mask,subjects=drop", nil)
+	assert.NoError(error)
+	assert.Equal(Drop, policy.Subjects)
+	assert.Equal(Mask, policy.Emails)
+	assert.True(policy.KeepDomain)
+
+	policy, error = ParsePolicy("emails=hash,keep-domain", []byte("key"))
+	assert.NoError(error)
+	assert.Equal(Hash, policy.Emails)
+	assert.Equal(Keep, policy.Names)
+
+	_, error = ParsePolicy("pseudonymous", nil)
+	assert.Error(error)
+	_, error = ParsePolicy("planets=hash", []byte("key"))
+	assert.Error(error)
+	_, error = ParsePolicy("emails=shred", nil)
+	assert.Error(error)
+	_, error = ParsePolicy("emails", nil)
+	assert.Error(error)
+	_, error = New(Policy{Emails: Action(42)})
+	assert.Error(error)
+}
+
+func TestWriter(t *testing.T) {
+	assert := assert.New(t)
+	redactor, _ := New(Masked)
+	buffer := &bytes.Buffer{}
+	records := export.Records("piedpiper.com", loadLogs(t)...)
+	assert.NoError(export.WriteAll(redactor.Writer(export.NewEntryCSVWriter(buffer)), records...))
+	assert.NotContains(buffer.String(), "gavin@hooli.com")
+	assert.Contains(buffer.String(), "g****@hooli.com")
+	assert.Equal("gavin@hooli.com", records[0].Entry.Sender.Email)
+}
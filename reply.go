@@ -0,0 +1,188 @@
+package improvmx
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// The reason could not be determined from the reply.
+	ReasonUnknown ReplyReason = ""
+
+	// The message was considered to be spam.
+	ReasonSpam ReplyReason = "spam"
+
+	// The mailbox of the recipient has exceeded its storage allocation.
+	ReasonMailboxFull ReplyReason = "mailbox-full"
+
+	// The recipient does not exist at the end destination.
+	ReasonUnknownUser ReplyReason = "unknown-user"
+
+	// The end destination temporarily deferred the message because the sender
+	// is not yet known to it.
+	ReasonGreylisting ReplyReason = "greylisting"
+
+	// The message was rejected due to a security or delivery policy.
+	ReasonPolicy ReplyReason = "policy"
+)
+
+// Classifies why an SMTP reply was returned.
+type ReplyReason string
+
+// An RFC 3463 enhanced mail system status code, such as 5.7.1
+type EnhancedStatus struct {
+	Class   int
+	Subject int
+	Detail  int
+}
+
+// The result of a SpamAssassin check, as reported within an SMTP reply.
+type SpamReport struct {
+	Score     float64
+	Threshold float64
+	Rules     []string
+}
+
+// A parsed SMTP reply, as found within the Code and Message of a LogEvent.
+type Reply struct {
+	// The basic SMTP reply code (e.g., 250 or 550)
+	Code int
+	// The enhanced status code, if one was found in the message
+	Enhanced *EnhancedStatus
+	// The message text, without any leading reply or enhanced status code
+	Text   string
+	Reason ReplyReason
+	// The SpamAssassin report, if one was found in the message
+	Spam *SpamReport
+}
+
+var (
+	replyPattern   = regexp.MustCompile(`^\s*(?:([2-5]\d\d)[\s-]+)?(?:([245])\.(\d{1,3})\.(\d{1,3})\s*)?`)
+	spamOfPattern  = regexp.MustCompile(`(?i)score\s+of\s+(-?[\d.]+)\s*/\s*(-?[\d.]+)(?:\s+with\s+([^)]*))?`)
+	spamEqPattern  = regexp.MustCompile(`(?i)score=(-?[\d.]+)\s+required=(-?[\d.]+)(?:\s+tests=(\S*))?`)
+	reasonKeywords = []struct {
+		reason   ReplyReason
+		keywords []string
+	}{
+		{ReasonSpam, []string{"spam", "junk", "bulk mail"}},
+		{ReasonGreylisting, []string{"greylist", "graylist", "grey-list", "gray-list"}},
+		{ReasonMailboxFull, []string{"mailbox full", "mailbox is full", "over quota", "quota exceeded", "exceeded storage", "insufficient storage"}},
+		{ReasonUnknownUser, []string{"user unknown", "unknown user", "no such user", "does not exist", "mailbox unavailable", "address rejected", "no mailbox", "invalid recipient"}},
+		{ReasonPolicy, []string{"policy", "blocked", "blacklist", "blocklist", "denied", "not authorized", "dmarc", "spf"}},
+	}
+)
+
+// Parses an SMTP reply from the given basic reply code and message. The code
+// is used as-is unless it is zero, in which case a leading reply code found in
+// the message is used instead.
+func ParseReply(code int64, message string) *Reply {
+	reply := &Reply{Code: int(code)}
+	match := replyPattern.FindStringSubmatch(message)
+	if reply.Code == 0 && match[1] != "" {
+		reply.Code, _ = strconv.Atoi(match[1])
+	}
+	if match[2] != "" {
+		class, _ := strconv.Atoi(match[2])
+		subject, _ := strconv.Atoi(match[3])
+		detail, _ := strconv.Atoi(match[4])
+		reply.Enhanced = &EnhancedStatus{class, subject, detail}
+	}
+	reply.Text = strings.TrimSpace(message[len(match[0]):])
+	reply.Spam = parseSpamReport(reply.Text)
+	reply.Reason = classifyReply(reply)
+	return reply
+}
+
+// Returns true if the reply code indicates a temporary failure.
+func (reply *Reply) IsTransient() bool {
+	if reply.Enhanced != nil {
+		return reply.Enhanced.Class == 4
+	}
+	return reply.Code >= 400 && reply.Code < 500
+}
+
+// Returns true if the reply code indicates a permanent failure.
+func (reply *Reply) IsPermanent() bool {
+	if reply.Enhanced != nil {
+		return reply.Enhanced.Class == 5
+	}
+	return reply.Code >= 500 && reply.Code < 600
+}
+
+func (status EnhancedStatus) String() string {
+	return fmt.Sprintf("%d.%d.%d", status.Class, status.Subject, status.Detail)
+}
+
+// Returns the parsed SMTP reply of the event.
+func (event *LogEvent) Reply() *Reply {
+	return ParseReply(event.Code, event.Message)
+}
+
+// Returns the RFC 3463 enhanced status code of the event, or nil if the
+// message does not contain one.
+func (event *LogEvent) EnhancedStatus() *EnhancedStatus {
+	return event.Reply().Enhanced
+}
+
+// Returns the classified reason for the event's SMTP reply.
+func (event *LogEvent) Reason() ReplyReason {
+	return event.Reply().Reason
+}
+
+// Returns the SpamAssassin report of the event, or nil if the message does
+// not contain one.
+func (event *LogEvent) SpamReport() *SpamReport {
+	return event.Reply().Spam
+}
+
+func parseSpamReport(text string) *SpamReport {
+	match := spamOfPattern.FindStringSubmatch(text)
+	if match == nil {
+		match = spamEqPattern.FindStringSubmatch(text)
+	}
+	if match == nil {
+		return nil
+	}
+	score, error := strconv.ParseFloat(match[1], 64)
+	if error != nil {
+		return nil
+	}
+	threshold, error := strconv.ParseFloat(match[2], 64)
+	if error != nil {
+		return nil
+	}
+	report := &SpamReport{Score: score, Threshold: threshold}
+	for _, rule := range strings.Split(match[3], ",") {
+		if rule = strings.TrimSpace(rule); rule != "" {
+			report.Rules = append(report.Rules, rule)
+		}
+	}
+	return report
+}
+
+func classifyReply(reply *Reply) ReplyReason {
+	if reply.Spam != nil {
+		return ReasonSpam
+	}
+	text := strings.ToLower(reply.Text)
+	for _, entry := range reasonKeywords {
+		for _, keyword := range entry.keywords {
+			if strings.Contains(text, keyword) {
+				return entry.reason
+			}
+		}
+	}
+	if status := reply.Enhanced; status != nil {
+		switch {
+		case status.Subject == 1 && status.Detail == 1:
+			return ReasonUnknownUser
+		case status.Subject == 2 && status.Detail == 2:
+			return ReasonMailboxFull
+		case status.Subject == 7:
+			return ReasonPolicy
+		}
+	}
+	return ReasonUnknown
+}
@@ -0,0 +1,61 @@
+package improvmx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReplySpam(t *testing.T) {
+	assert := assert.New(t)
+	logs := loadLogs(t, "testdata/alias/logs.json")
+	event := logs[1].Events[0]
+	reply := event.Reply()
+	assert.Equal(550, reply.Code)
+	assert.Equal(&EnhancedStatus{5, 7, 1}, reply.Enhanced)
+	assert.Equal("5.7.1", event.EnhancedStatus().String())
+	assert.Equal(ReasonSpam, event.Reason())
+	assert.True(reply.IsPermanent())
+
+	report := event.SpamReport()
+	assert.NotNil(report)
+	assert.Equal(5.8, report.Score)
+	assert.Equal(5.0, report.Threshold)
+	assert.Len(report.Rules, 12)
+	assert.Equal("BAYES_20", report.Rules[0])
+	assert.Equal("URIBL_DBL_SPAM", report.Rules[11])
+}
+
+func TestParseReplySpamAssassinHeader(t *testing.T) {
+	assert := assert.New(t)
+	reply := ParseReply(0, "550 5.7.1 Rejected: score=7.2 required=5.0 tests=BAYES_99,RDNS_NONE")
+	assert.Equal(550, reply.Code)
+	assert.Equal(ReasonSpam, reply.Reason)
+	assert.Equal([]string{"BAYES_99", "RDNS_NONE"}, reply.Spam.Rules)
+}
+
+func TestParseReplyReasons(t *testing.T) {
+	assert := assert.New(t)
+	cases := map[string]ReplyReason{
+		"5.2.2 The email account that you tried to reach is over quota":  ReasonMailboxFull,
+		"5.1.1 The email account that you tried to reach does not exist": ReasonUnknownUser,
+		"4.7.1 Greylisted, please try again in 300 seconds":              ReasonGreylisting,
+		"5.7.26 Unauthenticated email is not accepted due to DMARC":      ReasonPolicy,
+		"5.1.1 <richard@example.com>":                                    ReasonUnknownUser,
+		"5.7.0 Go away":                                                  ReasonPolicy,
+		"Sent.":                                                          ReasonUnknown,
+	}
+	for message, reason := range cases {
+		assert.Equal(reason, ParseReply(550, message).Reason, message)
+	}
+}
+
+func TestParseReplyWithoutStatus(t *testing.T) {
+	assert := assert.New(t)
+	reply := ParseReply(250, "Queued")
+	assert.Nil(reply.Enhanced)
+	assert.Nil(reply.Spam)
+	assert.Equal("Queued", reply.Text)
+	assert.False(reply.IsPermanent())
+	assert.True(ParseReply(451, "try later").IsTransient())
+}
@@ -0,0 +1,523 @@
+// Package search implements a small query language to filter ImprovMX log
+// entries, such as:
+//
+//	status:hard-bounce sender:*@hooli.com after:2024-01-01 subject~"invoice"
+//
+// A query is made of terms separated by whitespace, all of which must match.
+// Terms may be combined with OR, negated with a leading - or NOT, and grouped
+// with parentheses. Each term takes one of the following forms:
+//
+//	field:value   value matches the field exactly, where * and ? are wildcards
+//	field~value   field contains value
+//	value         subject, sender, or recipient contains value
+//
+// All comparisons are case insensitive. Values containing whitespace must be
+// quoted with double quotes. The supported fields are
+//
+//	status      the final status of the entry (e.g., delivered, hard-bounce)
+//	event       the status of any event of the entry
+//	reason      the reason of any event reply (e.g., spam, mailbox-full)
+//	code        the SMTP reply code of any event
+//	sender      the sender email address or name (alias: from)
+//	recipient   the recipient email address or name (alias: to)
+//	forward     the address the message was forwarded to
+//	subject     the message subject
+//	id          the log entry ID
+//	message-id  the message ID
+//	hostname    the sending hostname
+//	domain      the domain the entry was retrieved from
+//	after       entries created at or after a date, time, or duration ago
+//	before      entries created before a date, time, or duration ago
+//
+// Dates may be written as 2006-01-02, RFC 3339 timestamps, or as durations
+// relative to the time the query was parsed, such as 12h or 7d.
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"occult.work/improvmx"
+	"occult.work/improvmx/export"
+)
+
+// A parsed query. The zero value matches every entry.
+type Query struct {
+	source string
+	root   node
+}
+
+type node interface {
+	match(*export.Record) bool
+}
+
+type (
+	allOf []node
+	anyOf []node
+	not   struct{ node }
+	term  func(*export.Record) bool
+)
+
+// Parses the given query, relative to the current time.
+func Parse(query string) (*Query, error) {
+	return ParseAt(query, time.Now())
+}
+
+// Parses the given query. Relative dates are resolved against now.
+func ParseAt(query string, now time.Time) (*Query, error) {
+	tokens, error := tokenize(query)
+	if error != nil {
+		return nil, error
+	}
+	parser := &parser{tokens: tokens, now: now}
+	root, error := parser.parse()
+	if error != nil {
+		return nil, error
+	}
+	return &Query{source: query, root: root}, nil
+}
+
+// Like Parse, but panics if the query cannot be parsed.
+func MustParse(query string) *Query {
+	result, error := Parse(query)
+	if error != nil {
+		panic(error)
+	}
+	return result
+}
+
+// Returns true if the entry matches the query. The domain field is matched
+// against the domain of the recipient address.
+func (query *Query) Match(entry *improvmx.LogEntry) bool {
+	return query.MatchRecord(&export.Record{Domain: domainOf(entry.Recipient.Email), Entry: *entry})
+}
+
+// Returns true if the record matches the query.
+func (query *Query) MatchRecord(record *export.Record) bool {
+	if query == nil || query.root == nil {
+		return true
+	}
+	return query.root.match(record)
+}
+
+// Returns the entries matching the query.
+func (query *Query) Filter(entries []improvmx.LogEntry) []improvmx.LogEntry {
+	var matches []improvmx.LogEntry
+	for index := range entries {
+		if query.Match(&entries[index]) {
+			matches = append(matches, entries[index])
+		}
+	}
+	return matches
+}
+
+// Returns the query as it was originally written.
+func (query *Query) String() string {
+	return query.source
+}
+
+func (nodes allOf) match(record *export.Record) bool {
+	for _, node := range nodes {
+		if !node.match(record) {
+			return false
+		}
+	}
+	return true
+}
+
+func (nodes anyOf) match(record *export.Record) bool {
+	for _, node := range nodes {
+		if node.match(record) {
+			return true
+		}
+	}
+	return false
+}
+
+func (node not) match(record *export.Record) bool {
+	return !node.node.match(record)
+}
+
+func (function term) match(record *export.Record) bool {
+	return function(record)
+}
+
+const (
+	tokenWord = iota
+	tokenOpen
+	tokenClose
+	tokenNot
+	tokenOr
+	tokenAnd
+)
+
+type token struct {
+	kind     int
+	field    string
+	operator byte
+	value    string
+	position int
+}
+
+// Splits the query into tokens. A word is split into its field, operator, and
+// value at the first unquoted : or ~ character.
+func tokenize(query string) ([]token, error) {
+	var tokens []token
+	index := 0
+	for index < len(query) {
+		character := query[index]
+		switch {
+		case character == ' ' || character == '\t' || character == '\n':
+			index++
+			continue
+		case character == '(':
+			tokens = append(tokens, token{kind: tokenOpen, position: index})
+			index++
+			continue
+		case character == ')':
+			tokens = append(tokens, token{kind: tokenClose, position: index})
+			index++
+			continue
+		case character == '-' && index+1 < len(query) && query[index+1] != ' ':
+			tokens = append(tokens, token{kind: tokenNot, position: index})
+			index++
+			continue
+		}
+		word := token{kind: tokenWord, position: index}
+		var builder strings.Builder
+		quoted, wasQuoted := false, false
+		for ; index < len(query); index++ {
+			character := query[index]
+			if quoted {
+				switch {
+				case character == '\\' && index+1 < len(query):
+					index++
+					builder.WriteByte(query[index])
+				case character == '"':
+					quoted = false
+				default:
+					builder.WriteByte(character)
+				}
+				continue
+			}
+			if character == ' ' || character == '\t' || character == '\n' || character == '(' || character == ')' {
+				break
+			}
+			switch {
+			case character == '"':
+				quoted, wasQuoted = true, true
+			case (character == ':' || character == '~') && word.operator == 0 && !wasQuoted:
+				word.field = strings.ToLower(builder.String())
+				word.operator = character
+				builder.Reset()
+			default:
+				builder.WriteByte(character)
+			}
+		}
+		if quoted {
+			return nil, fmt.Errorf("unterminated quote at position %d", word.position)
+		}
+		word.value = builder.String()
+		if word.operator == 0 && !wasQuoted {
+			switch word.value {
+			case "OR":
+				word.kind = tokenOr
+			case "AND":
+				word.kind = tokenAnd
+			case "NOT":
+				word.kind = tokenNot
+			}
+		}
+		tokens = append(tokens, word)
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	index  int
+	now    time.Time
+}
+
+func (parser *parser) parse() (node, error) {
+	if len(parser.tokens) == 0 {
+		return nil, nil
+	}
+	root, error := parser.parseOr()
+	if error != nil {
+		return nil, error
+	}
+	if next := parser.peek(); next != nil {
+		return nil, fmt.Errorf("unexpected token at position %d", next.position)
+	}
+	return root, nil
+}
+
+func (parser *parser) peek() *token {
+	if parser.index >= len(parser.tokens) {
+		return nil
+	}
+	return &parser.tokens[parser.index]
+}
+
+func (parser *parser) parseOr() (node, error) {
+	var nodes anyOf
+	for {
+		node, error := parser.parseAnd()
+		if error != nil {
+			return nil, error
+		}
+		nodes = append(nodes, node)
+		if next := parser.peek(); next == nil || next.kind != tokenOr {
+			break
+		}
+		parser.index++
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (parser *parser) parseAnd() (node, error) {
+	var nodes allOf
+	for {
+		next := parser.peek()
+		if next == nil || next.kind == tokenOr || next.kind == tokenClose {
+			break
+		}
+		if next.kind == tokenAnd {
+			parser.index++
+			continue
+		}
+		node, error := parser.parseUnary()
+		if error != nil {
+			return nil, error
+		}
+		nodes = append(nodes, node)
+	}
+	switch len(nodes) {
+	case 0:
+		if next := parser.peek(); next != nil {
+			return nil, fmt.Errorf("expected a term at position %d", next.position)
+		}
+		return nil, fmt.Errorf("expected a term at end of query")
+	case 1:
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (parser *parser) parseUnary() (node, error) {
+	next := parser.peek()
+	parser.index++
+	switch next.kind {
+	case tokenNot:
+		if parser.peek() == nil {
+			return nil, fmt.Errorf("expected a term after negation at position %d", next.position)
+		}
+		inner, error := parser.parseUnary()
+		if error != nil {
+			return nil, error
+		}
+		return not{inner}, nil
+	case tokenOpen:
+		inner, error := parser.parseOr()
+		if error != nil {
+			return nil, error
+		}
+		if close := parser.peek(); close == nil || close.kind != tokenClose {
+			return nil, fmt.Errorf("unbalanced parenthesis at position %d", next.position)
+		}
+		parser.index++
+		return inner, nil
+	case tokenWord:
+		return parser.parseTerm(next)
+	}
+	return nil, fmt.Errorf("unexpected token at position %d", next.position)
+}
+
+func (parser *parser) parseTerm(word *token) (node, error) {
+	value := word.value
+	if word.operator == 0 {
+		return term(func(record *export.Record) bool {
+			entry := &record.Entry
+			return contains(entry.Subject, value) ||
+				contains(entry.Sender.Email, value) ||
+				contains(entry.Sender.Name, value) ||
+				contains(entry.Recipient.Email, value)
+		}), nil
+	}
+	switch word.field {
+	case "after", "before":
+		return parser.parseTime(word)
+	case "status", "event":
+		return parseStatus(word)
+	case "code":
+		if word.operator != ':' {
+			return nil, fmt.Errorf("field %q only supports ':' at position %d", word.field, word.position)
+		}
+		code, error := strconv.ParseInt(value, 10, 64)
+		if error != nil {
+			return nil, fmt.Errorf("invalid code %q at position %d", value, word.position)
+		}
+		return term(func(record *export.Record) bool {
+			for _, event := range record.Entry.Events {
+				if event.Code == code {
+					return true
+				}
+			}
+			return false
+		}), nil
+	case "reason":
+		compare := comparison(word.operator, value)
+		return term(func(record *export.Record) bool {
+			for index := range record.Entry.Events {
+				if compare(string(record.Entry.Events[index].Reason())) {
+					return true
+				}
+			}
+			return false
+		}), nil
+	}
+	fields, ok := textFields[word.field]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q at position %d", word.field, word.position)
+	}
+	compare := comparison(word.operator, value)
+	return term(func(record *export.Record) bool {
+		for _, field := range fields(record) {
+			if compare(field) {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+func (parser *parser) parseTime(word *token) (node, error) {
+	if word.operator != ':' {
+		return nil, fmt.Errorf("field %q only supports ':' at position %d", word.field, word.position)
+	}
+	instant, error := parseInstant(word.value, parser.now)
+	if error != nil {
+		return nil, fmt.Errorf("invalid date %q at position %d", word.value, word.position)
+	}
+	after := word.field == "after"
+	return term(func(record *export.Record) bool {
+		created, error := record.Entry.Created()
+		if error != nil {
+			return false
+		}
+		if after {
+			return !created.Before(instant)
+		}
+		return created.Before(instant)
+	}), nil
+}
+
+func parseStatus(word *token) (node, error) {
+	if word.operator != ':' {
+		return nil, fmt.Errorf("field %q only supports ':' at position %d", word.field, word.position)
+	}
+	value := word.value
+	if !strings.ContainsAny(value, "*?") {
+		status, error := improvmx.ParseMessageStatus(value)
+		if error != nil {
+			return nil, fmt.Errorf("%w at position %d", error, word.position)
+		}
+		value = string(status)
+	}
+	compare := comparison(':', value)
+	if word.field == "status" {
+		return term(func(record *export.Record) bool {
+			return compare(string(record.Entry.FinalStatus()))
+		}), nil
+	}
+	return term(func(record *export.Record) bool {
+		for _, event := range record.Entry.Events {
+			if compare(string(event.Status)) {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+var textFields = map[string]func(*export.Record) []string{
+	"sender":     func(record *export.Record) []string { return contact(record.Entry.Sender) },
+	"from":       func(record *export.Record) []string { return contact(record.Entry.Sender) },
+	"recipient":  func(record *export.Record) []string { return contact(record.Entry.Recipient) },
+	"to":         func(record *export.Record) []string { return contact(record.Entry.Recipient) },
+	"forward":    func(record *export.Record) []string { return contact(record.Entry.Address) },
+	"subject":    func(record *export.Record) []string { return []string{record.Entry.Subject} },
+	"id":         func(record *export.Record) []string { return []string{record.Entry.ID} },
+	"message-id": func(record *export.Record) []string { return []string{record.Entry.MessageID} },
+	"hostname":   func(record *export.Record) []string { return []string{record.Entry.Hostname} },
+	"domain":     func(record *export.Record) []string { return []string{record.Domain} },
+}
+
+func contact(value improvmx.Contact) []string {
+	return []string{value.Email, value.Name}
+}
+
+// Returns a function comparing a field against value with the given operator.
+func comparison(operator byte, value string) func(string) bool {
+	if operator == '~' {
+		return func(field string) bool { return contains(field, value) }
+	}
+	if !strings.ContainsAny(value, "*?") {
+		return func(field string) bool { return strings.EqualFold(field, value) }
+	}
+	pattern := regexp.MustCompile("(?is)^" + globToRegexp(value) + "$")
+	return pattern.MatchString
+}
+
+func globToRegexp(glob string) string {
+	var builder strings.Builder
+	for _, character := range glob {
+		switch character {
+		case '*':
+			builder.WriteString(".*")
+		case '?':
+			builder.WriteString(".")
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(character)))
+		}
+	}
+	return builder.String()
+}
+
+func contains(field, value string) bool {
+	return strings.Contains(strings.ToLower(field), strings.ToLower(value))
+}
+
+func parseInstant(value string, now time.Time) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05"} {
+		if instant, error := time.Parse(layout, value); error == nil {
+			return instant, nil
+		}
+	}
+	if strings.HasSuffix(value, "d") {
+		days, error := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if error != nil {
+			return time.Time{}, error
+		}
+		return now.AddDate(0, 0, -days), nil
+	}
+	duration, error := time.ParseDuration(value)
+	if error != nil {
+		return time.Time{}, error
+	}
+	return now.Add(-duration), nil
+}
+
+func domainOf(address string) string {
+	if index := strings.LastIndex(address, "@"); index >= 0 {
+		return strings.ToLower(address[index+1:])
+	}
+	return ""
+}
@@ -0,0 +1,98 @@
+package search
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"occult.work/improvmx"
+)
+
+func loadLogs(t *testing.T) []improvmx.LogEntry {
+	data, error := os.ReadFile("../testdata/domain/logs.json")
+	assert.NoError(t, error)
+	response := struct{ Logs []improvmx.LogEntry }{}
+	assert.NoError(t, json.Unmarshal(data, &response))
+	return response.Logs
+}
+
+func subjects(entries []improvmx.LogEntry) []string {
+	var subjects []string
+	for _, entry := range entries {
+		subjects = append(subjects, entry.Subject)
+	}
+	return subjects
+}
+
+func TestQueries(t *testing.T) {
+	assert := assert.New(t)
+	logs := loadLogs(t)
+	now := time.Date(2020, 1, 26, 0, 0, 0, 0, time.UTC)
+	cases := map[string]int{
+		``:                                    3,
+		`status:delivered`:                    2,
+		`status:refused`:                      1,
+		`status:*bounce`:                      0,
+		`event:queued`:                        2,
+		`sender:*@hooli.com`:                  2,
+		`-sender:*@hooli.com`:                 1,
+		`NOT sender:*@hooli.com`:              1,
+		`subject~"series a"`:                  1,
+		`subject~piper`:                       2,
+		`piper`:                               3,
+		`reason:spam`:                         1,
+		`code:550`:                            1,
+		`domain:piedpiper.com`:                3,
+		`recipient:monica@piedpiper.com`:      1,
+		`after:2020-01-25T12:00:00Z`:          2,
+		`before:2020-01-25T12:00:00Z`:         1,
+		`after:2d`:                            3,
+		`after:1h`:                            0,
+		`status:refused OR subject~series`:    2,
+		`(status:refused OR subject~series)`:  2,
+		`status:delivered AND sender~russ`:    1,
+		`-(status:refused OR subject~series)`: 1,
+	}
+	for source, count := range cases {
+		query, error := ParseAt(source, now)
+		if assert.NoError(error, source) {
+			assert.Len(query.Filter(logs), count, source)
+			assert.Equal(source, query.String())
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	assert := assert.New(t)
+	for _, source := range []string{
+		`subject~"invoice`,
+		`status:exploded`,
+		`planet:mars`,
+		`after:someday`,
+		`code:abc`,
+		`(status:delivered`,
+		`status:delivered)`,
+		`OR status:delivered`,
+		`status~delivered`,
+	} {
+		_, error := Parse(source)
+		assert.Error(error, source)
+	}
+	assert.Panics(func() { MustParse(`planet:mars`) })
+}
+
+func TestMatch(t *testing.T) {
+	assert := assert.New(t)
+	entry := &improvmx.LogEntry{
+		Subject:   "Invoice #42",
+		Sender:    improvmx.Contact{Email: "gavin@hooli.com"},
+		Recipient: improvmx.Contact{Email: "richard@piedpiper.com"},
+		Events:    []improvmx.LogEvent{{Status: improvmx.HardBounce}},
+	}
+	assert.True(MustParse(`status:hard-bounce sender:*@hooli.com subject~"invoice"`).Match(entry))
+	assert.True(MustParse(`domain:piedpiper.com`).Match(entry))
+	assert.False(MustParse(`status:hard_bounce sender:*@piedpiper.com`).Match(entry))
+	assert.True((*Query)(nil).Match(entry))
+}
@@ -1,23 +1,39 @@
 package improvmx
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/go-resty/resty/v2"
 	"occult.work/doze"
 )
 
 type Session struct {
-	client      *doze.Client
-	Credentials *CredentialEndpoint
-	Account     *AccountEndpoint
-	Domains     *DomainEndpoint
-	Aliases     *AliasEndpoint
+	client       *doze.Client
+	hooks        []Hooks
+	middleware   []Middleware
+	logger       *slog.Logger
+	logLevels    LogLevels
+	preflight    bool
+	readOnly     bool
+	dryRun       *dryRun
+	capabilities capabilityCache
+	Credentials  *CredentialEndpoint
+	Account      *AccountEndpoint
+	Domains      *DomainEndpoint
+	Aliases      *AliasEndpoint
 }
 
 type SessionOption func(*Session) error
 
 func New(token string, options ...SessionOption) (*Session, error) {
-	session := &Session{}
+	session := &Session{logLevels: DefaultLogLevels}
 	session.client = doze.NewClient().
 		SetAuthToken(fmt.Sprintf("api:%s", token)).
 		SetAuthScheme("Basic").
@@ -28,6 +44,7 @@ func New(token string, options ...SessionOption) (*Session, error) {
 			return nil, error
 		}
 	}
+	session.install()
 	session.Credentials = (*CredentialEndpoint)(session.client)
 	session.Account = (*AccountEndpoint)(session.client)
 	session.Domains = (*DomainEndpoint)(session.client)
@@ -68,10 +85,123 @@ func WithBaseURL(url string) SessionOption {
 	}
 }
 
-// Enables the debug mode on the Session's internal http client.
+// Enables the debug mode on the Session's internal http client. The
+// Authorization header and passwords are redacted from logged requests. See
+// WithLogger for structured logging.
 func WithDebug() SessionOption {
 	return func(session *Session) error {
 		session.client.SetDebug()
+		(*resty.Client)(session.client).OnRequestLog(redactRequestLog)
 		return nil
 	}
 }
+
+// Retries requests failing with a transport error, a 429 Too Many Requests or
+// a 5xx status code up to count times, waiting with exponential backoff between
+// wait and maxWait. As they may have taken effect, POST requests are only
+// retried on a 429 Too Many Requests. By default, requests are not retried.
+func WithRetries(count int, wait, maxWait time.Duration) SessionOption {
+	return func(session *Session) error {
+		if count < 0 {
+			return fmt.Errorf("WithRetries was passed a negative count: %d", count)
+		}
+		client := (*resty.Client)(session.client)
+		client.SetRetryCount(count).AddRetryCondition(retryable)
+		if wait > 0 {
+			client.SetRetryWaitTime(wait)
+		}
+		if maxWait > 0 {
+			client.SetRetryMaxWaitTime(maxWait)
+		}
+		return nil
+	}
+}
+
+// Limits the session to rate requests per second on average, allowing bursts
+// of up to burst requests. Requests wait for their turn, unless their context
+// is done first.
+func WithRateLimit(rate float64, burst int) SessionOption {
+	return func(session *Session) error {
+		if rate <= 0 {
+			return fmt.Errorf("WithRateLimit was passed a non-positive rate: %v", rate)
+		}
+		if burst < 1 {
+			burst = 1
+		}
+		limiter := &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+		session.middleware = append(session.middleware, limiter.middleware)
+		return nil
+	}
+}
+
+// Wraps the transport of the session's http client with the dry run, the
+// read-only guard, the configured middleware, premium and preflight checks,
+// logger and hooks.
+func (session *Session) install() {
+	client := (*resty.Client)(session.client).GetClient()
+	transport := client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if session.dryRun != nil {
+		transport = &dryRunTransport{session: session, state: session.dryRun, next: transport}
+	}
+	if session.readOnly {
+		transport = &readOnlyTransport{session: session, next: transport}
+	}
+	for index := len(session.middleware) - 1; index >= 0; index-- {
+		transport = session.middleware[index](transport)
+	}
+	transport = &capabilityTransport{session: session, next: transport}
+	if session.preflight {
+		transport = &preflightTransport{session: session, next: transport}
+	}
+	if session.logger != nil {
+		transport = &logTransport{session: session, logger: session.logger, levels: session.logLevels, next: transport}
+	}
+	if len(session.hooks) != 0 {
+		transport = &hookTransport{session: session, hooks: session.hooks, next: transport}
+	}
+	client.Transport = transport
+}
+
+// Returns the operation the request corresponds to, based on its path relative
+// to the base URL of the session.
+func (session *Session) operation(request *http.Request) (operation, map[string]string, bool) {
+	return findOperation(request.Method, session.relativePath(request))
+}
+
+// Returns the path of the request relative to the base URL of the session.
+func (session *Session) relativePath(request *http.Request) string {
+	path := request.URL.Path
+	if base, error := url.Parse(session.client.HostURL); error == nil {
+		path = strings.TrimPrefix(path, strings.TrimSuffix(base.Path, "/"))
+	}
+	return path
+}
+
+func retryable(response *resty.Response, error error) bool {
+	if response != nil && response.StatusCode() == http.StatusTooManyRequests {
+		return true
+	}
+	if response != nil && response.Request != nil && response.Request.Method == http.MethodPost {
+		return false
+	}
+	if error != nil {
+		return !refused(error)
+	}
+	return response != nil && response.StatusCode() >= 500
+}
+
+// Errors returned without sending the request, or because the caller gave up,
+// for which retrying cannot succeed.
+var unretryable = []error{ErrReadOnly, ErrPremiumRequired, ErrLimitExceeded, context.Canceled, context.DeadlineExceeded}
+
+func refused(error error) bool {
+	for _, target := range unretryable {
+		if errors.Is(error, target) {
+			return true
+		}
+	}
+	return false
+}
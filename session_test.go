@@ -1,8 +1,15 @@
 package improvmx
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/go-resty/resty/v2"
 	"github.com/stretchr/testify/assert"
 	"occult.work/doze"
 )
@@ -47,3 +54,53 @@ func TestSessionWithClient(test *testing.T) {
 	assert.NotEmpty(session.Domains)
 	assert.NotEmpty(session.Aliases)
 }
+
+func TestSessionWithRetries(test *testing.T) {
+	assert := assert.New(test)
+	var attempts atomic.Int32
+	var status atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		attempts.Add(1)
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(int(status.Load()))
+		fmt.Fprint(writer, `{ "error": "fake error", "success": false }`)
+	}))
+	defer server.Close()
+	session, error := New("token", WithBaseURL(server.URL), WithRetries(2, time.Millisecond, time.Millisecond))
+	assert.NoError(error)
+
+	for _, test := range []struct {
+		status   int
+		create   bool
+		attempts int32
+	}{
+		{http.StatusInternalServerError, false, 3},
+		{http.StatusTooManyRequests, false, 3},
+		{http.StatusNotFound, false, 1},
+		{http.StatusInternalServerError, true, 1},
+		{http.StatusTooManyRequests, true, 3},
+	} {
+		attempts.Store(0)
+		status.Store(int32(test.status))
+		if test.create {
+			_, error = session.Aliases.Create(context.Background(), "piedpiper.com", "richard", "richard@example.com")
+		} else {
+			_, error = session.Aliases.Read(context.Background(), "piedpiper.com", "richard")
+		}
+		assert.Error(error)
+		assert.Equal(test.attempts, attempts.Load(), "status %d, create %t", test.status, test.create)
+	}
+}
+
+func TestRetryable(test *testing.T) {
+	assert := assert.New(test)
+	get := &resty.Response{Request: &resty.Request{Method: http.MethodGet}}
+	post := &resty.Response{Request: &resty.Request{Method: http.MethodPost}}
+	failure := fmt.Errorf("connection reset")
+	assert.True(retryable(get, failure))
+	assert.True(retryable(nil, failure))
+	assert.False(retryable(post, failure))
+	assert.False(retryable(get, fmt.Errorf("wrapped: %w", ErrReadOnly)))
+	assert.False(retryable(get, context.Canceled))
+	assert.False(retryable(get, nil))
+}